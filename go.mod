@@ -7,6 +7,8 @@ require (
 	github.com/dsoprea/go-exif/v3 v3.0.1
 	github.com/dsoprea/go-jpeg-image-structure/v2 v2.0.0-20221012074422-4f3f7e934102
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/image v0.36.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -21,5 +23,4 @@ require (
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/net v0.0.0-20221002022538-bcab6841153b // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
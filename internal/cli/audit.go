@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+var (
+	audit         bool
+	riskThreshold string
+)
+
+// riskLabels are the Japanese names of the risk levels in text output.
+var riskLabels = map[exif.RiskLevel]string{
+	exif.RiskNone:   "なし",
+	exif.RiskLow:    "低",
+	exif.RiskMedium: "中",
+	exif.RiskHigh:   "高",
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&audit, "audit", false, "--check-exif と併用し、位置情報・シリアル番号・所有者名・サムネイル・XMP/IPTCを分類してリスクレベルを判定します")
+	rootCmd.Flags().StringVar(&riskThreshold, "risk-threshold", exif.RiskLow.String(), "--audit で許容するリスクレベルの上限を指定します（none, low, medium, high）。これを超えるファイルがあると失敗します")
+}
+
+// runAuditEXIF classifies the metadata of JPEG files by risk and fails if
+// any file is riskier than --risk-threshold.
+func runAuditEXIF(w io.Writer, args []string) error {
+	threshold, err := exif.ParseRiskLevel(riskThreshold)
+	if err != nil {
+		return err
+	}
+
+	report, err := newReporter(w, "audit")
+	if err != nil {
+		return err
+	}
+
+	targetPath := resolveTargetPath(args)
+
+	// パスの存在確認
+	info, err := statTargetPath(targetPath)
+	if err != nil {
+		return err
+	}
+
+	jpegFiles, err := findFilesByType(targetPath, info, exif.IsJPEGFile, exif.FindJPEGFiles, "JPEG")
+	if err != nil {
+		return err
+	}
+
+	if len(jpegFiles) == 0 {
+		return report.nothingFound("JPEG")
+	}
+
+	text := report.text(w)
+
+	riskCounts := map[exif.RiskLevel]int{}
+	var passedCount, atRiskCount, errorCount int
+	for _, jpegPath := range jpegFiles {
+		start := time.Now()
+		rec := fileRecord{Input: jpegPath}
+		result, err := exif.AuditJPEG(jpegPath)
+		switch {
+		case err != nil:
+			fmt.Fprintf(text, "✗ エラー: %s - %v\n", jpegPath, err)
+			rec.Status, rec.Error = "failed", err.Error()
+			errorCount++
+		default:
+			mark := "✓"
+			rec.Status = "passed"
+			if result.Risk > threshold {
+				mark = "✗"
+				rec.Status = "at_risk"
+				atRiskCount++
+			} else {
+				passedCount++
+			}
+			riskCounts[result.Risk]++
+			rec.Risk, rec.Findings = result.Risk.String(), result.Findings
+
+			fmt.Fprintf(text, "%s [リスク: %s] %s\n", mark, riskLabels[result.Risk], jpegPath)
+			for _, f := range result.Findings {
+				fmt.Fprintf(text, "  - [%s] %s\n", riskLabels[f.Risk], f.Detail)
+			}
+		}
+		rec.DurationMS = durationMS(start)
+		report.file(rec)
+	}
+
+	// サマリー表示
+	if report.structured() {
+		report.finish()
+	} else {
+		fmt.Fprintf(w, "\n=== 監査結果 ===\n")
+		fmt.Fprintf(w, "総ファイル数: %d\n", len(jpegFiles))
+		for _, level := range []exif.RiskLevel{exif.RiskHigh, exif.RiskMedium, exif.RiskLow, exif.RiskNone} {
+			fmt.Fprintf(w, "リスク%s: %d\n", riskLabels[level], riskCounts[level])
+		}
+		fmt.Fprintf(w, "許容レベル（%s）超過: %d\n", riskLabels[threshold], atRiskCount)
+		fmt.Fprintf(w, "エラー: %d\n", errorCount)
+	}
+
+	if atRiskCount > 0 {
+		return batchError(atRiskCount+errorCount, passedCount, "許容するリスクレベル（%s）を超えるファイルがあります（%d件）", riskLabels[threshold], atRiskCount)
+	}
+	return batchError(errorCount, passedCount, "監査できなかったファイルがあります（%d件）", errorCount)
+}
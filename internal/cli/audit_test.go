@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAuditEXIF_Threshold(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	jpegFile, cleanup := setupScrubEnvironment(t)
+	defer cleanup()
+
+	// The sample photo carries GPS coordinates, a high risk.
+	var buf bytes.Buffer
+	err := runAuditEXIF(&buf, []string{jpegFile})
+	if err == nil {
+		t.Fatal("Expected an error for a file above the threshold")
+	}
+	if code := exitCode(err); code != exitTotalFailure {
+		t.Errorf("exitCode = %d, want %d", code, exitTotalFailure)
+	}
+	if !strings.Contains(err.Error(), "許容するリスクレベル（低）") {
+		t.Errorf("Expected the Japanese threshold label in the error, got %q", err.Error())
+	}
+	for _, want := range []string{"✗ [リスク: 高]", "GPS位置情報", "=== 監査結果 ==="} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	riskThreshold = "high"
+	buf.Reset()
+	if err := runAuditEXIF(&buf, []string{jpegFile}); err != nil {
+		t.Errorf("runAuditEXIF failed with threshold high: %v", err)
+	}
+	if !strings.Contains(buf.String(), "✓ [リスク: 高]") {
+		t.Errorf("Expected the file to pass, got:\n%s", buf.String())
+	}
+
+	riskThreshold = "severe"
+	if err := runAuditEXIF(&bytes.Buffer{}, []string{jpegFile}); err == nil {
+		t.Error("Expected an error for an unknown threshold")
+	}
+}
+
+func TestRunAuditEXIF_Output(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	jpegFile, cleanup := setupScrubEnvironment(t)
+	defer cleanup()
+
+	reportFormat = "json"
+	var buf bytes.Buffer
+	if err := runAuditEXIF(&buf, []string{filepath.Dir(jpegFile)}); err == nil {
+		t.Error("Expected an error for a file above the threshold")
+	}
+
+	var doc struct {
+		Files []struct {
+			Status   string `json:"status"`
+			Risk     string `json:"risk"`
+			Findings []struct {
+				Kind string `json:"kind"`
+				Risk string `json:"risk"`
+			} `json:"findings"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Status != "at_risk" || doc.Files[0].Risk != "high" {
+		t.Fatalf("Unexpected records: %+v", doc.Files)
+	}
+	var gps bool
+	for _, f := range doc.Files[0].Findings {
+		gps = gps || (f.Kind == "gps" && f.Risk == "high")
+	}
+	if !gps {
+		t.Errorf("Expected a high-risk gps finding, got %+v", doc.Files[0].Findings)
+	}
+}
+
+func TestRunConvert_AuditRequiresCheckEXIF(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	audit = true
+	if err := runConvert(nil, []string{"."}); err == nil || !strings.Contains(err.Error(), "--check-exif") {
+		t.Errorf("Expected an error for --audit without --check-exif, got %v", err)
+	}
+}
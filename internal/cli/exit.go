@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of the heic-convert process. Every mode uses the same scheme,
+// so that scripts can tell a broken batch from a partially failed one.
+const (
+	// exitOK means every file was processed successfully.
+	exitOK = 0
+	// exitError covers invalid options and arguments and any other error.
+	exitError = 1
+	// exitPartialFailure means some, but not all, files failed.
+	exitPartialFailure = 2
+	// exitTotalFailure means every processed file failed.
+	exitTotalFailure = 3
+	// exitNothingFound means no file to process was found.
+	exitNothingFound = 4
+	// exitInvalidPath means the given path does not exist or is not a file
+	// of the expected type.
+	exitInvalidPath = 5
+)
+
+// exitCodeError carries the exit code of the error it wraps.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// withExitCode returns err annotated with the process exit code.
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode returns the process exit code for an error returned by a
+// command: exitOK for nil, the annotated code if there is one, and
+// exitError otherwise.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ece *exitCodeError
+	if errors.As(err, &ece) {
+		return ece.code
+	}
+	return exitError
+}
+
+// batchError returns the error for a batch in which failed files failed and
+// succeeded files did not, or nil if none failed. msg describes the failure
+// and is formatted with args.
+func batchError(failed, succeeded int, msg string, args ...any) error {
+	if failed == 0 {
+		return nil
+	}
+	code := exitPartialFailure
+	if succeeded == 0 {
+		code = exitTotalFailure
+	}
+	return withExitCode(code, fmt.Errorf(msg, args...))
+}
+
+// nothingFoundError returns the error for a run that found no files of
+// fileTypeLabel (e.g. "HEIC") to process.
+func nothingFoundError(fileTypeLabel string) error {
+	return withExitCode(exitNothingFound, fmt.Errorf("%sファイルが見つかりませんでした", fileTypeLabel))
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestExitCode verifies the exit code of plain and annotated errors.
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"plain error", errors.New("boom"), exitError},
+		{"annotated", withExitCode(exitInvalidPath, errors.New("missing")), exitInvalidPath},
+		{"wrapped", fmt.Errorf("context: %w", nothingFoundError("HEIC")), exitNothingFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBatchError verifies that a batch is a success, a partial failure or a
+// total failure depending on its counts.
+func TestBatchError(t *testing.T) {
+	tests := []struct {
+		name              string
+		failed, succeeded int
+		want              int
+	}{
+		{"no failures", 0, 3, exitOK},
+		{"no files", 0, 0, exitOK},
+		{"partial failure", 1, 2, exitPartialFailure},
+		{"total failure", 3, 0, exitTotalFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := batchError(tt.failed, tt.succeeded, "%d件が失敗しました", tt.failed)
+			if got := exitCode(err); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+			if err != nil && err.Error() != fmt.Sprintf("%d件が失敗しました", tt.failed) {
+				t.Errorf("Unexpected message: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// listCmd lists the items of HEIC files
+var listCmd = &cobra.Command{
+	Use:   "list [ファイル/ディレクトリ]",
+	Short: "HEICファイルに含まれる画像の一覧を表示する",
+	Long: `HEICファイルに含まれる画像アイテムのID・種類・サイズ・役割を一覧表示します。
+連写やイメージコレクションなど複数の画像を含むファイルでは、--all-images で変換される画像に * が付きます。
+グリッド画像を構成するタイルは件数のみ表示します。`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runList(cmd.OutOrStdout(), args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
+
+func runList(w io.Writer, args []string) error {
+	report, err := newReporter(w, "list")
+	if err != nil {
+		return err
+	}
+
+	targetPath := resolveTargetPath(args)
+
+	// パスの存在確認
+	info, err := statTargetPath(targetPath)
+	if err != nil {
+		return err
+	}
+
+	heicFiles, err := findFilesByType(targetPath, info, exif.IsHEICFile, exif.FindHEICFiles, "HEIC")
+	if err != nil {
+		return err
+	}
+
+	if len(heicFiles) == 0 {
+		return report.nothingFound("HEIC")
+	}
+
+	var errorCount int
+	if report.structured() {
+		for _, heicPath := range heicFiles {
+			rec := listRecord(heicPath)
+			if rec.Error != "" {
+				errorCount++
+			}
+			report.file(rec)
+		}
+		report.finish()
+	} else {
+		for i, heicPath := range heicFiles {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			items, err := converter.ListItems(heicPath)
+			if err != nil {
+				fmt.Fprintf(w, "警告: %s の画像一覧の取得に失敗しました: %v\n", heicPath, err)
+				errorCount++
+				continue
+			}
+			printItems(w, heicPath, items)
+		}
+	}
+	return batchError(errorCount, len(heicFiles)-errorCount, "%d件のファイルの画像一覧を取得できませんでした", errorCount)
+}
+
+// printItems prints the items of heicPath as a table, leaving out grid
+// tiles, which are only counted.
+func printItems(w io.Writer, heicPath string, items []converter.ImageItem) {
+	fmt.Fprintf(w, "%s:\n", heicPath)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  \tID\tTYPE\tSIZE\tROLE")
+	tiles := 0
+	for _, item := range items {
+		if item.Role == converter.RoleTile {
+			tiles++
+			continue
+		}
+
+		mark := ""
+		if item.IsTopLevel() {
+			mark = "*"
+		}
+		size := "-"
+		if item.Width > 0 && item.Height > 0 {
+			size = fmt.Sprintf("%dx%d", item.Width, item.Height)
+		}
+		role := string(item.Role)
+		if item.AuxType != "" {
+			role += " (" + item.AuxType + ")"
+		}
+		if item.Hidden {
+			role += " [hidden]"
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\t%s\n", mark, item.ID, item.Type, size, role)
+	}
+	_ = tw.Flush()
+
+	if tiles > 0 {
+		fmt.Fprintf(w, "  （グリッドのタイル: %d件）\n", tiles)
+	}
+	fmt.Fprintf(w, "  変換対象の画像: %d件\n", len(converter.TopLevelImages(items)))
+}
+
+// listRecord lists the items of heicPath, grid tiles included, as a
+// structured record.
+func listRecord(heicPath string) fileRecord {
+	start := time.Now()
+	rec := fileRecord{Input: heicPath, Status: "ok"}
+	items, err := converter.ListItems(heicPath)
+	if err != nil {
+		rec.Status, rec.Error = "failed", err.Error()
+	}
+	for _, item := range items {
+		rec.Items = append(rec.Items, itemRecord{
+			ID:       item.ID,
+			Type:     item.Type,
+			Width:    item.Width,
+			Height:   item.Height,
+			Role:     string(item.Role),
+			AuxType:  item.AuxType,
+			Hidden:   item.Hidden,
+			TopLevel: item.IsTopLevel(),
+		})
+	}
+	rec.DurationMS = durationMS(start)
+	return rec
+}
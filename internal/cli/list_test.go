@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunList(t *testing.T) {
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	if err := runList(&buf, []string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runList failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"5712x4284",
+		"primary",
+		"thumbnail",
+		"auxiliary (urn:com:apple:photo:2020:aux:hdrgainmap) [hidden]",
+		"グリッドのタイル: 60件",
+		"変換対象の画像: 1件",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	// Only the primary image is marked as converted by --all-images.
+	if got := strings.Count(out, "*"); got != 1 {
+		t.Errorf("Expected 1 marked image, got %d:\n%s", got, out)
+	}
+
+	if err := runList(&buf, []string{filepath.Join(tmpDir, "missing.HEIC")}); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
+
+func TestRunConvertMode_AllImages(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	allImages = true
+	if err := runConvertMode([]string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "test_01.jpg")); err != nil {
+		t.Errorf("Expected numbered output test_01.jpg: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected no unnumbered output with --all-images")
+	}
+}
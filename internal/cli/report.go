@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// reportFormat is the value of the global --output flag.
+var reportFormat string
+
+// outputMode selects how results are printed.
+type outputMode string
+
+const (
+	// outputText prints human-readable lines. It is the default.
+	outputText outputMode = "text"
+	// outputJSON prints a single JSON document once every file is done.
+	outputJSON outputMode = "json"
+	// outputNDJSON prints one JSON object per line as each file is done,
+	// followed by a summary object.
+	outputNDJSON outputMode = "ndjson"
+)
+
+// parseOutputMode parses an --output value.
+func parseOutputMode(s string) (outputMode, error) {
+	switch m := outputMode(strings.ToLower(s)); m {
+	case "":
+		return outputText, nil
+	case outputText, outputJSON, outputNDJSON:
+		return m, nil
+	default:
+		return "", fmt.Errorf("不明な出力形式です: %s（指定可能: text, json, ndjson）", s)
+	}
+}
+
+// fileRecord is the structured result of processing a single file.
+type fileRecord struct {
+	// Type is "file" in NDJSON output, to tell records from the summary.
+	Type   string `json:"type,omitempty"`
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	// Status is the outcome, e.g. "converted", "skipped" or "failed".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Bytes is the size of the written output file.
+	Bytes      int64 `json:"bytes,omitempty"`
+	DurationMS int64 `json:"duration_ms"`
+	// EXIF is what happened to the EXIF metadata (see exifDecision), or
+	// whether a file has any ("present", "absent").
+	EXIF           string       `json:"exif,omitempty"`
+	Tags           []exif.Tag   `json:"tags,omitempty"`
+	TagNames       []string     `json:"tag_names,omitempty"`
+	Items          []itemRecord `json:"items,omitempty"`
+	AuxOutputs     []string     `json:"aux_outputs,omitempty"`
+	LivePhotoVideo string       `json:"live_photo_video,omitempty"`
+	Warnings       []string     `json:"warnings,omitempty"`
+	// Risk and Findings are the result of --check-exif --audit.
+	Risk     string         `json:"risk,omitempty"`
+	Findings []exif.Finding `json:"findings,omitempty"`
+}
+
+// itemRecord is an image item of a HEIC file, as printed by the list
+// subcommand.
+type itemRecord struct {
+	ID       uint32 `json:"id"`
+	Type     string `json:"type"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Role     string `json:"role"`
+	AuxType  string `json:"aux_type,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+	TopLevel bool   `json:"top_level"`
+}
+
+// summaryRecord closes the structured output of a run.
+type summaryRecord struct {
+	// Type is "summary" in NDJSON output.
+	Type  string `json:"type,omitempty"`
+	Mode  string `json:"mode"`
+	Total int    `json:"total"`
+	// Counts is the number of files per status.
+	Counts     map[string]int `json:"counts"`
+	DurationMS int64          `json:"duration_ms"`
+	// Error and ExitCode are set if the run failed as a whole, e.g. on an
+	// invalid path or option, rather than file by file.
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// reporter writes the structured output selected by --output. In text mode
+// it does nothing, and callers print their usual lines instead.
+type reporter struct {
+	mode    outputMode
+	w       io.Writer
+	name    string
+	start   time.Time
+	records []fileRecord
+	counts  map[string]int
+	// finished is set once the summary has been written.
+	finished bool
+}
+
+// activeReporter is the reporter created by the running command, so that
+// reportError can close its output if the command fails before doing so.
+var activeReporter *reporter
+
+// newReporter returns a reporter for the run mode name (e.g. "convert")
+// writing to w in the format selected by --output.
+func newReporter(w io.Writer, name string) (*reporter, error) {
+	mode, err := parseOutputMode(reportFormat)
+	if err != nil {
+		return nil, err
+	}
+	activeReporter = &reporter{mode: mode, w: w, name: name, start: time.Now(), counts: map[string]int{}}
+	return activeReporter, nil
+}
+
+// structured reports whether results are printed as JSON rather than text.
+func (r *reporter) structured() bool {
+	return r.mode != outputText
+}
+
+// text returns w for the lines printed for people, or io.Discard if the
+// results are printed as JSON instead.
+func (r *reporter) text(w io.Writer) io.Writer {
+	if r.structured() {
+		return io.Discard
+	}
+	return w
+}
+
+// nothingFound ends a run that found no files of fileTypeLabel (e.g.
+// "HEIC") to process, writing the empty summary in structured output, and
+// returns the error to exit with.
+func (r *reporter) nothingFound(fileTypeLabel string) error {
+	if r.structured() {
+		r.finish()
+	}
+	return nothingFoundError(fileTypeLabel)
+}
+
+// file records the result of one file. NDJSON output writes it right away.
+func (r *reporter) file(rec fileRecord) {
+	r.counts[rec.Status]++
+	switch r.mode {
+	case outputNDJSON:
+		rec.Type = "file"
+		r.encode(rec)
+	case outputJSON:
+		r.records = append(r.records, rec)
+	}
+}
+
+// finish writes the summary, and in JSON output the whole document.
+func (r *reporter) finish() {
+	r.writeSummary(summaryRecord{})
+}
+
+// fail writes the summary of a run that failed as a whole with err, along
+// with the records of the files processed so far.
+func (r *reporter) fail(err error) {
+	r.writeSummary(summaryRecord{Error: err.Error(), ExitCode: exitCode(err)})
+}
+
+// writeSummary completes summary with the counts of the run and writes it,
+// and in JSON output the whole document.
+func (r *reporter) writeSummary(summary summaryRecord) {
+	r.finished = true
+	summary.Mode = r.name
+	summary.Counts = r.counts
+	summary.DurationMS = durationMS(r.start)
+	for _, n := range r.counts {
+		summary.Total += n
+	}
+
+	switch r.mode {
+	case outputNDJSON:
+		summary.Type = "summary"
+		r.encode(summary)
+	case outputJSON:
+		records := r.records
+		if records == nil {
+			records = []fileRecord{}
+		}
+		r.encode(struct {
+			Files   []fileRecord  `json:"files"`
+			Summary summaryRecord `json:"summary"`
+		}{records, summary})
+	}
+}
+
+// reportError closes the structured output of cmd, which failed with err,
+// if the command did not write it itself: with --output=json or ndjson,
+// invalid paths and options are reported as a summary carrying the error
+// and the exit code instead of on stderr alone.
+func reportError(w io.Writer, cmd *cobra.Command, err error) {
+	r := activeReporter
+	if r == nil {
+		var rerr error
+		if r, rerr = newReporter(w, modeName(cmd)); rerr != nil {
+			return
+		}
+	}
+	if r.structured() && !r.finished {
+		r.fail(err)
+	}
+}
+
+// modeName returns the run mode reported for cmd: the name of a
+// subcommand, or the mode selected by the flags of the root command.
+func modeName(cmd *cobra.Command) string {
+	if cmd != rootCmd {
+		return cmd.Name()
+	}
+	switch {
+	case checkEXIF && audit:
+		return "audit"
+	case checkEXIF:
+		return "check-exif"
+	case showEXIF && !removeEXIF:
+		return "show-exif"
+	default:
+		return "convert"
+	}
+}
+
+// encode writes v as a single line of JSON.
+func (r *reporter) encode(v any) {
+	if err := json.NewEncoder(r.w).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "警告: 結果の出力に失敗しました: %v\n", err)
+	}
+}
+
+// warnf prints a warning that does not belong to a single file's record.
+// With --output=json or ndjson it goes to stderr so that stdout stays valid
+// JSON.
+func warnf(format string, args ...any) {
+	w := io.Writer(os.Stdout)
+	if mode, _ := parseOutputMode(reportFormat); mode != outputText {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "警告: "+format+"\n", args...)
+}
+
+// durationMS returns the milliseconds elapsed since start.
+func durationMS(start time.Time) int64 {
+	return time.Since(start).Milliseconds()
+}
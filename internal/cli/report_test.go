@@ -0,0 +1,340 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote
+func captureStdout(t *testing.T, fn func() error) ([]byte, error) {
+	t.Helper()
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r)
+		done <- buf.Bytes()
+	}()
+
+	fnErr := fn()
+	_ = w.Close()
+	os.Stdout = oldStdout
+	return <-done, fnErr
+}
+
+// jsonDocument is the shape of --output=json
+type jsonDocument struct {
+	Files   []fileRecord  `json:"files"`
+	Summary summaryRecord `json:"summary"`
+}
+
+func TestParseOutputMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    outputMode
+		wantErr bool
+	}{
+		{"", outputText, false},
+		{"text", outputText, false},
+		{"JSON", outputJSON, false},
+		{"ndjson", outputNDJSON, false},
+		{"yaml", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseOutputMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOutputMode(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRunConvertMode_OutputJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	reportFormat = "json"
+	removeEXIF = true
+	out, err := captureStdout(t, func() error {
+		return runConvertMode([]string{tmpDir})
+	})
+	if err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, out)
+	}
+	if len(doc.Files) != 1 {
+		t.Fatalf("Expected 1 file record, got %+v", doc.Files)
+	}
+	rec := doc.Files[0]
+	if rec.Input != filepath.Join(tmpDir, "test.HEIC") || rec.Output != filepath.Join(tmpDir, "test.jpg") {
+		t.Errorf("Unexpected paths: %s -> %s", rec.Input, rec.Output)
+	}
+	if rec.Status != "converted" || rec.EXIF != "removed" || rec.Bytes <= 0 {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if doc.Summary.Mode != "convert" || doc.Summary.Total != 1 || doc.Summary.Counts["converted"] != 1 {
+		t.Errorf("Unexpected summary: %+v", doc.Summary)
+	}
+}
+
+func TestRunConvertMode_OutputNDJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	reportFormat = "ndjson"
+	onConflict = "skip"
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.jpg"), []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write existing output: %v", err)
+	}
+	out, err := captureStdout(t, func() error {
+		return runConvertMode([]string{tmpDir})
+	})
+	if err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Line is not JSON: %v\n%s", err, scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected a file line and a summary line, got:\n%s", out)
+	}
+	if lines[0]["type"] != "file" || lines[0]["status"] != "skipped" {
+		t.Errorf("Unexpected file line: %v", lines[0])
+	}
+	if lines[1]["type"] != "summary" {
+		t.Errorf("Unexpected summary line: %v", lines[1])
+	}
+}
+
+func TestRunCheckEXIF_OutputJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	if err := runConvertMode([]string{tmpDir}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	reportFormat = "json"
+	out, err := captureStdout(t, func() error {
+		return runCheckEXIF([]string{tmpDir})
+	})
+	if err == nil {
+		t.Error("Expected an error for a JPEG with EXIF data")
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, out)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Status != "exif_found" || doc.Files[0].EXIF != "present" || len(doc.Files[0].TagNames) == 0 {
+		t.Errorf("Unexpected records: %+v", doc.Files)
+	}
+	if doc.Summary.Counts["exif_found"] != 1 {
+		t.Errorf("Unexpected summary: %+v", doc.Summary)
+	}
+}
+
+func TestRunShowEXIF_OutputJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	reportFormat = "json"
+	out, err := captureStdout(t, func() error {
+		return runShowEXIF([]string{tmpDir})
+	})
+	if err != nil {
+		t.Fatalf("runShowEXIF failed: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, out)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].EXIF != "present" || len(doc.Files[0].Tags) == 0 {
+		t.Fatalf("Unexpected records: %+v", doc.Files)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected --show-exif not to convert")
+	}
+}
+
+func TestRunList_OutputJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	reportFormat = "json"
+	var buf bytes.Buffer
+	if err := runList(&buf, []string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runList failed: %v", err)
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, buf.String())
+	}
+	topLevel := 0
+	for _, item := range doc.Files[0].Items {
+		if item.TopLevel {
+			topLevel++
+		}
+	}
+	if topLevel != 1 {
+		t.Errorf("Expected 1 top-level image, got %d: %+v", topLevel, doc.Files[0].Items)
+	}
+}
+
+func TestRunConvertMode_InvalidOutput(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	reportFormat = "xml"
+	if err := runConvertMode([]string{"."}); err == nil {
+		t.Error("Expected an error for an unknown --output value")
+	}
+}
+
+func TestReportError_InvalidPath(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	reportFormat = "json"
+	out, err := captureStdout(t, func() error {
+		err := runConvertMode([]string{filepath.Join(t.TempDir(), "missing.HEIC")})
+		reportError(os.Stdout, rootCmd, err)
+		return err
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a missing path")
+	}
+
+	var doc jsonDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, out)
+	}
+	if doc.Files == nil || len(doc.Files) != 0 {
+		t.Errorf("Expected an empty file list, got %+v", doc.Files)
+	}
+	if doc.Summary.Mode != "convert" || doc.Summary.ExitCode != exitInvalidPath || doc.Summary.Error != err.Error() {
+		t.Errorf("Unexpected summary: %+v", doc.Summary)
+	}
+}
+
+func TestReportError_BeforeReporter(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	reportFormat = "ndjson"
+	var buf bytes.Buffer
+	reportError(&buf, scrubCmd, errors.New("--privacy と --strip-tags は同時に指定できません"))
+
+	var summary summaryRecord
+	if err := json.Unmarshal(buf.Bytes(), &summary); err != nil {
+		t.Fatalf("Output is not a JSON line: %v\n%s", err, buf.String())
+	}
+	if summary.Type != "summary" || summary.Mode != "scrub" || summary.ExitCode != exitError || summary.Error == "" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	// Text output keeps the error on stderr only.
+	resetFlags()
+	buf.Reset()
+	reportError(&buf, rootCmd, errors.New("error"))
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output in text mode, got %q", buf.String())
+	}
+}
+
+func TestReportError_AlreadyFinished(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	reportFormat = "json"
+	var buf bytes.Buffer
+	err := runAuditEXIF(&buf, []string{t.TempDir()})
+	if exitCode(err) != exitNothingFound {
+		t.Fatalf("Expected a nothing-found error, got %v", err)
+	}
+	reportError(&bytes.Buffer{}, rootCmd, err)
+
+	dec := json.NewDecoder(&buf)
+	var doc jsonDocument
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("Output is not a JSON document: %v\n%s", err, buf.String())
+	}
+	if dec.More() {
+		t.Errorf("Expected a single document, got:\n%s", buf.String())
+	}
+	if doc.Summary.Mode != "audit" || doc.Summary.ExitCode != 0 {
+		t.Errorf("Unexpected summary: %+v", doc.Summary)
+	}
+}
+
+// TestReporter_NothingFound tests ending a run that found no files: only
+// structured output gets a summary, and both exit as nothing found
+func TestReporter_NothingFound(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	for _, format := range []string{"text", "json"} {
+		reportFormat = format
+		var buf bytes.Buffer
+		report, err := newReporter(&buf, "list")
+		if err != nil {
+			t.Fatalf("newReporter failed: %v", err)
+		}
+		if code := exitCode(report.nothingFound("HEIC")); code != exitNothingFound {
+			t.Errorf("%s: exitCode = %d, want %d", format, code, exitNothingFound)
+		}
+
+		if format == "text" {
+			if buf.Len() != 0 {
+				t.Errorf("Expected no text output, got:\n%s", buf.String())
+			}
+			continue
+		}
+		var doc jsonDocument
+		if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("Output is not a JSON document: %v\n%s", err, buf.String())
+		}
+		if doc.Summary.Mode != "list" || doc.Summary.Total != 0 || !report.finished {
+			t.Errorf("Unexpected summary: %+v", doc.Summary)
+		}
+	}
+}
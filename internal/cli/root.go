@@ -3,15 +3,22 @@
 package cli
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
 	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/livephoto"
 )
 
 var (
@@ -22,35 +29,84 @@ var (
 	checkEXIF   bool
 	uninstall   bool
 	showVersion bool
+	quality     int
+	preset      string
+	format      string
+	outputDir   string
+	nameTmpl    string
+	jobCount    int
+	onConflict  string
+	autoOrient  bool
+	maxWidth    int
+	maxHeight   int
+	maxPixels   int
+	scale       float64
+	colorSpace  string
+	background  string
+	exportAux   bool
+	allImages   bool
+	livePhoto   string
+	failFast    bool
+	stripTags   []string
+	keepTags    []string
+	privacy     string
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "heic-convert [ファイル/ディレクトリ]",
-	Short: "HEIC画像をJPEG形式に変換する（現時点ではJPEG形式をサポート）",
+	Short: "HEIC画像をJPEG/PNG/TIFF形式に変換する",
 	Long: `HEIC Image Converterは、HEIC形式の画像ファイルを他の画像形式に変換するコマンドラインツールです。
-現時点ではJPEG形式への変換をサポートしています。
+JPEG形式（デフォルト）のほか、--format オプションでPNG・TIFF形式への変換をサポートしています。
 
 引数なしで実行した場合、カレントディレクトリ内の全HEICファイルを再帰的に検索して変換します。
 ファイルパスまたはディレクトリパスを指定することで、特定のファイルやディレクトリを処理できます。`,
 	Args: cobra.MaximumNArgs(1),
+	// Failures past argument validation are not usage errors.
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		cmd.SilenceUsage = true
+	},
 	RunE: runConvert,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
+// The process exits with the code described in exit.go.
 func Execute() {
-	err := rootCmd.Execute()
+	cmd, err := rootCmd.ExecuteC()
 	if err != nil {
-		os.Exit(1)
+		reportError(os.Stdout, cmd, err)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&reportFormat, "output", string(outputText), "結果の出力形式を指定します（text, json, ndjson）")
 	rootCmd.Flags().BoolVar(&showEXIF, "show-exif", false, "EXIF情報を表示します")
-	rootCmd.Flags().BoolVar(&removeEXIF, "remove-exif", false, "EXIF情報を削除して変換します")
+	rootCmd.Flags().BoolVar(&removeEXIF, "remove-exif", false, "EXIF情報（XMPを含む）を削除して変換します")
+	rootCmd.Flags().StringSliceVar(&stripTags, "strip-tags", nil, fmt.Sprintf("指定したEXIFタグを削除して変換します（グループ: %s、タグ名、またはタグID（例: 0x010f）。カンマ区切り）", strings.Join(exif.TagGroups(), ", ")))
+	rootCmd.Flags().StringSliceVar(&keepTags, "keep-tags", nil, "指定したEXIFタグのみを残して変換します（--strip-tags と同じグループ・タグ名・タグID。カンマ区切り）")
+	rootCmd.Flags().StringVar(&privacy, "privacy", "", fmt.Sprintf("プライバシープロファイルに従ってEXIFタグを削除して変換します（%s）", privacyProfileHelp()))
 	rootCmd.Flags().BoolVar(&checkEXIF, "check-exif", false, "JPEGファイルのEXIF情報の有無をチェックします")
 	rootCmd.Flags().BoolVar(&uninstall, "uninstall", false, "アンインストールを実行します")
 	rootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "バージョンを表示します")
+	rootCmd.Flags().IntVar(&quality, "quality", 0, fmt.Sprintf("JPEG品質（%d-%d）を指定します（デフォルト: %d）", converter.MinJPEGQuality, converter.MaxJPEGQuality, converter.JPEGQuality))
+	rootCmd.Flags().StringVar(&preset, "preset", "", fmt.Sprintf("品質プリセットを指定します（%s）", strings.Join(converter.PresetNames(), ", ")))
+	rootCmd.Flags().StringVar(&format, "format", string(converter.FormatJPEG), "出力形式を指定します（jpeg, png, tiff。--show-exif のみの場合はEXIF情報の出力形式: text, json, yaml, csv）")
+	rootCmd.Flags().StringVar(&outputDir, "output-dir", "", "出力先ディレクトリを指定します（ディレクトリ構造を維持して出力）")
+	rootCmd.Flags().BoolVar(&autoOrient, "auto-orient", false, "画像の向きの情報に従ってピクセルを回転・反転して出力します")
+	rootCmd.Flags().BoolVar(&allImages, "all-images", false, "連写やイメージコレクションなど、ファイル内のすべての画像を <名前>_NN の連番で出力します")
+	rootCmd.Flags().BoolVar(&exportAux, "export-aux", false, "深度マップやポートレートマットなどの補助画像をグレースケールPNGとして書き出します")
+	rootCmd.Flags().IntVar(&maxWidth, "max-width", 0, "出力画像の最大幅（ピクセル）を指定します")
+	rootCmd.Flags().IntVar(&maxHeight, "max-height", 0, "出力画像の最大高さ（ピクセル）を指定します")
+	rootCmd.Flags().IntVar(&maxPixels, "max-pixels", 0, "出力画像の最大画素数（幅×高さ）を指定します")
+	rootCmd.Flags().Float64Var(&scale, "scale", 0, "出力画像の縮小率（0より大きく1以下）を指定します")
+	rootCmd.Flags().StringVar(&colorSpace, "colorspace", string(converter.ColorSpacePreserve), "出力画像の色空間を指定します（preserve: 元のICCプロファイルを埋め込む, srgb: sRGBに変換する）")
+	rootCmd.Flags().StringVar(&background, "background", "white", "透過部分を合成する背景色を指定します（JPEG出力時。例: #FFFFFF, white, black）")
+	rootCmd.Flags().StringVar(&livePhoto, "live-photo", string(livephoto.ModeIgnore), "Live Photoの動画（同名の.MOVファイル）の扱いを指定します（copy: 変換結果の隣にコピー, skip: 変換しない, ignore: 何もしない）")
+	rootCmd.Flags().StringVar(&onConflict, "on-conflict", string(converter.ConflictOverwrite), "出力ファイルが既に存在する場合の動作を指定します（skip, overwrite, rename, newer）")
+	rootCmd.Flags().IntVarP(&jobCount, "jobs", "j", 1, "同時に変換するファイル数を指定します（0: CPU数）")
+	rootCmd.Flags().BoolVar(&failFast, "fail-fast", false, "変換に失敗した時点で残りのファイルの変換を中止します")
+	rootCmd.Flags().StringVar(&nameTmpl, "name-template", "", fmt.Sprintf("出力ファイル名のテンプレートを指定します（%s）", strings.Join(converter.NamePlaceholders(), ", ")))
 }
 
 func runConvert(_ *cobra.Command, args []string) error {
@@ -65,8 +121,15 @@ func runConvert(_ *cobra.Command, args []string) error {
 		return runUninstall()
 	}
 
+	if audit && !checkEXIF {
+		return fmt.Errorf("--audit は --check-exif と同時に指定してください")
+	}
+
 	// EXIFチェックモード
 	if checkEXIF {
+		if audit {
+			return runAuditEXIF(os.Stdout, args)
+		}
 		return runCheckEXIF(args)
 	}
 
@@ -88,11 +151,22 @@ func resolveTargetPath(args []string) string {
 	return "."
 }
 
+// statTargetPath returns the os.Stat info of targetPath, failing with
+// exitInvalidPath if it does not exist.
+func statTargetPath(targetPath string) (os.FileInfo, error) {
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return nil, withExitCode(exitInvalidPath, fmt.Errorf("パスが見つかりません: %w", err))
+	}
+	return info, nil
+}
+
 // findFilesByType resolves the list of files to process for targetPath given
 // its already-fetched os.Stat info. If targetPath is a directory, it searches
 // recursively via findFn. If targetPath is a single file, it must satisfy isFn
 // or an error is returned. fileTypeLabel (e.g. "JPEG", "HEIC") is used to
-// build the Japanese error messages.
+// build the Japanese error messages. A file of the wrong type fails with
+// exitInvalidPath.
 func findFilesByType(targetPath string, info os.FileInfo, isFn func(string) bool, findFn func(string) ([]string, error), fileTypeLabel string) ([]string, error) {
 	if info.IsDir() {
 		// ディレクトリの場合、対象ファイルを再帰的に検索
@@ -105,19 +179,23 @@ func findFilesByType(targetPath string, info os.FileInfo, isFn func(string) bool
 
 	// ファイルの場合
 	if !isFn(targetPath) {
-		return nil, fmt.Errorf("指定されたファイルは%sファイルではありません: %s", fileTypeLabel, targetPath)
+		return nil, withExitCode(exitInvalidPath, fmt.Errorf("指定されたファイルは%sファイルではありません: %s", fileTypeLabel, targetPath))
 	}
 	return []string{targetPath}, nil
 }
 
 func runCheckEXIF(args []string) error {
+	report, err := newReporter(os.Stdout, "check-exif")
+	if err != nil {
+		return err
+	}
+
 	targetPath := resolveTargetPath(args)
 
 	// パスの存在確認
 	info, err := os.Stat(targetPath)
 	if err != nil {
-		fmt.Printf("警告: ファイルまたはディレクトリが見つかりません: %s\n", targetPath)
-		return nil
+		return withExitCode(exitInvalidPath, fmt.Errorf("ファイルまたはディレクトリが見つかりません: %s", targetPath))
 	}
 
 	jpegFiles, err := findFilesByType(targetPath, info, exif.IsJPEGFile, exif.FindJPEGFiles, "JPEG")
@@ -125,52 +203,83 @@ func runCheckEXIF(args []string) error {
 		return err
 	}
 
+	if len(jpegFiles) == 0 {
+		return report.nothingFound("JPEG")
+	}
+
 	// EXIFチェック
 	var hasEXIFCount, noEXIFCount, errorCount int
 	for _, jpegPath := range jpegFiles {
+		start := time.Now()
+		rec := fileRecord{Input: jpegPath}
 		hasEXIF, tags, err := exif.CheckEXIFInJPEG(jpegPath)
-		if err != nil {
-			fmt.Printf("✗ エラー: %s - %v\n", jpegPath, err)
+		switch {
+		case err != nil:
+			if !report.structured() {
+				fmt.Printf("✗ エラー: %s - %v\n", jpegPath, err)
+			}
+			rec.Status, rec.Error = "failed", err.Error()
 			errorCount++
-			continue
-		}
-
-		if hasEXIF {
-			fmt.Printf("✗ EXIF情報が残っています: %s\n", jpegPath)
-			if len(tags) > 0 {
-				fmt.Printf("  検出された主要なEXIFタグ: %s\n", tags[0])
-				if len(tags) > 1 {
-					fmt.Printf("  (他 %d 個のタグ)\n", len(tags)-1)
+		case hasEXIF:
+			if !report.structured() {
+				fmt.Printf("✗ EXIF情報が残っています: %s\n", jpegPath)
+				if len(tags) > 0 {
+					fmt.Printf("  検出された主要なEXIFタグ: %s\n", tags[0])
+					if len(tags) > 1 {
+						fmt.Printf("  (他 %d 個のタグ)\n", len(tags)-1)
+					}
 				}
 			}
+			rec.Status, rec.EXIF, rec.TagNames = "exif_found", "present", tags
 			hasEXIFCount++
-		} else {
-			fmt.Printf("✓ EXIF情報は削除されています: %s\n", jpegPath)
+		default:
+			if !report.structured() {
+				fmt.Printf("✓ EXIF情報は削除されています: %s\n", jpegPath)
+			}
+			rec.Status, rec.EXIF = "clean", "absent"
 			noEXIFCount++
 		}
+		rec.DurationMS = durationMS(start)
+		report.file(rec)
 	}
 
 	// サマリー表示
-	fmt.Printf("\n=== チェック結果 ===\n")
-	fmt.Printf("総ファイル数: %d\n", len(jpegFiles))
-	fmt.Printf("EXIF削除済み: %d\n", noEXIFCount)
-	fmt.Printf("EXIF残存: %d\n", hasEXIFCount)
-	fmt.Printf("エラー: %d\n", errorCount)
+	if report.structured() {
+		report.finish()
+	} else {
+		fmt.Printf("\n=== チェック結果 ===\n")
+		fmt.Printf("総ファイル数: %d\n", len(jpegFiles))
+		fmt.Printf("EXIF削除済み: %d\n", noEXIFCount)
+		fmt.Printf("EXIF残存: %d\n", hasEXIFCount)
+		fmt.Printf("エラー: %d\n", errorCount)
+	}
 
 	if hasEXIFCount > 0 {
-		return fmt.Errorf("EXIF情報が残っているファイルがあります（%d件）", hasEXIFCount)
+		return batchError(hasEXIFCount+errorCount, noEXIFCount, "EXIF情報が残っているファイルがあります（%d件）", hasEXIFCount)
 	}
-
-	return nil
+	return batchError(errorCount, noEXIFCount, "チェックできなかったファイルがあります（%d件）", errorCount)
 }
 
 func runShowEXIF(args []string) error {
+	report, err := newReporter(os.Stdout, "show-exif")
+	if err != nil {
+		return err
+	}
+
+	dumpFormat, err := exifDumpFormat(format)
+	if err != nil {
+		return err
+	}
+	if dumpFormat != "" && report.structured() {
+		return fmt.Errorf("--show-exif の --format と --output は同時に指定できません")
+	}
+
 	targetPath := resolveTargetPath(args)
 
 	// パスの存在確認
-	info, err := os.Stat(targetPath)
+	info, err := statTargetPath(targetPath)
 	if err != nil {
-		return fmt.Errorf("パスが見つかりません: %w", err)
+		return err
 	}
 
 	heicFiles, err := findFilesByType(targetPath, info, exif.IsHEICFile, exif.FindHEICFiles, "HEIC")
@@ -178,37 +287,197 @@ func runShowEXIF(args []string) error {
 		return err
 	}
 
+	if dumpFormat != "" {
+		return dumpEXIF(os.Stdout, heicFiles, dumpFormat)
+	}
+
 	if len(heicFiles) == 0 {
-		fmt.Println("EXIF情報を表示するHEICファイルが見つかりませんでした。")
-		return nil
+		return report.nothingFound("HEIC")
 	}
 
 	// EXIF情報の表示
 	var errorCount int
 	for _, heicPath := range heicFiles {
-		if err := exif.ShowEXIFFromHEIC(heicPath); err != nil {
-			fmt.Printf("警告: %s のEXIF情報の表示に失敗しました: %v\n", heicPath, err)
+		if !report.structured() {
+			if err := exif.ShowEXIFFromHEIC(heicPath); err != nil {
+				fmt.Printf("警告: %s のEXIF情報の表示に失敗しました: %v\n", heicPath, err)
+				errorCount++
+			}
+			continue
+		}
+
+		start := time.Now()
+		rec := fileRecord{Input: heicPath, Status: "ok", EXIF: "absent"}
+		tags, err := exif.ReadTagsFromHEIC(heicPath)
+		if err != nil {
+			rec.Status, rec.EXIF, rec.Error = "failed", "", err.Error()
 			errorCount++
+		} else if tags != nil {
+			rec.EXIF, rec.Tags = "present", tags
 		}
+		rec.DurationMS = durationMS(start)
+		report.file(rec)
 	}
 
 	// サマリー表示
-	if len(heicFiles) > 1 {
+	if report.structured() {
+		report.finish()
+	} else if len(heicFiles) > 1 {
 		fmt.Printf("\n=== 表示結果 ===\n")
 		fmt.Printf("表示成功: %d\n", len(heicFiles)-errorCount)
 		fmt.Printf("表示失敗: %d\n", errorCount)
 	}
 
-	return nil
+	return batchError(errorCount, len(heicFiles)-errorCount, "EXIF情報を表示できなかったファイルがあります（%d件）", errorCount)
+}
+
+// exifDumpFormat returns the structured EXIF dump format that --format
+// selects in --show-exif mode, or "" for the usual text output. No image is
+// written in this mode, so the flag's default (jpeg) also means text.
+func exifDumpFormat(s string) (exif.DumpFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "text", "jpg", string(converter.FormatJPEG):
+		return "", nil
+	}
+	return exif.ParseDumpFormat(s)
+}
+
+// dumpEXIF writes every EXIF tag of heicFiles to w in dumpFormat. Files
+// whose EXIF data cannot be read are reported with a warning (and, in JSON
+// and YAML, an error field) without stopping the dump.
+func dumpEXIF(w io.Writer, heicFiles []string, dumpFormat exif.DumpFormat) error {
+	dump := exif.NewDumpWriter(w, dumpFormat)
+	var errorCount int
+	for _, heicPath := range heicFiles {
+		ft := exif.FileTags{File: heicPath}
+		tags, err := exif.ReadTagsFromHEIC(heicPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: %s のEXIF情報の読み込みに失敗しました: %v\n", heicPath, err)
+			ft.Error = err.Error()
+			errorCount++
+		}
+		ft.Tags = tags
+		if err := dump.Write(ft); err != nil {
+			return fmt.Errorf("EXIF情報の出力に失敗しました: %w", err)
+		}
+	}
+	if err := dump.Close(); err != nil {
+		return fmt.Errorf("EXIF情報の出力に失敗しました: %w", err)
+	}
+	if len(heicFiles) == 0 {
+		return nothingFoundError("HEIC")
+	}
+	return batchError(errorCount, len(heicFiles)-errorCount, "EXIF情報を読み込めなかったファイルがあります（%d件）", errorCount)
+}
+
+// buildConvertOptions assembles converter.ConvertOptions from the command
+// line flags, validating them before any file is touched.
+func buildConvertOptions() (converter.ConvertOptions, error) {
+	options := converter.ConvertOptions{
+		RemoveEXIF: removeEXIF,
+		AutoOrient: autoOrient,
+		ExportAux:  exportAux,
+		Resize: converter.ResizeOptions{
+			MaxWidth:  maxWidth,
+			MaxHeight: maxHeight,
+			MaxPixels: maxPixels,
+			Scale:     scale,
+		},
+	}
+
+	if err := options.Resize.Validate(); err != nil {
+		return options, err
+	}
+
+	if removeEXIF && (privacy != "" || len(stripTags) > 0 || len(keepTags) > 0) {
+		return options, fmt.Errorf("--remove-exif と --privacy / --strip-tags / --keep-tags は同時に指定できません")
+	}
+	filter, err := buildTagFilter(privacy, stripTags, keepTags)
+	if err != nil {
+		return options, err
+	}
+	options.EXIFFilter = filter
+
+	outputFormat, err := converter.ParseFormat(format)
+	if err != nil {
+		return options, err
+	}
+	options.Format = outputFormat
+
+	options.OnConflict, err = converter.ParseConflictPolicy(onConflict)
+	if err != nil {
+		return options, err
+	}
+
+	options.ColorSpace, err = converter.ParseColorSpace(colorSpace)
+	if err != nil {
+		return options, err
+	}
+
+	options.Background, err = converter.ParseBackground(background)
+	if err != nil {
+		return options, err
+	}
+
+	if outputFormat != converter.FormatJPEG && (quality != 0 || preset != "") {
+		return options, fmt.Errorf("--quality と --preset はJPEG形式の出力でのみ指定できます")
+	}
+
+	switch {
+	case quality != 0 && preset != "":
+		return options, fmt.Errorf("--quality と --preset は同時に指定できません")
+	case preset != "":
+		q, err := converter.QualityForPreset(preset)
+		if err != nil {
+			return options, err
+		}
+		options.Quality = q
+	case quality != 0:
+		if err := converter.ValidateQuality(quality); err != nil {
+			return options, err
+		}
+		options.Quality = quality
+	}
+
+	return options, nil
 }
 
 func runConvertMode(args []string) error {
+	// 変換オプション
+	options, err := buildConvertOptions()
+	if err != nil {
+		return err
+	}
+
+	workers, err := resolveJobs(jobCount)
+	if err != nil {
+		return err
+	}
+
+	livePhotoMode, err := livephoto.ParseMode(livePhoto)
+	if err != nil {
+		return err
+	}
+
+	report, err := newReporter(os.Stdout, "convert")
+	if err != nil {
+		return err
+	}
+
+	var tmpl *converter.NameTemplate
+	if nameTmpl != "" {
+		tmpl, err = converter.ParseNameTemplate(nameTmpl)
+		if err != nil {
+			return err
+		}
+	}
+
 	targetPath := resolveTargetPath(args)
 
 	// パスの存在確認
-	info, err := os.Stat(targetPath)
+	info, err := statTargetPath(targetPath)
 	if err != nil {
-		return fmt.Errorf("パスが見つかりません: %w", err)
+		return err
 	}
 
 	heicFiles, err := findFilesByType(targetPath, info, exif.IsHEICFile, exif.FindHEICFiles, "HEIC")
@@ -217,60 +486,402 @@ func runConvertMode(args []string) error {
 	}
 
 	if len(heicFiles) == 0 {
-		fmt.Println("HEICファイルが見つかりませんでした。")
-		return nil
+		return report.nothingFound("HEIC")
 	}
 
-	// 変換オプション
-	options := converter.ConvertOptions{
-		RemoveEXIF: removeEXIF,
+	// 出力先ディレクトリ指定時は、変換元のディレクトリ構造を出力先に再現する
+	sourceRoot := targetPath
+	if !info.IsDir() {
+		sourceRoot = filepath.Dir(targetPath)
+	}
+
+	// 出力先の決定（衝突回避のため、並列変換の前に順番に決める）
+	planner := converter.NewOutputPlanner()
+	companions := livephoto.NewCompanionIndex()
+	var jobs []convertJob
+	for i, heicPath := range heicFiles {
+		var fileJobs []convertJob
+		if allImages {
+			fileJobs = planAllImageJobs(heicPath, sourceRoot, i+1, options, tmpl, planner)
+		} else {
+			job := convertJob{heicPath: heicPath, options: options}
+			job.options.OutputPath, job.planErr = planOutputPath(heicPath, sourceRoot, i+1, 0, options.Format, tmpl, planner)
+			fileJobs = []convertJob{job}
+		}
+		if livePhotoMode != livephoto.ModeIgnore {
+			attachLivePhoto(fileJobs, livePhotoMode, companions)
+		}
+		jobs = append(jobs, fileJobs...)
 	}
 
 	// 変換処理
-	var successCount, errorCount int
-	for _, heicPath := range heicFiles {
-		// EXIF情報の表示（変換前にHEICファイルから表示）
-		if showEXIF {
-			if err := exif.ShowEXIFFromHEIC(heicPath); err != nil {
-				fmt.Printf("警告: %s のEXIF情報の表示に失敗しました: %v\n", heicPath, err)
-			}
+	structured := report.structured()
+	summary := runConvertJobs(jobs, workers, func(w io.Writer, job convertJob) fileRecord {
+		return convertFile(w, job, structured)
+	}, report, failFast)
+
+	// サマリー表示
+	if report.structured() {
+		report.finish()
+	} else if len(jobs) > 1 {
+		fmt.Printf("\n=== 変換結果 ===\n")
+		fmt.Printf("変換成功: %d\n", summary.succeeded)
+		fmt.Printf("スキップ: %d\n", summary.skipped)
+		fmt.Printf("変換失敗: %d\n", summary.failed)
+		if summary.canceled > 0 {
+			fmt.Printf("中止: %d\n", summary.canceled)
 		}
+	}
 
-		// HEIC→JPEG変換
-		if err := converter.ConvertHEICToJPEG(heicPath, options); err != nil {
-			fmt.Printf("✗ 変換失敗: %s - %v\n", heicPath, err)
-			errorCount++
-			continue
+	if summary.canceled > 0 {
+		return batchError(summary.failed, summary.succeeded+summary.skipped, "変換に失敗したため、残りの%d件の変換を中止しました", summary.canceled)
+	}
+	return batchError(summary.failed, summary.succeeded+summary.skipped, "%d件の変換に失敗しました", summary.failed)
+}
+
+// convertJob is a single planned conversion within a batch.
+type convertJob struct {
+	heicPath string
+	// options carries the planned output path in OutputPath.
+	options converter.ConvertOptions
+	// planErr is set if no output path could be planned for heicPath.
+	planErr error
+	// companion is the Live Photo video of heicPath, if any, and
+	// livePhotoMode what to do with it.
+	companion     string
+	livePhotoMode livephoto.Mode
+}
+
+// planAllImageJobs plans one job per top-level image of heicPath for
+// --all-images, numbering the outputs in the order of
+// converter.TopLevelImages. If the file cannot be listed, a single job
+// carrying the error is returned.
+func planAllImageJobs(heicPath, sourceRoot string, index int, options converter.ConvertOptions, tmpl *converter.NameTemplate, planner *converter.OutputPlanner) []convertJob {
+	items, err := converter.ListItems(heicPath)
+	if err != nil {
+		return []convertJob{{heicPath: heicPath, options: options, planErr: err}}
+	}
+
+	images := converter.TopLevelImages(items)
+	jobs := make([]convertJob, len(images))
+	for n, item := range images {
+		jobs[n].heicPath = heicPath
+		jobs[n].options = options
+		jobs[n].options.ItemID = item.ID
+		jobs[n].options.OutputPath, jobs[n].planErr = planOutputPath(heicPath, sourceRoot, index, n+1, options.Format, tmpl, planner)
+	}
+	return jobs
+}
+
+// attachLivePhoto looks up the Live Photo video of the file the jobs convert
+// in companions and records it with mode. With livephoto.ModeCopy the video is only
+// copied next to the first output (the primary image); with
+// livephoto.ModeSkip every job of the file is skipped.
+func attachLivePhoto(jobs []convertJob, mode livephoto.Mode, companions *livephoto.CompanionIndex) {
+	if len(jobs) == 0 {
+		return
+	}
+	companion, err := companions.FindCompanion(jobs[0].heicPath)
+	if err != nil {
+		warnf("%s のLive Photo動画の検出に失敗しました: %v", jobs[0].heicPath, err)
+		return
+	}
+	if companion == "" {
+		return
+	}
+	for i := range jobs {
+		if mode == livephoto.ModeCopy && i > 0 {
+			break
 		}
+		jobs[i].companion = companion
+		jobs[i].livePhotoMode = mode
+	}
+}
+
+// resolveJobs returns the number of concurrent conversions for --jobs,
+// where 0 selects the number of CPUs.
+func resolveJobs(n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("--jobs には0以上の値を指定してください: %d", n)
+	}
+	if n == 0 {
+		return runtime.NumCPU(), nil
+	}
+	return n, nil
+}
+
+// convertStatus is the outcome of a single convertJob, as reported in
+// fileRecord.Status.
+type convertStatus string
+
+const (
+	statusConverted convertStatus = "converted"
+	statusSkipped   convertStatus = "skipped"
+	statusFailed    convertStatus = "failed"
+	// statusCanceled marks jobs not run because --fail-fast stopped the
+	// batch.
+	statusCanceled convertStatus = "canceled"
+)
+
+// batchSummary counts the outcomes of a batch.
+type batchSummary struct {
+	succeeded int
+	skipped   int
+	failed    int
+	canceled  int
+}
+
+// runConvertJobs runs convert for every job on up to workers goroutines and
+// returns the outcome counts. Each job writes its console output
+// to its own buffer, and the buffers are printed in input order as soon as
+// every earlier job has finished, so lines from concurrent conversions never
+// interleave. With structured output, the jobs' records are passed to report
+// in the same order instead. With failFast, jobs that have not started when
+// a job fails are not run and are counted as canceled.
+func runConvertJobs(jobs []convertJob, workers int, convert func(w io.Writer, job convertJob) fileRecord, report *reporter, failFast bool) batchSummary {
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
 
-		// 出力ファイルパス
-		outputPath := converter.GenerateOutputPath(heicPath)
+	outputs := make([]bytes.Buffer, len(jobs))
+	done := make([]chan fileRecord, len(jobs))
+	for i := range done {
+		done[i] = make(chan fileRecord, 1)
+	}
 
-		// EXIF情報の処理
-		if removeEXIF {
-			// EXIF情報を削除
-			if err := exif.RemoveEXIFFromJPEG(outputPath); err != nil {
-				fmt.Printf("警告: %s のEXIF情報の削除に失敗しました: %v\n", outputPath, err)
+	var stopped atomic.Bool
+	queue := make(chan int)
+	for range workers {
+		go func() {
+			for i := range queue {
+				if stopped.Load() {
+					done[i] <- fileRecord{Input: jobs[i].heicPath, Output: jobs[i].options.OutputPath, Status: string(statusCanceled)}
+					continue
+				}
+				start := time.Now()
+				rec := convert(&outputs[i], jobs[i])
+				rec.DurationMS = durationMS(start)
+				if failFast && rec.Status == string(statusFailed) {
+					stopped.Store(true)
+				}
+				done[i] <- rec
 			}
+		}()
+	}
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	var summary batchSummary
+	for i := range jobs {
+		rec := <-done[i]
+		if report.structured() {
+			report.file(rec)
 		} else {
-			// EXIF情報を保持（HEICからJPEGへコピー）
-			if err := exif.CopyEXIFFromHEICToJPEG(heicPath, outputPath); err != nil {
-				fmt.Printf("警告: %s のEXIF情報の保持に失敗しました: %v\n", outputPath, err)
-			}
+			_, _ = os.Stdout.Write(outputs[i].Bytes())
+		}
+		switch convertStatus(rec.Status) {
+		case statusConverted:
+			summary.succeeded++
+		case statusSkipped:
+			summary.skipped++
+		case statusCanceled:
+			summary.canceled++
+		default:
+			summary.failed++
 		}
+	}
+	return summary
+}
 
-		fmt.Printf("✓ 変換完了: %s -> %s\n", heicPath, outputPath)
-		successCount++
+// convertFile converts a single planned job, writing its progress and
+// warnings to w and returning its structured result. With structured
+// output, the --show-exif tags are only recorded, not rendered as text.
+func convertFile(w io.Writer, job convertJob, structured bool) fileRecord {
+	heicPath := job.heicPath
+	rec := fileRecord{Input: heicPath, Output: job.options.OutputPath}
+	fail := func(err error) fileRecord {
+		fmt.Fprintf(w, "✗ 変換失敗: %s - %v\n", heicPath, err)
+		rec.Status, rec.Error = string(statusFailed), err.Error()
+		return rec
 	}
 
-	// サマリー表示
-	if len(heicFiles) > 1 {
-		fmt.Printf("\n=== 変換結果 ===\n")
-		fmt.Printf("変換成功: %d\n", successCount)
-		fmt.Printf("変換失敗: %d\n", errorCount)
+	// EXIF情報の表示（変換前にHEICファイルから表示）
+	if showEXIF {
+		tags, err := exif.ReadTagsFromHEIC(heicPath)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "警告: %s のEXIF情報の表示に失敗しました: %v\n", heicPath, err)
+			rec.Warnings = append(rec.Warnings, fmt.Sprintf("EXIF情報の表示に失敗しました: %v", err))
+		case !structured:
+			exif.FprintEXIFTags(w, heicPath, tags)
+		}
+		rec.Tags = tags
 	}
 
-	return nil
+	if job.planErr != nil {
+		return fail(job.planErr)
+	}
+
+	if job.companion != "" && job.livePhotoMode == livephoto.ModeSkip {
+		fmt.Fprintf(w, "- スキップ: %s（Live Photoです: %s）\n", heicPath, job.companion)
+		rec.Status, rec.LivePhotoVideo = string(statusSkipped), job.companion
+		return rec
+	}
+
+	// HEIC変換
+	result, err := converter.ConvertHEIC(heicPath, job.options)
+	if err != nil {
+		return fail(err)
+	}
+
+	// 出力ファイルパス
+	outputPath := result.OutputPath
+	rec.Output = outputPath
+
+	if result.Skipped {
+		fmt.Fprintf(w, "- スキップ: %s（出力ファイルが既に存在します: %s）\n", heicPath, outputPath)
+		rec.Status = string(statusSkipped)
+		return rec
+	}
+
+	// EXIF情報はコンバータが出力時に埋め込み（または削除）済み
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(w, "警告: %s - %s\n", outputPath, warning)
+	}
+	rec.Status = string(statusConverted)
+	rec.EXIF = exifDecision(job.options, result)
+	rec.AuxOutputs = result.AuxOutputPaths
+	rec.Warnings = append(rec.Warnings, result.Warnings...)
+	if info, err := os.Stat(outputPath); err == nil {
+		rec.Bytes = info.Size()
+	}
+
+	fmt.Fprintf(w, "✓ 変換完了: %s -> %s\n", heicPath, outputPath)
+	for _, auxPath := range result.AuxOutputPaths {
+		fmt.Fprintf(w, "  補助画像: %s\n", auxPath)
+	}
+
+	if job.companion != "" && job.livePhotoMode == livephoto.ModeCopy {
+		videoPath, err := livephoto.CopyCompanion(job.companion, outputPath)
+		if err != nil {
+			fmt.Fprintf(w, "警告: %s - Live Photoの動画をコピーできませんでした: %v\n", outputPath, err)
+			rec.Warnings = append(rec.Warnings, fmt.Sprintf("Live Photoの動画をコピーできませんでした: %v", err))
+		} else {
+			fmt.Fprintf(w, "  Live Photo動画: %s\n", videoPath)
+			rec.LivePhotoVideo = videoPath
+		}
+	}
+	return rec
+}
+
+// buildTagFilter returns the EXIF tag filter selected by a --privacy
+// profile, or by --strip-tags and --keep-tags, which cannot be combined with
+// a profile. It returns nil if every tag is kept.
+func buildTagFilter(profileName string, strip, keep []string) (*exif.TagFilter, error) {
+	if profileName == "" {
+		return exif.NewTagFilter(strip, keep)
+	}
+	if len(strip) > 0 || len(keep) > 0 {
+		return nil, fmt.Errorf("--privacy と --strip-tags / --keep-tags は同時に指定できません")
+	}
+	profile, err := exif.LookupPrivacyProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	return profile.TagFilter()
+}
+
+// privacyProfileHelp lists the privacy profiles for flag help texts, e.g.
+// "share: 位置情報...を削除, ...".
+func privacyProfileHelp() string {
+	profiles := exif.PrivacyProfiles()
+	descriptions := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		descriptions = append(descriptions, p.Name+": "+p.Description)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// exifDecision describes what happened to the source's EXIF metadata in a
+// conversion: "removed" (--remove-exif), "kept", "filtered" (kept without
+// the tags removed by --privacy, --strip-tags or --keep-tags), "dropped" (the output
+// format cannot store EXIF) or "none" (the source has no EXIF, or the
+// filter left no tags).
+func exifDecision(options converter.ConvertOptions, result *converter.Result) string {
+	switch {
+	case options.RemoveEXIF:
+		return "removed"
+	case !result.EXIF:
+		return "none"
+	case options.Format == converter.FormatTIFF:
+		return "dropped"
+	case options.EXIFFilter != nil:
+		return "filtered"
+	default:
+		return "kept"
+	}
+}
+
+// planOutputPath decides where heicPath is converted to: next to the input
+// or mirrored under --output-dir, renamed by tmpl if set, numbered with
+// imageNumber for --all-images (0 for none), and made unique within the
+// batch by planner. index is the 1-based position of heicPath in the batch.
+func planOutputPath(heicPath, sourceRoot string, index, imageNumber int, outputFormat converter.Format, tmpl *converter.NameTemplate, planner *converter.OutputPlanner) (string, error) {
+	outputPath := converter.GenerateOutputPathForFormat(heicPath, outputFormat)
+	if outputDir != "" {
+		var err error
+		outputPath, err = converter.MirrorOutputPath(heicPath, sourceRoot, outputDir, outputFormat)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if tmpl != nil {
+		outputPath = converter.ApplyNameTemplate(outputPath, tmpl, nameFieldsFor(heicPath, index, tmpl.NeedsMetadata()))
+	}
+
+	if imageNumber > 0 {
+		outputPath = converter.NumberedOutputPath(outputPath, imageNumber)
+	}
+
+	return planner.Claim(outputPath), nil
+}
+
+// nameFieldsFor collects the values a name template can reference for
+// heicPath. EXIF data and image dimensions are only read when withMetadata
+// is set; if they cannot be read, the affected placeholders render as
+// "unknown".
+func nameFieldsFor(heicPath string, index int, withMetadata bool) converter.NameFields {
+	fields := converter.NameFields{
+		Stem:  strings.TrimSuffix(filepath.Base(heicPath), filepath.Ext(heicPath)),
+		Index: index,
+	}
+	if !withMetadata {
+		return fields
+	}
+
+	info, err := exif.ExtractImageInfoFromHEIC(heicPath)
+	if err != nil && !errors.Is(err, exif.ErrNoEXIF) {
+		warnf("%s のEXIF情報の読み込みに失敗しました: %v", heicPath, err)
+	}
+	fields.DateTime = info.DateTimeOriginal
+	fields.Make = info.Make
+	fields.Model = info.Model
+	fields.Width = info.Width
+	fields.Height = info.Height
+
+	// EXIFに画像サイズがない場合はHEICのヘッダから取得する
+	if fields.Width == 0 || fields.Height == 0 {
+		if w, h, err := converter.ReadImageSize(heicPath); err == nil {
+			fields.Width, fields.Height = w, h
+		}
+	}
+
+	return fields
 }
 
 func runUninstall() error {
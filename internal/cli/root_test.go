@@ -2,11 +2,16 @@ package cli
 
 import (
 	"bytes"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	exifv3 "github.com/dsoprea/go-exif/v3"
 	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
@@ -126,6 +131,31 @@ func resetFlags() {
 	checkEXIF = false
 	uninstall = false
 	showVersion = false
+	quality = 0
+	preset = ""
+	format = ""
+	outputDir = ""
+	nameTmpl = ""
+	jobCount = 1
+	onConflict = ""
+	autoOrient = false
+	maxWidth = 0
+	maxHeight = 0
+	maxPixels = 0
+	scale = 0
+	colorSpace = ""
+	background = ""
+	exportAux = false
+	allImages = false
+	livePhoto = ""
+	reportFormat = ""
+	failFast = false
+	stripTags = nil
+	keepTags = nil
+	privacy = ""
+	audit = false
+	riskThreshold = "low"
+	activeReporter = nil
 }
 
 // TestRunConvertMode_TC00101 tests TC-001-01: Normal conversion of HEIC to JPEG
@@ -257,6 +287,9 @@ func TestRunConvertMode_TC00204(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expected error for invalid file, got nil")
 	}
+	if code := exitCode(err); code != exitInvalidPath {
+		t.Errorf("Expected exit code %d, got %d", exitInvalidPath, code)
+	}
 }
 
 // TestRunConvertMode_TC00301 tests TC-003-01: Directory batch conversion
@@ -324,9 +357,9 @@ func TestRunConvertMode_TC00303(t *testing.T) {
 
 	args := []string{tmpDir}
 	err = runConvertMode(args)
-	// Should not error, just return with message
-	if err != nil {
-		t.Fatalf("runConvertMode should not error for empty directory: %v", err)
+	// Nothing to convert is reported with its own exit code
+	if code := exitCode(err); code != exitNothingFound {
+		t.Fatalf("Expected exit code %d for empty directory, got %d (%v)", exitNothingFound, code, err)
 	}
 }
 
@@ -341,6 +374,9 @@ func TestRunConvertMode_TC00304(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expected error for nonexistent directory, got nil")
 	}
+	if code := exitCode(err); code != exitInvalidPath {
+		t.Errorf("Expected exit code %d, got %d", exitInvalidPath, code)
+	}
 }
 
 // TestRunConvertMode_TC00401 tests TC-004-01: No arguments (current directory with HEIC files)
@@ -409,9 +445,9 @@ func TestRunConvertMode_TC00402(t *testing.T) {
 
 	args := []string{}
 	err = runConvertMode(args)
-	// Should not error, just return with message
-	if err != nil {
-		t.Fatalf("runConvertMode should not error for empty directory: %v", err)
+	// Nothing to convert is reported with its own exit code
+	if code := exitCode(err); code != exitNothingFound {
+		t.Fatalf("Expected exit code %d for empty directory, got %d (%v)", exitNothingFound, code, err)
 	}
 }
 
@@ -487,6 +523,755 @@ func TestRunConvertMode_TC00602(t *testing.T) {
 	}
 }
 
+// TestRunConvertMode_StripTags tests removing only the GPS tags with
+// --strip-tags
+func TestRunConvertMode_StripTags(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	stripTags = []string{"gps"}
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	if err := runConvertMode([]string{heicFile}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	data, err := os.ReadFile(converter.GenerateOutputPath(heicFile))
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	tags, err := exif.ReadTags(data)
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+	var hasDate bool
+	for _, tag := range tags {
+		if tag.IFD == "IFD0/GPSInfo" {
+			t.Errorf("GPS tag %s should be removed", tag.Name)
+		}
+		if tag.Name == "DateTimeOriginal" {
+			hasDate = true
+		}
+	}
+	if !hasDate {
+		t.Error("DateTimeOriginal should be kept")
+	}
+
+	// --strip-tags contradicts --remove-exif, and unknown names are rejected
+	removeEXIF = true
+	if err := runConvertMode([]string{heicFile}); err == nil {
+		t.Error("Expected error for --remove-exif with --strip-tags")
+	}
+	removeEXIF = false
+	stripTags = []string{"location"}
+	if err := runConvertMode([]string{heicFile}); err == nil {
+		t.Error("Expected error for unknown tag group")
+	}
+}
+
+// TestRunConvertMode_Privacy tests converting with the publish privacy
+// profile, which keeps only the tags describing the pixels
+func TestRunConvertMode_Privacy(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	privacy = "publish"
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	if err := runConvertMode([]string{heicFile}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	_, tagNames, err := exif.CheckEXIFInJPEG(converter.GenerateOutputPath(heicFile))
+	if err != nil {
+		t.Fatalf("Failed to check EXIF: %v", err)
+	}
+	for _, name := range tagNames {
+		switch name {
+		case "Orientation", "ColorSpace", "PixelXDimension", "PixelYDimension", "ExifTag":
+		default:
+			t.Errorf("Tag %s should be removed by the publish profile", name)
+		}
+	}
+
+	// A profile cannot be combined with tag lists
+	stripTags = []string{"gps"}
+	if err := runConvertMode([]string{heicFile}); err == nil {
+		t.Error("Expected error for --privacy with --strip-tags")
+	}
+}
+
+// TestBuildConvertOptions tests --quality / --preset resolution and validation
+func TestBuildConvertOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		quality  int
+		preset   string
+		expected int
+		wantErr  bool
+	}{
+		{"Default", 0, "", 0, false},
+		{"Quality", 60, "", 60, false},
+		{"Preset", 0, "web", 75, false},
+		{"Quality out of range", 150, "", 0, true},
+		{"Negative quality", -1, "", 0, true},
+		{"Unknown preset", 0, "tiny", 0, true},
+		{"Quality and preset", 80, "archive", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			quality = tt.quality
+			preset = tt.preset
+
+			options, err := buildConvertOptions()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got options %+v", options)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildConvertOptions failed: %v", err)
+			}
+			if options.Quality != tt.expected {
+				t.Errorf("Quality = %d, want %d", options.Quality, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRunConvertMode_InvalidQuality verifies that an invalid --quality is
+// rejected before any file is converted.
+func TestRunConvertMode_InvalidQuality(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	quality = 0
+	preset = "unknown"
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	if err := runConvertMode([]string{heicFile}); err == nil {
+		t.Fatal("Expected error for unknown preset, got nil")
+	}
+
+	if _, err := os.Stat(converter.GenerateOutputPath(heicFile)); !os.IsNotExist(err) {
+		t.Error("Output file should not be created when options are invalid")
+	}
+}
+
+// TestRunConvertMode_Format verifies that --format selects the output encoder
+func TestRunConvertMode_Format(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	format = "png"
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	if err := runConvertMode([]string{heicFile}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.png")); err != nil {
+		t.Errorf("Expected PNG output file: %v", err)
+	}
+	if _, err := os.Stat(converter.GenerateOutputPath(heicFile)); !os.IsNotExist(err) {
+		t.Error("JPEG output should not be created when --format png is given")
+	}
+}
+
+// TestBuildConvertOptions_Format tests --format validation
+func TestBuildConvertOptions_Format(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		quality int
+		wantErr bool
+	}{
+		{"JPEG", "jpg", 0, false},
+		{"TIFF", "tiff", 0, false},
+		{"WebP unsupported", "webp", 0, true},
+		{"Unknown", "bmp", 0, true},
+		{"Quality with PNG", "png", 80, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			format = tt.format
+			quality = tt.quality
+
+			_, err := buildConvertOptions()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildConvertOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestRunConvertMode_OutputDir verifies that --output-dir mirrors the source
+// directory structure under the destination and leaves the source untouched.
+func TestRunConvertMode_OutputDir(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironmentWithMultipleFiles(t)
+	defer cleanup()
+
+	outDir, err := os.MkdirTemp("", "heic-cli-out-*")
+	if err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(outDir)
+	}()
+	outputDir = filepath.Join(outDir, "converted")
+
+	if err := runConvertMode([]string{tmpDir}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	for _, rel := range []string{"test.jpg", filepath.Join("subdir", "subtest.jpg")} {
+		if _, err := os.Stat(filepath.Join(outputDir, rel)); err != nil {
+			t.Errorf("Expected mirrored output %s: %v", rel, err)
+		}
+	}
+
+	jpegFiles, err := exif.FindJPEGFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to search source dir: %v", err)
+	}
+	if len(jpegFiles) != 0 {
+		t.Errorf("Expected no output in the source directory, found: %v", jpegFiles)
+	}
+}
+
+// TestRunConvertMode_OutputDirSingleFile verifies --output-dir for a single
+// file argument writes directly into the destination directory.
+func TestRunConvertMode_OutputDirSingleFile(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	outputDir = filepath.Join(tmpDir, "out")
+	if err := runConvertMode([]string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "test.jpg")); err != nil {
+		t.Errorf("Expected output in --output-dir: %v", err)
+	}
+}
+
+// TestRunConvertMode_NameTemplate verifies that --name-template renders the
+// output file name from EXIF fields.
+func TestRunConvertMode_NameTemplate(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	nameTmpl = "{date}_{time}_{model}"
+	if err := runConvertMode([]string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	expected := filepath.Join(tmpDir, "2025-10-06_151841_iPhone15Pro.jpg")
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Expected templated output %s: %v", expected, err)
+	}
+}
+
+// TestRunConvertMode_NameTemplateCollision verifies that inputs rendering
+// to the same name get numbered suffixes instead of overwriting each other.
+func TestRunConvertMode_NameTemplateCollision(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	sourceData, err := os.ReadFile(filepath.Join(tmpDir, "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "copy.HEIC"), sourceData, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	nameTmpl = "{model}"
+	if err := runConvertMode([]string{tmpDir}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	for _, name := range []string{"iPhone15Pro.jpg", "iPhone15Pro_1.jpg"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected output %s: %v", name, err)
+		}
+	}
+}
+
+// TestRunConvertMode_InvalidNameTemplate verifies that an invalid template is
+// rejected before any file is converted.
+func TestRunConvertMode_InvalidNameTemplate(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	nameTmpl = "{stem}_{camera}"
+	if err := runConvertMode([]string{tmpDir}); err == nil {
+		t.Error("Expected error for unknown placeholder")
+	}
+
+	jpegFiles, err := exif.FindJPEGFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to search dir: %v", err)
+	}
+	if len(jpegFiles) != 0 {
+		t.Errorf("Expected no output, found: %v", jpegFiles)
+	}
+}
+
+// TestResolveJobs tests --jobs validation
+func TestResolveJobs(t *testing.T) {
+	if n, err := resolveJobs(4); err != nil || n != 4 {
+		t.Errorf("resolveJobs(4) = %d, %v; want 4, nil", n, err)
+	}
+	if n, err := resolveJobs(0); err != nil || n != runtime.NumCPU() {
+		t.Errorf("resolveJobs(0) = %d, %v; want %d, nil", n, err, runtime.NumCPU())
+	}
+	if _, err := resolveJobs(-1); err == nil {
+		t.Error("Expected error for negative --jobs")
+	}
+}
+
+// TestRunConvertJobs_OrderedOutput verifies that output from concurrent jobs
+// is printed whole and in input order, and that results are counted.
+func TestRunConvertJobs_OrderedOutput(t *testing.T) {
+	jobs := make([]convertJob, 6)
+	for i := range jobs {
+		jobs[i].heicPath = fmt.Sprintf("file%d.HEIC", i)
+	}
+
+	// Later jobs finish first, and the jobs cycle through every status.
+	statuses := []convertStatus{statusConverted, statusSkipped, statusFailed}
+	convert := func(w io.Writer, job convertJob) fileRecord {
+		var i int
+		_, _ = fmt.Sscanf(job.heicPath, "file%d.HEIC", &i)
+		time.Sleep(time.Duration(len(jobs)-i) * 5 * time.Millisecond)
+		fmt.Fprintf(w, "start %s\n", job.heicPath)
+		fmt.Fprintf(w, "end %s\n", job.heicPath)
+		return fileRecord{Input: job.heicPath, Status: string(statuses[i%3])}
+	}
+
+	report, err := newReporter(os.Stdout, "convert")
+	if err != nil {
+		t.Fatalf("newReporter failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	summary := runConvertJobs(jobs, 4, convert, report, false)
+	if err := w.Close(); err != nil {
+		t.Logf("Failed to close pipe writer: %v", err)
+	}
+	os.Stdout = oldStdout
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		t.Logf("Failed to read from pipe: %v", err)
+	}
+
+	var expected strings.Builder
+	for _, job := range jobs {
+		fmt.Fprintf(&expected, "start %s\nend %s\n", job.heicPath, job.heicPath)
+	}
+	if buf.String() != expected.String() {
+		t.Errorf("Unexpected output order:\n%s", buf.String())
+	}
+	if summary != (batchSummary{succeeded: 2, skipped: 2, failed: 2}) {
+		t.Errorf("Summary = %+v, want 2 of each", summary)
+	}
+}
+
+// TestRunConvertJobs_FailFast verifies that --fail-fast cancels the jobs that
+// have not started when a conversion fails.
+func TestRunConvertJobs_FailFast(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	jobs := make([]convertJob, 5)
+	for i := range jobs {
+		jobs[i].heicPath = fmt.Sprintf("file%d.HEIC", i)
+	}
+
+	// The second job fails; with one worker, the rest have not started yet.
+	var calls int
+	convert := func(w io.Writer, job convertJob) fileRecord {
+		calls++
+		status := statusConverted
+		if job.heicPath == "file1.HEIC" {
+			status = statusFailed
+		}
+		return fileRecord{Input: job.heicPath, Status: string(status)}
+	}
+
+	reportFormat = "ndjson"
+	var out bytes.Buffer
+	report, err := newReporter(&out, "convert")
+	if err != nil {
+		t.Fatalf("newReporter failed: %v", err)
+	}
+
+	summary := runConvertJobs(jobs, 1, convert, report, true)
+	if calls != 2 {
+		t.Errorf("convert called %d times, want 2", calls)
+	}
+	if summary != (batchSummary{succeeded: 1, failed: 1, canceled: 3}) {
+		t.Errorf("Summary = %+v, want 1 converted, 1 failed, 3 canceled", summary)
+	}
+	if n := strings.Count(out.String(), `"status":"canceled"`); n != 3 {
+		t.Errorf("Expected 3 canceled records, got %d:\n%s", n, out.String())
+	}
+}
+
+// TestRunConvertMode_Jobs verifies that a parallel batch converts every file.
+func TestRunConvertMode_Jobs(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironmentWithMultipleFiles(t)
+	defer cleanup()
+
+	heicFiles, err := exif.FindHEICFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to search dir: %v", err)
+	}
+
+	jobCount = 3
+	if err := runConvertMode([]string{tmpDir}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	jpegFiles, err := exif.FindJPEGFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to search dir: %v", err)
+	}
+	if len(jpegFiles) != len(heicFiles) {
+		t.Errorf("Expected %d JPEG files, got %d: %v", len(heicFiles), len(jpegFiles), jpegFiles)
+	}
+}
+
+// TestRunConvertMode_OnConflict verifies each --on-conflict policy against
+// an existing, hand-edited output file.
+func TestRunConvertMode_OnConflict(t *testing.T) {
+	const edited = "hand-edited"
+
+	tests := []struct {
+		policy       string
+		keepExisting bool
+		renamed      bool
+	}{
+		{"skip", true, false},
+		{"overwrite", false, false},
+		{"rename", true, true},
+		{"newer", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			tmpDir, cleanup := setupTestEnvironment(t)
+			defer cleanup()
+
+			heicFile := filepath.Join(tmpDir, "test.HEIC")
+			existing := converter.GenerateOutputPath(heicFile)
+			if err := os.WriteFile(existing, []byte(edited), 0644); err != nil {
+				t.Fatalf("Failed to write existing output: %v", err)
+			}
+			// The existing output is newer than the source.
+			past := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(heicFile, past, past); err != nil {
+				t.Fatalf("Failed to set source mtime: %v", err)
+			}
+
+			onConflict = tt.policy
+			if err := runConvertMode([]string{heicFile}); err != nil {
+				t.Fatalf("runConvertMode failed: %v", err)
+			}
+
+			data, err := os.ReadFile(existing)
+			if err != nil {
+				t.Fatalf("Failed to read existing output: %v", err)
+			}
+			if kept := string(data) == edited; kept != tt.keepExisting {
+				t.Errorf("Existing output kept = %v, want %v", kept, tt.keepExisting)
+			}
+
+			_, err = os.Stat(filepath.Join(tmpDir, "test_1.jpg"))
+			if renamed := err == nil; renamed != tt.renamed {
+				t.Errorf("Renamed output exists = %v, want %v", renamed, tt.renamed)
+			}
+		})
+	}
+}
+
+// TestRunConvertMode_OnConflictNewerSource verifies that --on-conflict=newer
+// reconverts when the source is newer than the existing output.
+func TestRunConvertMode_OnConflictNewerSource(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	existing := converter.GenerateOutputPath(heicFile)
+	if err := os.WriteFile(existing, []byte("stale"), 0644); err != nil {
+		t.Fatalf("Failed to write existing output: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(existing, past, past); err != nil {
+		t.Fatalf("Failed to set output mtime: %v", err)
+	}
+
+	onConflict = "newer"
+	if err := runConvertMode([]string{heicFile}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	if data, err := os.ReadFile(existing); err != nil || string(data) == "stale" {
+		t.Errorf("Expected stale output to be replaced (err: %v)", err)
+	}
+}
+
+// TestBuildConvertOptions_OnConflict tests --on-conflict validation
+func TestBuildConvertOptions_OnConflict(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	onConflict = "RENAME"
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	if options.OnConflict != converter.ConflictRename {
+		t.Errorf("OnConflict = %q, want %q", options.OnConflict, converter.ConflictRename)
+	}
+
+	onConflict = "replace"
+	if _, err := buildConvertOptions(); err == nil {
+		t.Error("Expected error for unknown --on-conflict value")
+	}
+}
+
+// TestRunConvertMode_AutoOrient verifies that --auto-orient writes upright
+// pixels for the sample photo, even with --remove-exif.
+func TestRunConvertMode_AutoOrient(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	autoOrient = true
+	removeEXIF = true
+	if err := runConvertMode([]string{heicFile}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	outputFile, err := os.Open(converter.GenerateOutputPath(heicFile))
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer func() {
+		_ = outputFile.Close()
+	}()
+	config, err := jpeg.DecodeConfig(outputFile)
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if config.Height <= config.Width {
+		t.Errorf("Expected portrait output, got %dx%d", config.Width, config.Height)
+	}
+}
+
+// TestConvertFile_ExportAux tests that exported auxiliary images are
+// written and reported
+func TestConvertFile_ExportAux(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	exportAux = true
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+
+	var buf bytes.Buffer
+	rec := convertFile(&buf, convertJob{heicPath: heicFile, options: options}, false)
+	if rec.Status != string(statusConverted) {
+		t.Fatalf("convertFile status = %v, output:\n%s", rec.Status, buf.String())
+	}
+
+	auxPath := filepath.Join(tmpDir, "test_gainmap.png")
+	if _, err := os.Stat(auxPath); err != nil {
+		t.Errorf("Expected exported gain map: %v", err)
+	}
+	if !strings.Contains(buf.String(), "補助画像: "+auxPath) {
+		t.Errorf("Expected the exported path in the output, got:\n%s", buf.String())
+	}
+	if len(rec.AuxOutputs) != 1 || rec.AuxOutputs[0] != auxPath {
+		t.Errorf("Expected the exported path in the record, got %v", rec.AuxOutputs)
+	}
+}
+
+// TestConvertFile_ShowEXIF tests that --show-exif renders the tags as text
+// only for text output, and records them either way
+func TestConvertFile_ShowEXIF(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	showEXIF = true
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+
+	for _, structured := range []bool{false, true} {
+		var buf bytes.Buffer
+		rec := convertFile(&buf, convertJob{heicPath: heicFile, options: options}, structured)
+		if rec.Status != string(statusConverted) {
+			t.Fatalf("convertFile status = %v, output:\n%s", rec.Status, buf.String())
+		}
+		if len(rec.Tags) == 0 {
+			t.Errorf("structured=%v: expected the tags in the record", structured)
+		}
+		if got := strings.Contains(buf.String(), "=== EXIF情報: test.HEIC ==="); got == structured {
+			t.Errorf("structured=%v: text EXIF rendered = %v, output:\n%s", structured, got, buf.String())
+		}
+	}
+}
+
+// TestBuildConvertOptions_Resize tests mapping and validating the resize
+// flags
+func TestBuildConvertOptions_Resize(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	maxWidth = 2048
+	maxPixels = 4000000
+	scale = 0.5
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	expected := converter.ResizeOptions{MaxWidth: 2048, MaxPixels: 4000000, Scale: 0.5}
+	if options.Resize != expected {
+		t.Errorf("Resize = %+v, want %+v", options.Resize, expected)
+	}
+
+	scale = 2
+	if _, err := buildConvertOptions(); err == nil {
+		t.Error("Expected error for --scale greater than 1")
+	}
+
+	scale = 0
+	maxHeight = -1
+	if _, err := buildConvertOptions(); err == nil {
+		t.Error("Expected error for negative --max-height")
+	}
+}
+
+func TestBuildConvertOptions_ColorSpace(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	if options.ColorSpace != converter.ColorSpacePreserve {
+		t.Errorf("ColorSpace = %q, want %q by default", options.ColorSpace, converter.ColorSpacePreserve)
+	}
+
+	colorSpace = "SRGB"
+	options, err = buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	if options.ColorSpace != converter.ColorSpaceSRGB {
+		t.Errorf("ColorSpace = %q, want %q", options.ColorSpace, converter.ColorSpaceSRGB)
+	}
+
+	colorSpace = "adobe-rgb"
+	if _, err := buildConvertOptions(); err == nil {
+		t.Error("Expected error for unknown --colorspace")
+	}
+}
+
+func TestBuildConvertOptions_Background(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	options, err := buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	if options.Background != converter.DefaultBackground {
+		t.Errorf("Background = %v, want %v by default", options.Background, converter.DefaultBackground)
+	}
+
+	background = "#000080"
+	options, err = buildConvertOptions()
+	if err != nil {
+		t.Fatalf("buildConvertOptions failed: %v", err)
+	}
+	if expected := (color.RGBA{B: 0x80, A: 0xFF}); options.Background != expected {
+		t.Errorf("Background = %v, want %v", options.Background, expected)
+	}
+
+	background = "transparent"
+	if _, err := buildConvertOptions(); err == nil {
+		t.Error("Expected error for invalid --background")
+	}
+}
+
 // TestRunCheckEXIF_TC00801 tests TC-008-01: Check EXIF for single file (EXIF remains)
 func TestRunCheckEXIF_TC00801(t *testing.T) {
 	resetFlags()
@@ -647,9 +1432,9 @@ func TestRunCheckEXIF_TC00805(t *testing.T) {
 
 	args := []string{tmpDir}
 	err = runCheckEXIF(args)
-	// Should not error for empty directory
-	if err != nil {
-		t.Fatalf("runCheckEXIF should not error for empty directory: %v", err)
+	// Nothing to check is reported with its own exit code
+	if code := exitCode(err); code != exitNothingFound {
+		t.Fatalf("Expected exit code %d for empty directory, got %d (%v)", exitNothingFound, code, err)
 	}
 }
 
@@ -664,9 +1449,9 @@ func TestRunCheckEXIF_TC00806(t *testing.T) {
 	args := []string{"nonexistent.jpg"}
 	err := runCheckEXIF(args)
 
-	// A warning is printed and processing continues, so no error is returned
-	if err != nil {
-		t.Fatalf("Expected no error for nonexistent file (warning + continue), got: %v", err)
+	// The same exit code as the other modes is used for a missing path
+	if code := exitCode(err); code != exitInvalidPath {
+		t.Fatalf("Expected exit code %d for nonexistent file, got %d (%v)", exitInvalidPath, code, err)
 	}
 }
 
@@ -845,8 +1630,12 @@ func TestRunConvertMode_TC00905(t *testing.T) {
 	}
 
 	args := []string{tmpDir}
-	_ = runConvertMode(args)
-	// Function should handle errors gracefully and continue
+	err = runConvertMode(args)
+	// Function should handle errors gracefully and continue, reporting the
+	// partial failure in the exit code
+	if code := exitCode(err); code != exitPartialFailure {
+		t.Errorf("Expected exit code %d for a partial failure, got %d (%v)", exitPartialFailure, code, err)
+	}
 
 	// At least one file should be processed
 	heicFiles, _ := exif.FindHEICFiles(tmpDir)
@@ -889,7 +1678,7 @@ func TestRunConvertMode_TC00205(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	_ = runConvertMode(args)
+	err = runConvertMode(args)
 	if err := w.Close(); err != nil {
 		t.Logf("Failed to close pipe writer: %v", err)
 	}
@@ -901,7 +1690,12 @@ func TestRunConvertMode_TC00205(t *testing.T) {
 	}
 	output := buf.String()
 
-	// runConvertMode may not return error, but should display error message
+	// Every file failed
+	if code := exitCode(err); code != exitTotalFailure {
+		t.Errorf("Expected exit code %d, got %d (%v)", exitTotalFailure, code, err)
+	}
+
+	// The error message is displayed per file
 	// Check that error message is displayed
 	if !strings.Contains(output, "変換失敗") && !strings.Contains(output, "失敗") {
 		t.Errorf("Expected error message in output, got: %s", output)
@@ -1751,3 +2545,94 @@ func TestRunUninstall_HomeDirError(t *testing.T) {
 	t.Log("Note: os.UserHomeDir() error path exists in runUninstall() but cannot be easily tested without mocking")
 }
 
+// setupLivePhotoEnvironment adds a companion video next to test.HEIC
+func setupLivePhotoEnvironment(t *testing.T) (string, func()) {
+	t.Helper()
+	tmpDir, cleanup := setupTestEnvironment(t)
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.MOV"), []byte("video"), 0644); err != nil {
+		cleanup()
+		t.Fatalf("Failed to write video file: %v", err)
+	}
+	return tmpDir, cleanup
+}
+
+func TestRunConvertMode_LivePhotoCopy(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupLivePhotoEnvironment(t)
+	defer cleanup()
+
+	livePhoto = "copy"
+	outputDir = filepath.Join(tmpDir, "out")
+	if err := runConvertMode([]string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "test.jpg")); err != nil {
+		t.Errorf("Expected converted image: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "test.MOV"))
+	if err != nil || string(data) != "video" {
+		t.Errorf("Expected the video to be copied next to the output: %q, %v", data, err)
+	}
+}
+
+func TestRunConvertMode_LivePhotoSkip(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupLivePhotoEnvironment(t)
+	defer cleanup()
+
+	livePhoto = "skip"
+	if err := runConvertMode([]string{tmpDir}); err != nil {
+		t.Fatalf("runConvertMode failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected the Live Photo not to be converted")
+	}
+}
+
+func TestRunConvertMode_LivePhotoInvalid(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	livePhoto = "move"
+	if err := runConvertMode([]string{"."}); err == nil {
+		t.Error("Expected an error for an unknown --live-photo value")
+	}
+}
+
+// TestRunShowEXIF_Format tests dumping every EXIF tag with --show-exif
+// --format
+func TestRunShowEXIF_Format(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	format = "csv"
+	out, err := captureStdout(t, func() error {
+		return runShowEXIF([]string{tmpDir})
+	})
+	if err != nil {
+		t.Fatalf("runShowEXIF failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if lines[0] != "file,ifd,id,name,type,value,raw" || len(lines) < 20 {
+		t.Errorf("Expected a CSV row for every tag, got:\n%s", out)
+	}
+
+	format = "png"
+	if err := runShowEXIF([]string{tmpDir}); err == nil {
+		t.Error("Expected an error for an image format with --show-exif")
+	}
+
+	format = "json"
+	reportFormat = "json"
+	if err := runShowEXIF([]string{tmpDir}); err == nil {
+		t.Error("Expected an error for --format combined with --output")
+	}
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+var (
+	scrubPrivacy   string
+	scrubStripTags []string
+	scrubKeepTags  []string
+)
+
+// scrubCmd removes EXIF tags from existing JPEG files
+var scrubCmd = &cobra.Command{
+	Use:   "scrub [ファイル/ディレクトリ]",
+	Short: "既存のJPEGファイルからEXIFタグを削除する",
+	Long: `既存のJPEGファイルから、プライバシープロファイル（--privacy）または
+タグの指定（--strip-tags / --keep-tags）に従ってEXIFタグを削除します。
+ファイルは上書きされます。削除するタグがないファイルは変更しません。`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScrub(cmd.OutOrStdout(), args)
+	},
+}
+
+func init() {
+	scrubCmd.Flags().StringVar(&scrubPrivacy, "privacy", "", fmt.Sprintf("プライバシープロファイルを指定します（%s）", privacyProfileHelp()))
+	scrubCmd.Flags().StringSliceVar(&scrubStripTags, "strip-tags", nil, fmt.Sprintf("削除するEXIFタグを指定します（グループ: %s、タグ名、またはタグID（例: 0x010f）。カンマ区切り）", strings.Join(exif.TagGroups(), ", ")))
+	scrubCmd.Flags().StringSliceVar(&scrubKeepTags, "keep-tags", nil, "残すEXIFタグを指定します（--strip-tags と同じグループ・タグ名・タグID。カンマ区切り）")
+	rootCmd.AddCommand(scrubCmd)
+}
+
+func runScrub(w io.Writer, args []string) error {
+	if scrubPrivacy == "" && len(scrubStripTags) == 0 && len(scrubKeepTags) == 0 {
+		return fmt.Errorf("--privacy、--strip-tags、--keep-tags のいずれかを指定してください")
+	}
+	filter, err := buildTagFilter(scrubPrivacy, scrubStripTags, scrubKeepTags)
+	if err != nil {
+		return err
+	}
+
+	report, err := newReporter(w, "scrub")
+	if err != nil {
+		return err
+	}
+
+	targetPath := resolveTargetPath(args)
+
+	// パスの存在確認
+	info, err := statTargetPath(targetPath)
+	if err != nil {
+		return err
+	}
+
+	jpegFiles, err := findFilesByType(targetPath, info, exif.IsJPEGFile, exif.FindJPEGFiles, "JPEG")
+	if err != nil {
+		return err
+	}
+
+	if len(jpegFiles) == 0 {
+		return report.nothingFound("JPEG")
+	}
+
+	text := report.text(w)
+
+	var scrubbedCount, unchangedCount, errorCount int
+	for _, jpegPath := range jpegFiles {
+		start := time.Now()
+		rec := fileRecord{Input: jpegPath}
+		removed, err := exif.FilterEXIFInJPEG(jpegPath, filter)
+		switch {
+		case err != nil:
+			fmt.Fprintf(text, "✗ 削除失敗: %s - %v\n", jpegPath, err)
+			errorCount++
+			rec.Status, rec.Error = "failed", err.Error()
+		case len(removed) == 0:
+			fmt.Fprintf(text, "- 変更なし: %s\n", jpegPath)
+			unchangedCount++
+			rec.Status = "unchanged"
+		default:
+			names := make([]string, 0, len(removed))
+			for _, tag := range removed {
+				names = append(names, tag.Name)
+			}
+			fmt.Fprintf(text, "✓ %s: %d個のタグを削除しました（%s）\n", jpegPath, len(removed), strings.Join(names, ", "))
+			scrubbedCount++
+			rec.Status, rec.TagNames = "scrubbed", names
+		}
+		rec.DurationMS = durationMS(start)
+		report.file(rec)
+	}
+
+	// サマリー表示
+	if report.structured() {
+		report.finish()
+	} else if len(jpegFiles) > 1 {
+		fmt.Fprintf(w, "\n=== 削除結果 ===\n")
+		fmt.Fprintf(w, "総ファイル数: %d\n", len(jpegFiles))
+		fmt.Fprintf(w, "タグを削除: %d\n", scrubbedCount)
+		fmt.Fprintf(w, "変更なし: %d\n", unchangedCount)
+		fmt.Fprintf(w, "削除失敗: %d\n", errorCount)
+	}
+
+	return batchError(errorCount, scrubbedCount+unchangedCount, "%d件のファイルからタグを削除できませんでした", errorCount)
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// resetScrubFlags restores the scrub subcommand's flags to their defaults
+func resetScrubFlags() {
+	scrubPrivacy = ""
+	scrubStripTags = nil
+	scrubKeepTags = nil
+}
+
+// setupScrubEnvironment converts the test HEIC file to a JPEG carrying its
+// EXIF data and returns the JPEG's path.
+func setupScrubEnvironment(t *testing.T) (string, func()) {
+	t.Helper()
+	tmpDir, cleanup := setupTestEnvironment(t)
+
+	heicFile := filepath.Join(tmpDir, "test.HEIC")
+	if err := converter.ConvertHEICToJPEG(heicFile, converter.ConvertOptions{}); err != nil {
+		cleanup()
+		t.Fatalf("Failed to convert HEIC: %v", err)
+	}
+	return converter.GenerateOutputPath(heicFile), cleanup
+}
+
+func TestRunScrub_Privacy(t *testing.T) {
+	resetScrubFlags()
+	defer resetScrubFlags()
+
+	jpegFile, cleanup := setupScrubEnvironment(t)
+	defer cleanup()
+
+	scrubPrivacy = "share"
+	var buf bytes.Buffer
+	if err := runScrub(&buf, []string{jpegFile}); err != nil {
+		t.Fatalf("runScrub failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "GPSLatitude") {
+		t.Errorf("Expected the removed tags to be listed, got:\n%s", buf.String())
+	}
+
+	_, tagNames, err := exif.CheckEXIFInJPEG(jpegFile)
+	if err != nil {
+		t.Fatalf("Failed to check EXIF: %v", err)
+	}
+	for _, name := range tagNames {
+		if strings.HasPrefix(name, "GPS") || name == "MakerNote" {
+			t.Errorf("Tag %s should be removed by the share profile", name)
+		}
+	}
+
+	// A second run finds nothing left to remove.
+	buf.Reset()
+	if err := runScrub(&buf, []string{jpegFile}); err != nil {
+		t.Fatalf("runScrub failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "- 変更なし: ") {
+		t.Errorf("Expected the file to be unchanged, got:\n%s", buf.String())
+	}
+}
+
+func TestRunScrub_Output(t *testing.T) {
+	resetScrubFlags()
+	defer resetScrubFlags()
+	defer resetFlags()
+
+	jpegFile, cleanup := setupScrubEnvironment(t)
+	defer cleanup()
+
+	scrubStripTags = []string{"gps"}
+	reportFormat = "json"
+	var buf bytes.Buffer
+	if err := runScrub(&buf, []string{filepath.Dir(jpegFile)}); err != nil {
+		t.Fatalf("runScrub failed: %v", err)
+	}
+
+	var doc struct {
+		Files []fileRecord `json:"files"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Status != "scrubbed" || len(doc.Files[0].TagNames) == 0 {
+		t.Errorf("Unexpected records: %+v", doc.Files)
+	}
+}
+
+func TestRunScrub_InvalidFlags(t *testing.T) {
+	resetScrubFlags()
+	defer resetScrubFlags()
+
+	if err := runScrub(&bytes.Buffer{}, []string{"."}); err == nil {
+		t.Error("Expected an error without --privacy, --strip-tags or --keep-tags")
+	}
+
+	scrubPrivacy = "secret"
+	if err := runScrub(&bytes.Buffer{}, []string{"."}); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+
+	scrubPrivacy = "share"
+	scrubStripTags = []string{"gps"}
+	if err := runScrub(&bytes.Buffer{}, []string{"."}); err == nil {
+		t.Error("Expected an error for --privacy with --strip-tags")
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+var (
+	thumbSize       int
+	thumbFormat     string
+	thumbAutoOrient bool
+)
+
+// thumbnailCmd writes the thumbnails embedded in HEIC files
+var thumbnailCmd = &cobra.Command{
+	Use:   "thumbnail [ファイル/ディレクトリ]",
+	Short: "HEICファイルに埋め込まれたサムネイルを書き出す",
+	Long: `HEICファイルに埋め込まれたサムネイル画像を <名前>_thumb.jpg として書き出します。
+元の解像度の画像をデコードしないため、通常の変換より高速です。
+サムネイルが埋め込まれていないファイルは、画像をデコードして縮小します。`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runThumbnail(cmd.OutOrStdout(), args)
+	},
+}
+
+func init() {
+	thumbnailCmd.Flags().IntVar(&thumbSize, "size", 0, fmt.Sprintf("サムネイルの長辺の最大サイズ（ピクセル）を指定します（0: 埋め込みサムネイルはそのまま、縮小時は%d）", converter.DefaultThumbnailSize))
+	thumbnailCmd.Flags().StringVar(&thumbFormat, "format", string(converter.FormatJPEG), "出力形式を指定します（jpeg, png, tiff）")
+	thumbnailCmd.Flags().BoolVar(&thumbAutoOrient, "auto-orient", false, "画像の向きの情報に従ってピクセルを回転・反転して出力します")
+	rootCmd.AddCommand(thumbnailCmd)
+}
+
+func runThumbnail(w io.Writer, args []string) error {
+	if thumbSize < 0 {
+		return fmt.Errorf("--size には0以上の値を指定してください: %d", thumbSize)
+	}
+	outputFormat, err := converter.ParseFormat(thumbFormat)
+	if err != nil {
+		return err
+	}
+	options := converter.ConvertOptions{
+		Format:     outputFormat,
+		AutoOrient: thumbAutoOrient,
+		Resize:     converter.ResizeOptions{MaxWidth: thumbSize, MaxHeight: thumbSize},
+	}
+
+	report, err := newReporter(w, "thumbnail")
+	if err != nil {
+		return err
+	}
+
+	targetPath := resolveTargetPath(args)
+
+	// パスの存在確認
+	info, err := statTargetPath(targetPath)
+	if err != nil {
+		return err
+	}
+
+	heicFiles, err := findFilesByType(targetPath, info, exif.IsHEICFile, exif.FindHEICFiles, "HEIC")
+	if err != nil {
+		return err
+	}
+
+	if len(heicFiles) == 0 {
+		return report.nothingFound("HEIC")
+	}
+
+	text := report.text(w)
+
+	var errorCount int
+	for _, heicPath := range heicFiles {
+		start := time.Now()
+		rec := fileRecord{Input: heicPath}
+		result, embedded, err := converter.ConvertThumbnail(heicPath, options)
+		if err != nil {
+			fmt.Fprintf(text, "✗ 書き出し失敗: %s - %v\n", heicPath, err)
+			errorCount++
+			rec.Status, rec.Error, rec.DurationMS = "failed", err.Error(), durationMS(start)
+			report.file(rec)
+			continue
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(text, "警告: %s - %s\n", result.OutputPath, warning)
+		}
+		if embedded {
+			fmt.Fprintf(text, "✓ サムネイル: %s -> %s\n", heicPath, result.OutputPath)
+			rec.Status = "extracted"
+		} else {
+			fmt.Fprintf(text, "✓ サムネイル（埋め込みなし、縮小して生成）: %s -> %s\n", heicPath, result.OutputPath)
+			rec.Status = "generated"
+		}
+		rec.Output, rec.Warnings = result.OutputPath, result.Warnings
+		if info, err := os.Stat(result.OutputPath); err == nil {
+			rec.Bytes = info.Size()
+		}
+		rec.DurationMS = durationMS(start)
+		report.file(rec)
+	}
+
+	// サマリー表示
+	if report.structured() {
+		report.finish()
+	} else if len(heicFiles) > 1 {
+		fmt.Fprintf(w, "\n=== 書き出し結果 ===\n")
+		fmt.Fprintf(w, "書き出し成功: %d\n", len(heicFiles)-errorCount)
+		fmt.Fprintf(w, "書き出し失敗: %d\n", errorCount)
+	}
+
+	return batchError(errorCount, len(heicFiles)-errorCount, "%d件のサムネイルの書き出しに失敗しました", errorCount)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetThumbnailFlags restores the thumbnail subcommand's flags to their
+// defaults
+func resetThumbnailFlags() {
+	thumbSize = 0
+	thumbFormat = ""
+	thumbAutoOrient = false
+}
+
+func TestRunThumbnail(t *testing.T) {
+	resetThumbnailFlags()
+	defer resetThumbnailFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	if err := runThumbnail(&buf, []string{filepath.Join(tmpDir, "test.HEIC")}); err != nil {
+		t.Fatalf("runThumbnail failed: %v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "test_thumb.jpg")
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Fatalf("Expected thumbnail %s: %v", outputPath, err)
+	}
+	if !strings.Contains(buf.String(), "✓ サムネイル: ") {
+		t.Errorf("Expected the embedded thumbnail to be reported, got:\n%s", buf.String())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected no full-size conversion")
+	}
+}
+
+func TestRunThumbnail_SizeAndFormat(t *testing.T) {
+	resetThumbnailFlags()
+	defer resetThumbnailFlags()
+
+	tmpDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	thumbSize = 100
+	thumbFormat = "png"
+	var buf bytes.Buffer
+	if err := runThumbnail(&buf, []string{tmpDir}); err != nil {
+		t.Fatalf("runThumbnail failed: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(tmpDir, "test_thumb.png"))
+	if err != nil {
+		t.Fatalf("Failed to open thumbnail: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	config, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Thumbnail is not a valid PNG: %v", err)
+	}
+	if config.Width != 100 || config.Height != 75 {
+		t.Errorf("Thumbnail is %dx%d, want 100x75", config.Width, config.Height)
+	}
+}
+
+func TestRunThumbnail_InvalidFlags(t *testing.T) {
+	resetThumbnailFlags()
+	defer resetThumbnailFlags()
+
+	thumbSize = -1
+	if err := runThumbnail(&bytes.Buffer{}, []string{"."}); err == nil {
+		t.Error("Expected an error for a negative --size")
+	}
+
+	thumbSize = 0
+	thumbFormat = "gif"
+	if err := runThumbnail(&bytes.Buffer{}, []string{"."}); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,338 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrium/goheif/heif"
+	"github.com/adrium/goheif/heif/bmff"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/fileutil"
+	xdraw "golang.org/x/image/draw"
+)
+
+// alphaAuxiliaryTypes are the auxC aux_type URNs that identify an alpha
+// plane (ISO/IEC 23008-12 and its predecessor).
+var alphaAuxiliaryTypes = map[string]bool{
+	"urn:mpeg:mpegB:cicp:systems:auxiliary:alpha": true,
+	"urn:mpeg:hevc:2015:auxid:1":                  true,
+}
+
+// auxiliarySuffixes maps the aux_type URNs of known auxiliary images to the
+// file name suffix they are exported with by ConvertOptions.ExportAux.
+var auxiliarySuffixes = map[string]string{
+	"urn:mpeg:hevc:2015:auxid:2":                        "_depth",
+	"urn:mpeg:mpegB:cicp:systems:auxiliary:depth":       "_depth",
+	"urn:com:apple:photo:2018:aux:portraiteffectsmatte": "_matte",
+	"urn:com:apple:photo:2019:aux:semanticskinmatte":    "_skin",
+	"urn:com:apple:photo:2019:aux:semantichairmatte":    "_hair",
+	"urn:com:apple:photo:2019:aux:semanticteethmatte":   "_teeth",
+	"urn:com:apple:photo:2020:aux:semanticglassesmatte": "_glasses",
+	"urn:com:apple:photo:2020:aux:hdrgainmap":           "_gainmap",
+}
+
+// unknownAuxiliarySuffix is the suffix for auxiliary images of other types.
+const unknownAuxiliarySuffix = "_aux"
+
+// auxiliaryImage is an auxiliary image (alpha plane, depth map, HDR gain
+// map, ...) attached to an image through an auxl reference.
+type auxiliaryImage struct {
+	item *heif.Item
+	// auxType is the aux_type URN from the item's auxC property.
+	auxType string
+}
+
+// heifItemIDs returns the IDs of all items in the HEIF file in ra, in the
+// order they are listed in its iinf box. goheif only looks items up by ID,
+// so the meta box is walked directly.
+func heifItemIDs(ra io.ReaderAt) ([]uint32, error) {
+	const assumedMaxSize = 5 << 40 // as in goheif
+	r := bmff.NewReader(io.NewSectionReader(ra, 0, assumedMaxSize))
+	if _, err := r.ReadAndParseBox(bmff.TypeFtyp); err != nil {
+		return nil, err
+	}
+	box, err := r.ReadAndParseBox(bmff.TypeMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, child := range box.(*bmff.MetaBox).Children {
+		if !child.Type().EqualString("iinf") {
+			continue
+		}
+		parsed, err := child.Parse()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range parsed.(*bmff.ItemInfoBox).ItemInfos {
+			ids = append(ids, uint32(entry.ItemID))
+		}
+	}
+	return ids, nil
+}
+
+// auxiliaryImages returns the auxiliary images of the image item primary.
+func auxiliaryImages(ra io.ReaderAt, hf *heif.File, primary *heif.Item) ([]auxiliaryImage, error) {
+	ids, err := heifItemIDs(ra)
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+
+	var aux []auxiliaryImage
+	for _, id := range ids {
+		item, err := hf.ItemByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+		}
+		ref := item.Reference("auxl")
+		if ref == nil || !containsItemID(ref.ToItemIDs, primary.ID) {
+			continue
+		}
+		aux = append(aux, auxiliaryImage{item: item, auxType: auxiliaryType(item)})
+	}
+	return aux, nil
+}
+
+// auxiliaryType returns the aux_type URN of the item's auxC property, or ""
+// if it has none. auxC is a full box whose body is a null-terminated URN
+// optionally followed by type-specific data.
+func auxiliaryType(item *heif.Item) string {
+	body, ok := rawProperty(item, "auxC")
+	if !ok || len(body) < 4 {
+		return ""
+	}
+	urn := body[4:]
+	if i := bytes.IndexByte(urn, 0); i >= 0 {
+		urn = urn[:i]
+	}
+	return string(urn)
+}
+
+// rawProperty returns the body of the item's first property of boxType
+// that goheif does not parse itself.
+func rawProperty(item *heif.Item, boxType string) ([]byte, bool) {
+	for _, p := range item.Properties {
+		if !p.Type().EqualString(boxType) {
+			continue
+		}
+		raw, ok := p.(interface{ Body() io.Reader })
+		if !ok {
+			continue
+		}
+		body, err := io.ReadAll(raw.Body())
+		if err != nil {
+			return nil, false
+		}
+		return body, true
+	}
+	return nil, false
+}
+
+// isOpaque reports whether every value of the alpha plane is 255.
+// (image.Gray.Opaque always reports true, as gray has no alpha channel.)
+func isOpaque(alpha *image.Gray) bool {
+	for y := 0; y < alpha.Rect.Dy(); y++ {
+		for _, v := range alpha.Pix[y*alpha.Stride : y*alpha.Stride+alpha.Rect.Dx()] {
+			if v != 0xFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsItemID(ids []uint32, id uint32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeLuma decodes the luma plane of an hvc1 or grid item, which holds
+// the values of single-channel auxiliary images. Limited-range values, as
+// signalled by an nclx colr property, are expanded to the full 0-255 range.
+func decodeLuma(hf *heif.File, item *heif.Item) (*image.Gray, error) {
+	img, err := decodeImageItem(hf, item)
+	if err != nil {
+		return nil, err
+	}
+
+	var out *image.Gray
+	switch img := img.(type) {
+	case *image.Gray:
+		out = img
+	case *image.YCbCr:
+		out = &image.Gray{Pix: img.Y, Stride: img.YStride, Rect: img.Rect}
+	default:
+		return nil, fmt.Errorf("デコード結果が想定外の形式です: %T", img)
+	}
+
+	if isLimitedRange(item) {
+		for i, v := range out.Pix {
+			out.Pix[i] = uint8(min(max((int(v)-16)*255/219, 0), 255))
+		}
+	}
+	return out, nil
+}
+
+// isLimitedRange reports whether the item's nclx colr property marks its
+// samples as limited (video) range.
+func isLimitedRange(item *heif.Item) bool {
+	body, ok := rawProperty(item, "colr")
+	// nclx: colour_type, primaries, transfer, matrix, then full_range_flag
+	// in the top bit.
+	if !ok || len(body) < 11 || string(body[:4]) != "nclx" {
+		return false
+	}
+	return body[10]&0x80 == 0
+}
+
+// readAuxiliaryPlane decodes the first auxiliary image of the image item
+// itemID (0 for the primary image) in ra whose aux_type satisfies match. It
+// returns nil if there is none. premultiplied reports whether the image
+// references the plane through a prem reference, i.e. its colors are
+// premultiplied by it.
+func readAuxiliaryPlane(ra io.ReaderAt, itemID uint32, match func(auxType string) bool) (plane *image.Gray, premultiplied bool, err error) {
+	hf := heif.Open(ra)
+	primary, err := imageItem(hf, itemID)
+	if err != nil {
+		return nil, false, err
+	}
+	aux, err := auxiliaryImages(ra, hf, primary)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, a := range aux {
+		if !match(a.auxType) {
+			continue
+		}
+		plane, err := decodeLuma(hf, a.item)
+		if err != nil {
+			return nil, false, fmt.Errorf("補助画像のデコードに失敗しました: %w", err)
+		}
+		prem := primary.Reference("prem")
+		return plane, prem != nil && containsItemID(prem.ToItemIDs, a.item.ID), nil
+	}
+	return nil, false, nil
+}
+
+// readAlpha decodes the alpha plane of the image item itemID (0 for the
+// primary image) in ra, or returns nil if the image has none.
+func readAlpha(ra io.ReaderAt, itemID uint32) (alpha *image.Gray, premultiplied bool, err error) {
+	return readAuxiliaryPlane(ra, itemID, func(auxType string) bool {
+		return alphaAuxiliaryTypes[auxType]
+	})
+}
+
+// attachAlpha returns img with alpha as its alpha channel, as an
+// *image.NRGBA. The alpha plane is scaled to the size of img if needed, and
+// premultiplied colors are converted to straight alpha. img is returned
+// unchanged if alpha is fully opaque, so that opaque images keep the fast
+// YCbCr encoding paths.
+func attachAlpha(img image.Image, alpha *image.Gray, premultiplied bool) image.Image {
+	if isOpaque(alpha) {
+		return img
+	}
+
+	bounds := img.Bounds()
+	rect := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	if alpha.Rect.Size() != rect.Size() {
+		scaled := image.NewGray(rect)
+		xdraw.CatmullRom.Scale(scaled, rect, alpha, alpha.Rect, xdraw.Src, nil)
+		alpha = scaled
+	}
+
+	// The opaque source drawn onto *image.RGBA (which has a fast path for
+	// *image.YCbCr) has the same bytes as the equivalent *image.NRGBA.
+	rgba := image.NewRGBA(rect)
+	xdraw.Draw(rgba, rect, img, bounds.Min, xdraw.Src)
+	dst := &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rect}
+
+	for y := 0; y < rect.Dy(); y++ {
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < rect.Dx(); x++ {
+			a := alpha.Pix[y*alpha.Stride+x]
+			px := row[4*x : 4*x+4]
+			if premultiplied && a != 0 && a != 0xFF {
+				px[0], px[1], px[2] = unpremultiply(px[0], a), unpremultiply(px[1], a), unpremultiply(px[2], a)
+			}
+			px[3] = a
+		}
+	}
+	return dst
+}
+
+// auxiliarySuffix returns the file name suffix for an auxiliary image of
+// auxType.
+func auxiliarySuffix(auxType string) string {
+	if suffix, ok := auxiliarySuffixes[auxType]; ok {
+		return suffix
+	}
+	return unknownAuxiliarySuffix
+}
+
+// AuxiliaryOutputPath returns the path an auxiliary image with suffix is
+// exported to for the main output outputPath: the main output's name with
+// the suffix and a ".png" extension.
+func AuxiliaryOutputPath(outputPath, suffix string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + suffix + ".png"
+}
+
+// exportAuxiliaryImages writes every auxiliary image of the image item
+// itemID (0 for the primary image) in ra, except the alpha plane that is
+// merged into the main output, as a grayscale PNG next to outputPath at
+// its own resolution. Images whose suffix is taken by an earlier one get
+// "_2", "_3", ... appended. With autoOrient, each image is rotated by its
+// own irot/imir properties. It returns the paths written and a warning for
+// each image that failed.
+func exportAuxiliaryImages(ra io.ReaderAt, itemID uint32, outputPath string, autoOrient bool) (paths, warnings []string) {
+	hf := heif.Open(ra)
+	primary, err := imageItem(hf, itemID)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("補助画像を取得できませんでした: %v", err)}
+	}
+	aux, err := auxiliaryImages(ra, hf, primary)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("補助画像を取得できませんでした: %v", err)}
+	}
+
+	used := make(map[string]int)
+	for _, a := range aux {
+		if alphaAuxiliaryTypes[a.auxType] {
+			continue
+		}
+		suffix := auxiliarySuffix(a.auxType)
+		used[suffix]++
+		if n := used[suffix]; n > 1 {
+			suffix = fmt.Sprintf("%s_%d", suffix, n)
+		}
+		path := AuxiliaryOutputPath(outputPath, suffix)
+
+		plane, err := decodeLuma(hf, a.item)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("補助画像のデコードに失敗しました（%s）: %v", a.auxType, err))
+			continue
+		}
+		var img image.Image = plane
+		if o, ok := heifOrientation(a.item); ok && autoOrient {
+			img = applyOrientation(plane, o)
+		}
+
+		err = fileutil.WriteAtomic(path, func(w io.Writer) error {
+			return pngEncoder{}.Encode(w, img, Metadata{})
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("補助画像の書き込みに失敗しました（%s）: %v", path, err))
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, warnings
+}
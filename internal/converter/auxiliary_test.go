@@ -0,0 +1,280 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrium/goheif/heif"
+)
+
+// appleGainMapType is the aux_type of the HDR gain map in test.HEIC
+const appleGainMapType = "urn:com:apple:photo:2020:aux:hdrgainmap"
+
+func TestAuxiliaryImages(t *testing.T) {
+	t.Parallel()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hf := heif.Open(file)
+	primary, err := hf.PrimaryItem()
+	if err != nil {
+		t.Fatalf("Failed to read primary item: %v", err)
+	}
+	aux, err := auxiliaryImages(file, hf, primary)
+	if err != nil {
+		t.Fatalf("auxiliaryImages failed: %v", err)
+	}
+	if len(aux) != 1 || aux[0].auxType != appleGainMapType {
+		t.Fatalf("Expected only the HDR gain map, got %+v", aux)
+	}
+}
+
+// TestReadAuxiliaryPlane decodes the gain map of test.HEIC, a grid of HEVC
+// tiles, through the same path as alpha planes
+func TestReadAuxiliaryPlane(t *testing.T) {
+	t.Parallel()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	plane, premultiplied, err := readAuxiliaryPlane(file, 0, func(auxType string) bool {
+		return auxType == appleGainMapType
+	})
+	if err != nil {
+		t.Fatalf("readAuxiliaryPlane failed: %v", err)
+	}
+	if plane == nil || plane.Rect != image.Rect(0, 0, 2856, 2142) {
+		t.Fatalf("Expected a 2856x2142 plane, got %v", plane)
+	}
+	if premultiplied {
+		t.Error("Expected the gain map not to be a premultiplied alpha plane")
+	}
+	nonZero := false
+	for _, v := range plane.Pix {
+		if v != 0 {
+			nonZero = true
+			break
+		}
+	}
+	if !nonZero {
+		t.Error("Expected decoded plane to contain data")
+	}
+
+	// test.HEIC has no alpha plane.
+	alpha, _, err := readAlpha(file, 0)
+	if err != nil || alpha != nil {
+		t.Errorf("readAlpha() = %v, %v; want nil, nil", alpha, err)
+	}
+}
+
+func TestAttachAlpha(t *testing.T) {
+	t.Parallel()
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+	src.SetRGBA(1, 0, color.RGBA{R: 64, G: 32, B: 0, A: 255})
+
+	alpha := image.NewGray(image.Rect(0, 0, 2, 1))
+	alpha.Pix[0], alpha.Pix[1] = 255, 128
+
+	out, ok := attachAlpha(src, alpha, false).(*image.NRGBA)
+	if !ok {
+		t.Fatalf("Expected *image.NRGBA, got %T", out)
+	}
+	if got := out.NRGBAAt(0, 0); got != (color.NRGBA{R: 200, G: 100, B: 50, A: 255}) {
+		t.Errorf("Opaque pixel = %v", got)
+	}
+	if got := out.NRGBAAt(1, 0); got != (color.NRGBA{R: 64, G: 32, B: 0, A: 128}) {
+		t.Errorf("Translucent pixel = %v", got)
+	}
+
+	// Premultiplied colors are converted to straight alpha.
+	out = attachAlpha(src, alpha, true).(*image.NRGBA)
+	if got := out.NRGBAAt(1, 0); got != (color.NRGBA{R: 128, G: 64, B: 0, A: 128}) {
+		t.Errorf("Premultiplied pixel = %v, want straight alpha", got)
+	}
+
+	// A smaller alpha plane is scaled to the image size.
+	small := image.NewGray(image.Rect(0, 0, 1, 1))
+	out = attachAlpha(image.NewRGBA(image.Rect(0, 0, 4, 4)), small, false).(*image.NRGBA)
+	if out.Rect.Dx() != 4 || out.NRGBAAt(3, 3).A != 0 {
+		t.Errorf("Expected alpha plane scaled to 4x4, got %v with alpha %d", out.Rect, out.NRGBAAt(3, 3).A)
+	}
+
+	// Fully opaque alpha leaves the image untouched.
+	opaque := image.NewGray(image.Rect(0, 0, 2, 1))
+	opaque.Pix[0], opaque.Pix[1] = 255, 255
+	if got := attachAlpha(src, opaque, false); got != image.Image(src) {
+		t.Error("Expected an opaque alpha plane to return the input image")
+	}
+}
+
+func TestParseBackground(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"", DefaultBackground, false},
+		{"white", DefaultBackground, false},
+		{"Black", color.RGBA{A: 255}, false},
+		{"#336699", color.RGBA{R: 0x33, G: 0x66, B: 0x99, A: 255}, false},
+		{"ff0000", color.RGBA{R: 255, A: 255}, false},
+		{"#0F0", color.RGBA{G: 255, A: 255}, false},
+		{"#12345", color.RGBA{}, true},
+		{"#GGGGGG", color.RGBA{}, true},
+		{"red", color.RGBA{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBackground(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBackground(%q) = %v, %v; want %v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestEncode_Alpha verifies that JPEG output composites transparent pixels
+// onto the background while PNG output keeps them
+func TestEncode_Alpha(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+3] = 255, 0 // fully transparent red
+	}
+
+	background := color.RGBA{B: 255, A: 255}
+	encoder, err := NewEncoder(FormatJPEG, ConvertOptions{Background: background})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, src, Metadata{}); err != nil {
+		t.Fatalf("JPEG encode failed: %v", err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %v", err)
+	}
+	r, g, b, _ := decoded.At(8, 8).RGBA()
+	if r>>8 > 8 || g>>8 > 8 || b>>8 < 247 {
+		t.Errorf("Expected the blue background, got RGB=(%d,%d,%d)", r>>8, g>>8, b>>8)
+	}
+
+	encoder, err = NewEncoder(FormatPNG, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	buf.Reset()
+	if err := encoder.Encode(&buf, src, Metadata{}); err != nil {
+		t.Fatalf("PNG encode failed: %v", err)
+	}
+	decoded, err = png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if _, _, _, a := decoded.At(8, 8).RGBA(); a != 0 {
+		t.Errorf("Expected PNG to keep transparency, got alpha %d", a>>8)
+	}
+}
+
+func TestConvertNRGBAToRGBA_Background(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 128})
+
+	got := convertNRGBAToRGBA(src, color.RGBA{A: 255}).RGBAAt(0, 0)
+	if got != (color.RGBA{R: 128, A: 255}) {
+		t.Errorf("Composite on black = %v, want {128 0 0 255}", got)
+	}
+}
+
+func TestAuxiliaryOutputPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		auxType string
+		want    string
+	}{
+		{"urn:mpeg:hevc:2015:auxid:2", filepath.Join("out", "IMG_0001_depth.png")},
+		{"urn:com:apple:photo:2018:aux:portraiteffectsmatte", filepath.Join("out", "IMG_0001_matte.png")},
+		{"urn:com:apple:photo:2019:aux:semantichairmatte", filepath.Join("out", "IMG_0001_hair.png")},
+		{"urn:example:unknown", filepath.Join("out", "IMG_0001_aux.png")},
+	}
+	for _, tt := range tests {
+		got := AuxiliaryOutputPath(filepath.Join("out", "IMG_0001.jpg"), auxiliarySuffix(tt.auxType))
+		if got != tt.want {
+			t.Errorf("AuxiliaryOutputPath for %s = %q, want %q", tt.auxType, got, tt.want)
+		}
+	}
+}
+
+func TestConvertHEIC_ExportAux(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                  string
+		autoOrient            bool
+		wantWidth, wantHeight int
+	}{
+		{"stored orientation", false, 2856, 2142},
+		{"auto-orient", true, 2142, 2856},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			heicFile, cleanup := setupTestFile(t)
+			defer cleanup()
+
+			result, err := ConvertHEIC(heicFile, ConvertOptions{ExportAux: true, AutoOrient: tt.autoOrient})
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("Unexpected warnings: %v", result.Warnings)
+			}
+			want := AuxiliaryOutputPath(result.OutputPath, "_gainmap")
+			if len(result.AuxOutputPaths) != 1 || result.AuxOutputPaths[0] != want {
+				t.Fatalf("AuxOutputPaths = %v, want [%s]", result.AuxOutputPaths, want)
+			}
+
+			data, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatalf("Failed to read exported image: %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Exported image is not a valid PNG: %v", err)
+			}
+			if _, ok := img.(*image.Gray); !ok {
+				t.Errorf("Expected a grayscale PNG, got %T", img)
+			}
+			if b := img.Bounds(); b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+				t.Errorf("Exported image is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+
+	// Without the option nothing extra is written.
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+	result, err := ConvertHEIC(heicFile, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if _, err := os.Stat(AuxiliaryOutputPath(result.OutputPath, "_gainmap")); !os.IsNotExist(err) {
+		t.Error("Expected no auxiliary images without ExportAux")
+	}
+}
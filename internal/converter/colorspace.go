@@ -0,0 +1,320 @@
+package converter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// ColorSpace selects the color space of the output pixels.
+type ColorSpace string
+
+const (
+	// ColorSpacePreserve keeps the decoded pixels as they are and embeds the
+	// source ICC profile. It is the default.
+	ColorSpacePreserve ColorSpace = "preserve"
+	// ColorSpaceSRGB converts the pixels from the source ICC profile to sRGB
+	// and omits the profile, since untagged images are treated as sRGB.
+	ColorSpaceSRGB ColorSpace = "srgb"
+)
+
+// srgbEncodeLUTSize is the number of entries in the table that maps linear
+// light to 8-bit sRGB values.
+const srgbEncodeLUTSize = 4096
+
+// srgbToXYZ is the matrix from linear sRGB to the D50 profile connection
+// space, i.e. the Bradford-adapted rXYZ/gXYZ/bXYZ columns of the standard
+// sRGB ICC profile.
+var srgbToXYZ = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// ParseColorSpace parses a --colorspace value.
+func ParseColorSpace(s string) (ColorSpace, error) {
+	switch cs := ColorSpace(strings.ToLower(s)); cs {
+	case "":
+		return ColorSpacePreserve, nil
+	case ColorSpacePreserve, ColorSpaceSRGB:
+		return cs, nil
+	default:
+		return "", fmt.Errorf("不明な色空間です: %s（指定可能: preserve, srgb）", s)
+	}
+}
+
+// iccTransform converts 8-bit RGB values described by a matrix/TRC ICC
+// profile to 8-bit sRGB.
+type iccTransform struct {
+	// toLinear maps each 8-bit channel value to linear light through the
+	// profile's tone reproduction curves.
+	toLinear [3][256]float64
+	// matrix maps linear source RGB to linear sRGB.
+	matrix [3][3]float64
+	// encode maps quantized linear light to an 8-bit sRGB value.
+	encode [srgbEncodeLUTSize]uint8
+}
+
+// newICCTransform builds the transform from the RGB matrix/TRC profile icc
+// to sRGB. Profiles based on lookup tables (A2B0 etc.) are not supported.
+func newICCTransform(icc []byte) (*iccTransform, error) {
+	tags, err := parseICCTags(icc)
+	if err != nil {
+		return nil, err
+	}
+
+	var toXYZ [3][3]float64
+	for c, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseICCXYZ(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%sタグ: %w", sig, err)
+		}
+		for i := range xyz {
+			toXYZ[i][c] = xyz[i]
+		}
+	}
+
+	t := &iccTransform{}
+	for c, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseICCCurve(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%sタグ: %w", sig, err)
+		}
+		for v := range t.toLinear[c] {
+			t.toLinear[c][v] = curve(float64(v) / 255)
+		}
+	}
+
+	fromXYZ, ok := invert3x3(srgbToXYZ)
+	if !ok {
+		return nil, fmt.Errorf("sRGBの変換行列を計算できませんでした")
+	}
+	t.matrix = multiply3x3(fromXYZ, toXYZ)
+
+	for i := range t.encode {
+		t.encode[i] = uint8(math.Round(srgbEncode(float64(i)/(srgbEncodeLUTSize-1)) * 255))
+	}
+	return t, nil
+}
+
+// parseICCTags validates the header of an RGB profile and returns the data
+// of each tag keyed by its signature.
+func parseICCTags(icc []byte) (map[string][]byte, error) {
+	if len(icc) < 132 || string(icc[36:40]) != "acsp" {
+		return nil, fmt.Errorf("ICCプロファイルの形式が正しくありません")
+	}
+	if cs := string(icc[16:20]); cs != "RGB " {
+		return nil, fmt.Errorf("RGB以外のICCプロファイルには対応していません: %q", cs)
+	}
+	if pcs := string(icc[20:24]); pcs != "XYZ " {
+		return nil, fmt.Errorf("XYZ以外の接続色空間には対応していません: %q", pcs)
+	}
+
+	count := int(binary.BigEndian.Uint32(icc[128:132]))
+	if count > (len(icc)-132)/12 {
+		return nil, fmt.Errorf("ICCプロファイルのタグ数が正しくありません: %d", count)
+	}
+	tags := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entry := icc[132+12*i:]
+		offset := int(binary.BigEndian.Uint32(entry[4:8]))
+		size := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || size < 0 || offset > len(icc) || size > len(icc)-offset {
+			return nil, fmt.Errorf("ICCプロファイルのタグが範囲外です: %s", entry[0:4])
+		}
+		tags[string(entry[0:4])] = icc[offset : offset+size]
+	}
+	return tags, nil
+}
+
+// parseICCXYZ parses an XYZType tag holding a single XYZ value.
+func parseICCXYZ(data []byte) ([3]float64, error) {
+	if len(data) < 20 || string(data[0:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("XYZ値がありません")
+	}
+	return [3]float64{s15Fixed16(data[8:]), s15Fixed16(data[12:]), s15Fixed16(data[16:])}, nil
+}
+
+// parseICCCurve parses a curveType or parametricCurveType tag into a
+// function from encoded values to linear light, both in [0, 1].
+func parseICCCurve(data []byte) (func(float64) float64, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("トーンカーブがありません")
+	}
+
+	switch string(data[0:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(data[8:12]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, nil
+		case n == 1 && len(data) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(data[12:14])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		case n > 1 && len(data) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(data[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := min(int(pos), n-2)
+				return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+			}, nil
+		}
+
+	case "para":
+		// Number of s15Fixed16 parameters for function types 0-4.
+		paramCounts := []int{1, 3, 4, 5, 7}
+		fn := int(binary.BigEndian.Uint16(data[8:10]))
+		if fn >= len(paramCounts) || len(data) < 12+4*paramCounts[fn] {
+			break
+		}
+		p := make([]float64, 7)
+		for i := 0; i < paramCounts[fn]; i++ {
+			p[i] = s15Fixed16(data[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch fn {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return math.Pow(a*x+b, g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return math.Pow(a*x+b, g) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return math.Pow(a*x+b, g)
+				}
+				return c * x
+			}, nil
+		case 4:
+			return func(x float64) float64 {
+				if x >= d {
+					return math.Pow(a*x+b, g) + e
+				}
+				return c*x + f
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("対応していないトーンカーブです: %q", data[0:4])
+}
+
+// s15Fixed16 decodes an ICC s15Fixed16Number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// srgbEncode applies the sRGB transfer function to linear light in [0, 1].
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// convertToSRGB returns img converted from the color space described by the
+// ICC profile icc to sRGB. *image.Gray is returned unchanged; *image.NRGBA
+// stays *image.NRGBA and everything else is converted to *image.RGBA.
+func convertToSRGB(img image.Image, icc []byte) (image.Image, error) {
+	t, err := newICCTransform(icc)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rect := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	switch src := img.(type) {
+	case *image.Gray:
+		// Neutral grays keep their value under an RGB profile with a shared
+		// white point, so there is nothing to convert.
+		return img, nil
+	case *image.NRGBA:
+		dst := image.NewNRGBA(rect)
+		for y := 0; y < rect.Dy(); y++ {
+			copy(dst.Pix[y*dst.Stride:], src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:4*rect.Dx()])
+		}
+		t.transformPix(dst.Pix, false)
+		return dst, nil
+	default:
+		dst := image.NewRGBA(rect)
+		draw.Draw(dst, rect, img, bounds.Min, draw.Src)
+		t.transformPix(dst.Pix, true)
+		return dst, nil
+	}
+}
+
+// transformPix converts RGBA pixels in place. premultiplied reports whether
+// the color channels are premultiplied by alpha, as in *image.RGBA.
+func (t *iccTransform) transformPix(pix []byte, premultiplied bool) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		a := pix[i+3]
+		if a == 0 {
+			continue
+		}
+		r, g, b := pix[i], pix[i+1], pix[i+2]
+		if premultiplied && a != 0xFF {
+			r, g, b = unpremultiply(r, a), unpremultiply(g, a), unpremultiply(b, a)
+		}
+
+		lr, lg, lb := t.toLinear[0][r], t.toLinear[1][g], t.toLinear[2][b]
+		for c := 0; c < 3; c++ {
+			v := t.matrix[c][0]*lr + t.matrix[c][1]*lg + t.matrix[c][2]*lb
+			out := t.encode[int(math.Round(min(max(v, 0), 1)*(srgbEncodeLUTSize-1)))]
+			if premultiplied && a != 0xFF {
+				out = uint8((uint32(out)*uint32(a) + 127) / 255)
+			}
+			pix[i+c] = out
+		}
+	}
+}
+
+// unpremultiply returns the straight-alpha value of a premultiplied channel.
+func unpremultiply(v, a uint8) uint8 {
+	return uint8(min((uint32(v)*255+uint32(a)/2)/uint32(a), 255))
+}
+
+// invert3x3 returns the inverse of m, or ok=false if m is singular.
+func invert3x3(m [3][3]float64) (inv [3][3]float64, ok bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if det == 0 {
+		return inv, false
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// The cofactor of m[j][i], via cyclic indices.
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv, true
+}
+
+// multiply3x3 returns the matrix product a*b.
+func multiply3x3(a, b [3][3]float64) (p [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				p[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return p
+}
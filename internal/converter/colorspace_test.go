@@ -0,0 +1,197 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseColorSpace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		want    ColorSpace
+		wantErr bool
+	}{
+		{"", ColorSpacePreserve, false},
+		{"preserve", ColorSpacePreserve, false},
+		{"sRGB", ColorSpaceSRGB, false},
+		{"p3", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseColorSpace(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseColorSpace(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestConvertToSRGB_DisplayP3 converts colors through the Display P3 profile
+// of test.HEIC and compares them against the published P3-to-sRGB matrix
+func TestConvertToSRGB_DisplayP3(t *testing.T) {
+	t.Parallel()
+	icc := readTestICCProfile(t, "test.HEIC")
+
+	decode := func(v uint8) float64 {
+		x := float64(v) / 255
+		if x <= 0.04045 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	}
+	p3ToSRGB := [3][3]float64{
+		{1.2249, -0.2247, 0},
+		{-0.0420, 1.0419, 0},
+		{-0.0197, -0.0786, 1.0979},
+	}
+
+	colors := []color.RGBA{
+		{255, 255, 255, 255},
+		{128, 128, 128, 255},
+		{200, 100, 100, 255},
+		{60, 150, 90, 255},
+	}
+	src := image.NewRGBA(image.Rect(0, 0, len(colors), 1))
+	for x, c := range colors {
+		src.SetRGBA(x, 0, c)
+	}
+
+	out, err := convertToSRGB(src, icc)
+	if err != nil {
+		t.Fatalf("convertToSRGB failed: %v", err)
+	}
+	for x, c := range colors {
+		got := out.(*image.RGBA).RGBAAt(x, 0)
+		in := [3]float64{decode(c.R), decode(c.G), decode(c.B)}
+		want := [3]uint8{}
+		for i := range want {
+			v := p3ToSRGB[i][0]*in[0] + p3ToSRGB[i][1]*in[1] + p3ToSRGB[i][2]*in[2]
+			want[i] = uint8(math.Round(srgbEncode(min(max(v, 0), 1)) * 255))
+		}
+		for i, g := range [3]uint8{got.R, got.G, got.B} {
+			if diff := int(g) - int(want[i]); diff < -2 || diff > 2 {
+				t.Errorf("%v converted to %v, want about %v", c, got, want)
+				break
+			}
+		}
+	}
+
+	// The source image is left untouched.
+	if src.RGBAAt(2, 0) != colors[2] {
+		t.Error("convertToSRGB modified its input")
+	}
+}
+
+func TestConvertToSRGB_UnsupportedProfile(t *testing.T) {
+	t.Parallel()
+	icc := append([]byte{}, readTestICCProfile(t, "test.HEIC")...)
+	copy(icc[16:20], "GRAY")
+
+	if _, err := convertToSRGB(image.NewRGBA(image.Rect(0, 0, 1, 1)), icc); err == nil {
+		t.Error("Expected an error for a non-RGB profile")
+	}
+	if _, err := convertToSRGB(image.NewRGBA(image.Rect(0, 0, 1, 1)), []byte("not a profile")); err == nil {
+		t.Error("Expected an error for a malformed profile")
+	}
+}
+
+func TestParseICCCurve(t *testing.T) {
+	t.Parallel()
+	curv := func(values ...uint16) []byte {
+		data := []byte{'c', 'u', 'r', 'v', 0, 0, 0, 0, 0, 0, 0, byte(len(values))}
+		for _, v := range values {
+			data = append(data, byte(v>>8), byte(v))
+		}
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		x    float64
+		want float64
+	}{
+		{"identity", curv(), 0.5, 0.5},
+		{"gamma 2.0", curv(0x0200), 0.5, 0.25},
+		{"table", curv(0, 0x8000, 0xFFFF), 0.25, float64(0x8000) / 65535 / 2},
+		{"para type 0", []byte{'p', 'a', 'r', 'a', 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0}, 0.5, 0.25},
+	}
+	for _, tt := range tests {
+		curve, err := parseICCCurve(tt.data)
+		if err != nil {
+			t.Errorf("%s: parseICCCurve failed: %v", tt.name, err)
+			continue
+		}
+		if got := curve(tt.x); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s: curve(%g) = %g, want %g", tt.name, tt.x, got, tt.want)
+		}
+	}
+
+	if _, err := parseICCCurve([]byte("mAB \x00\x00\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Error("Expected an error for an unsupported curve type")
+	}
+}
+
+// TestConvertHEIC_ColorSpaceSRGB verifies that sRGB output omits the source
+// ICC profile
+func TestConvertHEIC_ColorSpaceSRGB(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{ColorSpace: ColorSpaceSRGB})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", result.Warnings)
+	}
+
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if bytes.Contains(data, []byte(iccSegmentMarker)) {
+		t.Error("Expected no ICC profile in sRGB output")
+	}
+	if !bytes.Contains(data, exifMarker) {
+		t.Error("Expected EXIF to be kept in sRGB output")
+	}
+}
+
+// TestConvertHEIC_ColorSpaceSRGBWithoutProfile verifies that a file without
+// an ICC profile is converted unchanged, with a warning that the colors
+// were not converted
+func TestConvertHEIC_ColorSpaceSRGBWithoutProfile(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	heicFile := filepath.Join(tmpDir, "test_no_exif.HEIC")
+	data, err := os.ReadFile(filepath.Join("..", "..", "test_images", "test_no_exif.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if err := os.WriteFile(heicFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{ColorSpace: ColorSpaceSRGB})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "ICCプロファイルがないため") {
+		t.Errorf("Expected a single missing-profile warning, got %v", result.Warnings)
+	}
+
+	result, err = ConvertHEIC(heicFile, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings without --colorspace srgb: %v", result.Warnings)
+	}
+}
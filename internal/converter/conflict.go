@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/fileutil"
+)
+
+// maxRenameAttempts bounds the "_N" suffixes tried by ConflictRename.
+const maxRenameAttempts = 10000
+
+// ConflictPolicy decides what happens when the output file already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the existing file. It is the default.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkip leaves the existing file untouched and skips the input.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictRename writes to the first free "_1", "_2", ... variant of the
+	// output path instead.
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictNewer overwrites the existing file only if the input was
+	// modified after it, and skips the input otherwise.
+	ConflictNewer ConflictPolicy = "newer"
+)
+
+// ParseConflictPolicy parses an --on-conflict value.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(s)); policy {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkip, ConflictRename, ConflictNewer:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("不明な競合時の動作です: %s（指定可能: skip, overwrite, rename, newer）", s)
+	}
+}
+
+// shouldSkip reports whether converting inputPath to outputPath must be
+// skipped under policy because outputPath already exists.
+func shouldSkip(inputPath, outputPath string, policy ConflictPolicy) (bool, error) {
+	if policy != ConflictSkip && policy != ConflictNewer {
+		return false, nil
+	}
+
+	outInfo, err := os.Stat(outputPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("出力ファイルの確認に失敗しました: %w", err)
+	}
+	if policy == ConflictSkip {
+		return true, nil
+	}
+
+	inInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return false, fmt.Errorf("ファイルを開けませんでした: %w", err)
+	}
+	return !inInfo.ModTime().After(outInfo.ModTime()), nil
+}
+
+// renameCandidates returns the output paths tried in turn under
+// ConflictRename: outputPath itself, then its "_1", "_2", ... variants.
+func renameCandidates(outputPath string) func(n int) (string, bool) {
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	return func(n int) (string, bool) {
+		switch {
+		case n == 0:
+			return outputPath, true
+		case n > maxRenameAttempts:
+			return "", false
+		}
+		return fmt.Sprintf("%s_%d%s", base, n, ext), true
+	}
+}
+
+// writeOutput writes the data write produces to outputPath and returns the
+// path written. The file is written via a temporary file so that no path
+// ever holds a partially written image, even if the process is killed
+// mid-write. Under ConflictRename an existing file is never replaced: the
+// finished file takes the first free "_N" variant of outputPath instead,
+// claimed atomically so concurrent conversions cannot share a name.
+func writeOutput(outputPath string, policy ConflictPolicy, write func(w io.Writer) error) (string, error) {
+	if policy == ConflictRename {
+		return fileutil.WriteNew(renameCandidates(outputPath), write)
+	}
+	return outputPath, fileutil.WriteAtomic(outputPath, write)
+}
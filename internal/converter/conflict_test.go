@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseConflictPolicy tests --on-conflict value parsing
+func TestParseConflictPolicy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected ConflictPolicy
+		wantErr  bool
+	}{
+		{"", ConflictOverwrite, false},
+		{"overwrite", ConflictOverwrite, false},
+		{"skip", ConflictSkip, false},
+		{"Rename", ConflictRename, false},
+		{"newer", ConflictNewer, false},
+		{"replace", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseConflictPolicy(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseConflictPolicy(%q) expected error, got %q", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConflictPolicy(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseConflictPolicy(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestShouldSkip tests the skip decision for each policy
+func TestShouldSkip(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	input := filepath.Join(tmpDir, "a.HEIC")
+	output := filepath.Join(tmpDir, "a.jpg")
+	for _, path := range []string{input, output} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(input, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	missing := filepath.Join(tmpDir, "missing.jpg")
+
+	tests := []struct {
+		name     string
+		output   string
+		policy   ConflictPolicy
+		expected bool
+	}{
+		{"Overwrite existing", output, ConflictOverwrite, false},
+		{"Rename existing", output, ConflictRename, false},
+		{"Skip existing", output, ConflictSkip, true},
+		{"Skip missing", missing, ConflictSkip, false},
+		{"Newer with older input", output, ConflictNewer, true},
+		{"Newer missing", missing, ConflictNewer, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := shouldSkip(input, tt.output, tt.policy)
+			if err != nil {
+				t.Fatalf("shouldSkip failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("shouldSkip() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestWriteOutput_Rename tests that rename never reuses an existing name
+func TestWriteOutput_Rename(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "a.jpg")
+	if err := os.WriteFile(output, []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	for _, expected := range []string{"a_1.jpg", "a_2.jpg"} {
+		written, err := writeOutput(output, ConflictRename, func(w io.Writer) error {
+			_, err := w.Write([]byte("new"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("writeOutput failed: %v", err)
+		}
+		if got := filepath.Base(written); got != expected {
+			t.Errorf("writeOutput() = %q, want %q", got, expected)
+		}
+		if data, err := os.ReadFile(written); err != nil || string(data) != "new" {
+			t.Errorf("Unexpected contents of %s: %q (err: %v)", expected, data, err)
+		}
+	}
+
+	if data, err := os.ReadFile(output); err != nil || string(data) != "existing" {
+		t.Errorf("Existing file was modified (err: %v)", err)
+	}
+}
+
+// TestWriteOutput_InterruptedRename tests that no output name is claimed
+// while the image is being written, so an interrupted conversion leaves no
+// empty file that a later skip or rename run would mistake for its output
+func TestWriteOutput_InterruptedRename(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "a.jpg")
+	if err := os.WriteFile(output, []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	interrupted := errors.New("interrupted")
+	_, err := writeOutput(output, ConflictRename, func(w io.Writer) error {
+		// This is the state a crash during encoding would leave behind.
+		if entries, err := os.ReadDir(tmpDir); err != nil || len(entries) != 2 {
+			t.Errorf("Expected only the existing and a temporary file during the write, got %v (err: %v)", entries, err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "a_1.jpg")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("a_1.jpg was claimed before the image was written (err: %v)", err)
+		}
+		_, _ = w.Write([]byte("partial"))
+		return interrupted
+	})
+	if !errors.Is(err, interrupted) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a.jpg" {
+		t.Errorf("Expected only the existing file to remain, got %v", entries)
+	}
+}
+
+// TestConvertHEIC_SkipExisting verifies that a skipped conversion reports
+// Result.Skipped and leaves the existing file untouched
+func TestConvertHEIC_SkipExisting(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	outputPath := GenerateOutputPath(heicFile)
+	if err := os.WriteFile(outputPath, []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{OnConflict: ConflictSkip})
+	if err != nil {
+		t.Fatalf("ConvertHEIC failed: %v", err)
+	}
+	if !result.Skipped || result.OutputPath != outputPath {
+		t.Errorf("Result = %+v, want skipped %s", result, outputPath)
+	}
+	if data, err := os.ReadFile(outputPath); err != nil || string(data) != "existing" {
+		t.Errorf("Existing file was modified (err: %v)", err)
+	}
+}
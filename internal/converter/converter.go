@@ -1,23 +1,34 @@
-// Package converter provides functionality for converting HEIC image files to JPEG format.
+// Package converter provides functionality for converting HEIC image files to
+// JPEG and other image formats.
 package converter
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/jpeg"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
 )
 
 const (
-	// JPEGQuality is the quality setting for JPEG encoding (0-100)
+	// JPEGQuality is the default quality setting for JPEG encoding (0-100),
+	// used when ConvertOptions.Quality is left at zero.
 	JPEGQuality = 95
 
+	// MinJPEGQuality and MaxJPEGQuality bound the values accepted for
+	// ConvertOptions.Quality.
+	MinJPEGQuality = 1
+	MaxJPEGQuality = 100
+
 	// maxEXIFSegmentPayload is the largest EXIF payload that can fit in a single
 	// JPEG APP1 segment. A segment's length field is 2 bytes and covers itself,
 	// so the payload (which starts with the "Exif\0\0" marker) may be at most
@@ -28,6 +39,26 @@ const (
 	jpegAPP1Marker = 0xE1
 )
 
+// DefaultBackground is the color that transparent pixels are composited onto
+// for output formats without an alpha channel, used when
+// ConvertOptions.Background is left at its zero value.
+var DefaultBackground = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+// exifHeader is the "Exif\0\0" marker that prefixes EXIF payloads returned
+// by goheif.ExtractExif and stored in JPEG APP1 segments.
+var exifHeader = []byte{'E', 'x', 'i', 'f', 0x00, 0x00}
+
+// qualityPresets maps the named encoder presets accepted by
+// QualityForPreset to their JPEG quality values.
+var qualityPresets = map[string]int{
+	// web favors small files for thumbnails and page images.
+	"web": 75,
+	// balanced is a general-purpose middle ground.
+	"balanced": 85,
+	// archive matches the historical fixed quality for masters.
+	"archive": JPEGQuality,
+}
+
 func init() {
 	// goheif's default decode path hands back Y/Cb/Cr slices that alias
 	// the underlying C decoder's buffer, which is freed as soon as
@@ -45,16 +76,180 @@ type ConvertOptions struct {
 	// RemoveEXIF controls whether EXIF metadata from the source HEIC file is
 	// carried over to the converted JPEG. When true, the JPEG is written
 	// without any EXIF data. When false, EXIF metadata found in the HEIC
-	// source is embedded into the output JPEG.
+	// source is embedded into the output JPEG. The XMP packet describing
+	// the image is carried over or removed along with the EXIF data.
 	RemoveEXIF bool
+
+	// EXIFFilter, when non-nil, removes the EXIF tags it does not keep
+	// (such as the GPS IFD) from the carried over EXIF metadata, and the XMP
+	// packet unless it keeps the xmp group or, for a packet carrying a
+	// location, the GPS coordinates. It is ignored when RemoveEXIF is set.
+	EXIFFilter *exif.TagFilter
+
+	// Quality is the JPEG encoding quality (MinJPEGQuality-MaxJPEGQuality).
+	// Zero selects the default, JPEGQuality. It is ignored by the lossless
+	// output formats.
+	Quality int
+
+	// Format selects the output encoder. The zero value means FormatJPEG.
+	Format Format
+
+	// OutputPath, when non-empty, overrides the output path that would
+	// otherwise be generated next to the source file. Missing parent
+	// directories are created.
+	OutputPath string
+
+	// OnConflict decides what happens when the output file already exists.
+	// The zero value means ConflictOverwrite.
+	OnConflict ConflictPolicy
+
+	// AutoOrient rotates and mirrors the pixels as described by the HEIF
+	// irot/imir properties (or, failing those, the EXIF Orientation tag) so
+	// the output displays upright without relying on metadata. The carried
+	// over EXIF Orientation is then reset to 1.
+	AutoOrient bool
+
+	// Resize scales the image down before encoding. The carried over EXIF
+	// PixelXDimension/PixelYDimension tags are updated to the new size.
+	Resize ResizeOptions
+
+	// ColorSpace selects whether the pixels are kept in the color space of
+	// the source ICC profile (which is then embedded) or converted to sRGB.
+	// The zero value means ColorSpacePreserve.
+	ColorSpace ColorSpace
+
+	// Background is the color that transparent pixels are composited onto
+	// when writing formats without an alpha channel (JPEG). PNG and TIFF
+	// output keep the alpha channel. The zero value means DefaultBackground.
+	Background color.RGBA
+
+	// ExportAux additionally writes each auxiliary image of the source
+	// (depth map, portrait and semantic mattes, HDR gain map, ...) as a
+	// grayscale PNG next to the output; see AuxiliaryOutputPath. The alpha
+	// plane is not exported, as it is part of the main output.
+	ExportAux bool
+
+	// ItemID selects the image item to convert; see ListItems. Zero selects
+	// the primary image.
+	ItemID uint32
+}
+
+// background returns the effective background color for these options.
+func (o ConvertOptions) background() color.RGBA {
+	if o.Background == (color.RGBA{}) {
+		return DefaultBackground
+	}
+	return o.Background
+}
+
+// jpegQuality returns the effective JPEG quality for these options.
+func (o ConvertOptions) jpegQuality() int {
+	if o.Quality == 0 {
+		return JPEGQuality
+	}
+	return o.Quality
+}
+
+// ValidateQuality reports an error if quality is outside the range accepted
+// by jpeg.Encode.
+func ValidateQuality(quality int) error {
+	if quality < MinJPEGQuality || quality > MaxJPEGQuality {
+		return fmt.Errorf("JPEG品質は%d〜%dの範囲で指定してください: %d", MinJPEGQuality, MaxJPEGQuality, quality)
+	}
+	return nil
+}
+
+// QualityForPreset returns the JPEG quality for a named preset (see
+// PresetNames). Preset names are case-insensitive.
+func QualityForPreset(name string) (int, error) {
+	quality, ok := qualityPresets[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("不明なプリセットです: %s（指定可能: %s）", name, strings.Join(PresetNames(), ", "))
+	}
+	return quality, nil
+}
+
+// PresetNames returns the names of all encoder presets in sorted order.
+func PresetNames() []string {
+	names := make([]string, 0, len(qualityPresets))
+	for name := range qualityPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result describes the outcome of a successful conversion.
+type Result struct {
+	// OutputPath is the path of the file that was written, or of the
+	// existing file if the conversion was skipped.
+	OutputPath string
+
+	// Skipped is true if nothing was written because the output file
+	// already existed and options.OnConflict said to keep it.
+	Skipped bool
+
+	// EXIF reports whether the source's EXIF metadata was passed to the
+	// encoder. It is false if options.RemoveEXIF is set or the source has
+	// none. Formats that cannot store EXIF, such as TIFF, still drop it.
+	EXIF bool
+
+	// AuxOutputPaths lists the auxiliary images written because
+	// options.ExportAux was set.
+	AuxOutputPaths []string
+
+	// Warnings lists non-fatal problems, such as EXIF data that could not be
+	// carried over, encountered while converting.
+	Warnings []string
 }
 
 // ConvertHEICToJPEG converts a HEIC file to JPEG format
 func ConvertHEICToJPEG(inputPath string, options ConvertOptions) error {
+	options.Format = FormatJPEG
+	_, err := ConvertHEIC(inputPath, options)
+	return err
+}
+
+// ConvertHEIC converts a HEIC file to the format selected by
+// options.Format (JPEG by default), writing it next to the source file or
+// to options.OutputPath. If the output file already exists, options.OnConflict
+// decides whether it is overwritten, kept (Result.Skipped), or written
+// under a new name.
+func ConvertHEIC(inputPath string, options ConvertOptions) (*Result, error) {
+	if options.Quality != 0 {
+		if err := ValidateQuality(options.Quality); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := options.Resize.Validate(); err != nil {
+		return nil, err
+	}
+
+	encoder, err := NewEncoder(options.Format, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate output file path
+	outputPath := options.OutputPath
+	if outputPath == "" {
+		outputPath = GenerateOutputPathForFormat(inputPath, encoder.Format())
+	}
+
+	// Apply the conflict policy before doing any decoding work.
+	skip, err := shouldSkip(inputPath, outputPath, options.OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		return &Result{OutputPath: outputPath, Skipped: true}, nil
+	}
+
 	// Open HEIC file
 	file, err := os.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("ファイルを開けませんでした: %w", err)
+		return nil, fmt.Errorf("ファイルを開けませんでした: %w", err)
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -64,78 +259,221 @@ func ConvertHEICToJPEG(inputPath string, options ConvertOptions) error {
 	}()
 
 	// Decode HEIC image
-	img, err := goheif.Decode(file)
+	img, err := decodeItem(file, options.ItemID)
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルのデコードに失敗しました: %w", err)
+	}
+
+	// goheif ignores auxiliary images, so merge in the alpha plane, if any.
+	var warnings []string
+	alpha, premultiplied, err := readAlpha(file, options.ItemID)
 	if err != nil {
-		return fmt.Errorf("HEICファイルのデコードに失敗しました: %w", err)
+		warnings = append(warnings, fmt.Sprintf("アルファチャンネルを読み込めなかったため、不透明な画像として変換します: %v", err))
+	} else if alpha != nil {
+		img = attachAlpha(img, alpha, premultiplied)
 	}
 
 	// Extract EXIF metadata from the source HEIC file, unless the caller
-	// asked for it to be stripped. Extraction failures (e.g. no EXIF present)
-	// are non-fatal: the conversion simply proceeds without EXIF data.
-	var exifSegment []byte
+	// asked for it to be stripped, so the encoder writes the final file with
+	// its metadata in a single pass. Extraction failures are non-fatal: the
+	// conversion simply proceeds without EXIF data.
+	rebuild := exif.RebuildOptions{Filter: options.EXIFFilter}
+	if options.AutoOrient {
+		img, err = autoOrient(file, options.ItemID, img, &rebuild)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("画像の向きを取得できなかったため、回転せずに変換します: %v", err))
+		}
+	}
+
+	if !options.Resize.IsZero() {
+		resize := options.Resize
+		if !options.AutoOrient && resize.MaxWidth != resize.MaxHeight {
+			// The width and height limits refer to the displayed image, so
+			// swap them for pixels stored rotated by 90 degrees.
+			if o, err := readOrientation(file, options.ItemID); err == nil && o.rotateCW%2 == 1 {
+				resize = resize.rotated()
+			}
+		}
+		img = resizeImage(img, resize)
+	}
+
+	// The ICC profile describes the pixels rather than the capture, so it
+	// is kept even when EXIF is removed.
+	var meta Metadata
+	icc, iccErr := readICCProfile(file, options.ItemID)
+	if iccErr != nil {
+		warnings = append(warnings, fmt.Sprintf("ICCプロファイルを取得できなかったため、埋め込まずに変換します: %v", iccErr))
+	}
+	meta.ICC = icc
+
+	// Without a profile the pixels are left as they are, although they may
+	// not be sRGB: an nclx colr property can give other primaries.
+	if options.ColorSpace == ColorSpaceSRGB {
+		if icc != nil {
+			converted, err := convertToSRGB(img, icc)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("sRGBに変換できなかったため、元の色空間のまま変換します: %v", err))
+			} else {
+				img = converted
+				meta.ICC = nil
+			}
+		} else if iccErr == nil {
+			warnings = append(warnings, "ICCプロファイルがないため、sRGBに変換せず元の色空間のまま変換します")
+		}
+	}
+
+	// Monochrome HEIC files decode to grayscale pixels, which PNG and JPEG
+	// only allow with a grayscale profile.
+	var iccMatches bool
+	if img, meta.ICC, iccMatches = matchICCProfile(img, meta.ICC); !iccMatches {
+		warnings = append(warnings, fmt.Sprintf("ICCプロファイルの色空間（%q）が画像と一致しないため、埋め込まずに変換します", iccColorSpace(icc)))
+	}
+
+	// Items other than the primary image (such as thumbnails) differ in
+	// size from the image the EXIF data describes.
+	if options.AutoOrient || !options.Resize.IsZero() || options.ItemID != 0 {
+		bounds := img.Bounds()
+		rebuild.Width, rebuild.Height = bounds.Dx(), bounds.Dy()
+	}
+
 	if !options.RemoveEXIF {
-		if exifData, exifErr := goheif.ExtractExif(file); exifErr == nil {
-			exifSegment = buildEXIFAPP1Segment(exifData)
+		var exifWarnings []string
+		meta.EXIF, exifWarnings = extractEXIF(file, rebuild)
+		warnings = append(warnings, exifWarnings...)
+
+		// Only JPEG limits the EXIF data to a single 64KB segment.
+		if encoder.Format() == FormatJPEG {
+			meta.EXIF, exifWarnings = fitEXIFSegment(meta.EXIF)
+			warnings = append(warnings, exifWarnings...)
 		}
 	}
 
-	// Generate output file path
-	outputPath := GenerateOutputPath(inputPath)
+	// XMP (ratings, keywords, regions) is metadata like EXIF, so it is
+	// removed along with it, or by filters that do not keep it. A packet
+	// with a location also goes with the GPS tags it duplicates.
+	if !options.RemoveEXIF && options.EXIFFilter.KeepsXMP() {
+		xmp, err := readXMP(file, options.ItemID)
+		switch {
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("XMPを取得できなかったため、埋め込まずに変換します: %v", err))
+		case exif.XMPHasLocation(xmp) && !options.EXIFFilter.KeepsXMPLocation():
+			warnings = append(warnings, "XMPに位置情報が含まれているため、XMPを埋め込まずに変換します")
+		default:
+			meta.XMP = xmp
+		}
+	}
+
+	if options.OutputPath != "" {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return nil, fmt.Errorf("出力ディレクトリを作成できませんでした: %w", err)
+		}
+	}
+
+	if dropped := droppedMetadata(encoder.Format(), meta); len(dropped) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s形式には%sを埋め込めないため、埋め込まずに変換します", strings.ToUpper(string(encoder.Format())), strings.Join(dropped, "・")))
+	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	outputPath, err = writeOutput(outputPath, options.OnConflict, func(w io.Writer) error {
+		return encoder.Encode(w, img, meta)
+	})
 	if err != nil {
-		return fmt.Errorf("出力ファイルを作成できませんでした: %w", err)
+		return nil, err
 	}
-	defer func() {
-		if closeErr := outFile.Close(); closeErr != nil {
-			// Log error but don't fail conversion
-			_ = closeErr
-		}
-	}()
 
-	// jpeg.Encode has a fast path for *image.YCbCr and *image.Gray that writes
-	// the image directly without per-pixel color conversion. goheif.Decode
-	// always returns *image.YCbCr, so pass it straight through in that case
-	// and only fall back to an RGBA conversion for other color models (e.g.
-	// ones with an alpha channel that needs to be composited away).
-	encodeImg := img
-	switch img.(type) {
-	case *image.YCbCr, *image.Gray:
-		// Already directly encodable by jpeg.Encode; no conversion needed.
-	default:
-		encodeImg = convertToRGBA(img)
+	result := &Result{OutputPath: outputPath, EXIF: meta.EXIF != nil}
+	if options.ExportAux {
+		var auxWarnings []string
+		result.AuxOutputPaths, auxWarnings = exportAuxiliaryImages(file, options.ItemID, outputPath, options.AutoOrient)
+		warnings = append(warnings, auxWarnings...)
 	}
+	result.Warnings = warnings
+	return result, nil
+}
 
-	// Encode as JPEG into a buffer so an EXIF segment can be spliced in
-	// right after the SOI marker.
-	var buf bytes.Buffer
-	opts := &jpeg.Options{Quality: JPEGQuality}
-	if err := jpeg.Encode(&buf, encodeImg, opts); err != nil {
-		return fmt.Errorf("JPEGファイルのエンコードに失敗しました: %w", err)
+// decodeItem decodes the image item itemID of the HEIC file in ra, or its
+// primary image if itemID is 0 or the primary item's ID.
+func decodeItem(ra io.ReaderAt, itemID uint32) (image.Image, error) {
+	hf := heif.Open(ra)
+	if itemID != 0 {
+		primary, err := hf.PrimaryItem()
+		if err != nil || primary.ID != itemID {
+			item, err := imageItem(hf, itemID)
+			if err != nil {
+				return nil, err
+			}
+			return decodeImageItem(hf, item)
+		}
 	}
+	// goheif.Decode reads through io.ReaderAt when available.
+	return goheif.Decode(io.NewSectionReader(ra, 0, math.MaxInt64))
+}
 
-	if err := writeJPEGWithEXIF(outFile, buf.Bytes(), exifSegment); err != nil {
-		return fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
+// extractEXIF returns the EXIF payload of the HEIC file in ra, rebuilt by
+// exif.RebuildEXIF with opts so that malformed tags written by some cameras
+// do not corrupt the block in the output file. A file without EXIF yields
+// nil and no warnings. If the payload cannot be rebuilt, it is returned
+// unchanged, unless opts.Filter is set: tags it removes must never reach
+// the output, so the EXIF data is dropped instead.
+func extractEXIF(ra io.ReaderAt, opts exif.RebuildOptions) ([]byte, []string) {
+	exifData, err := goheif.ExtractExif(ra)
+	if err != nil {
+		if errors.Is(err, heif.ErrNoEXIF) {
+			return nil, nil
+		}
+		return nil, []string{fmt.Sprintf("EXIF情報の抽出に失敗しました: %v", err)}
+	}
+	if len(exifData) == 0 {
+		return nil, nil
 	}
 
-	return nil
+	rebuilt, err := exif.RebuildEXIF(exifData, opts)
+	if err != nil && opts.Filter != nil {
+		return nil, []string{fmt.Sprintf("EXIF情報から指定したタグを削除できなかったため、EXIF情報を埋め込まずに変換します: %v", err)}
+	}
+	if err != nil {
+		return exifData, []string{fmt.Sprintf("EXIF情報の再構築に失敗したため、元のEXIF情報をそのまま埋め込みます: %v", err)}
+	}
+	return rebuilt, nil
 }
 
-// writeJPEGWithEXIF writes JPEG data to w, inserting exifSegment (a complete
-// APP1 marker segment, or nil) immediately after the leading SOI marker.
-func writeJPEGWithEXIF(w *os.File, jpegData []byte, exifSegment []byte) error {
-	if len(exifSegment) == 0 {
-		_, err := w.Write(jpegData)
-		return err
+// shrinkGroupLabels are the names of the tag groups removed by
+// exif.ShrinkEXIF in warnings.
+var shrinkGroupLabels = map[exif.TagGroup]string{
+	exif.TagGroupThumbnail: "サムネイル",
+	exif.TagGroupMakerNote: "メーカーノート",
+}
+
+// fitEXIFSegment returns exifData shrunk by exif.ShrinkEXIF to fit in a
+// single JPEG APP1 segment, with a warning naming what was removed. If it
+// cannot be made to fit, the EXIF data is dropped with a warning.
+func fitEXIFSegment(exifData []byte) ([]byte, []string) {
+	if len(exifData) <= maxEXIFSegmentPayload {
+		return exifData, nil
 	}
 
+	shrunk, removals, err := exif.ShrinkEXIF(exifData, maxEXIFSegmentPayload)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("EXIF情報（%dバイト）がJPEGに埋め込める上限（%dバイト）を超えているため、EXIF情報を埋め込まずに変換します: %v", len(exifData), maxEXIFSegmentPayload, err)}
+	}
+	removed := make([]string, 0, len(removals))
+	for _, r := range removals {
+		removed = append(removed, fmt.Sprintf("%s（%dバイト）", shrinkGroupLabels[r.Group], r.Size))
+	}
+	return shrunk, []string{fmt.Sprintf("EXIF情報（%dバイト）がJPEGに埋め込める上限（%dバイト）を超えているため、%sを削除して埋め込みます", len(exifData), maxEXIFSegmentPayload, strings.Join(removed, "・"))}
+}
+
+// writeJPEGWithSegments writes JPEG data to w, inserting segments (complete
+// marker segments, such as the EXIF APP1 and ICC APP2 segments; nil entries
+// are skipped) in order immediately after the leading SOI marker.
+func writeJPEGWithSegments(w io.Writer, jpegData []byte, segments ...[]byte) error {
 	// jpegData always starts with the 2-byte SOI marker (0xFFD8).
 	if _, err := w.Write(jpegData[:2]); err != nil {
 		return err
 	}
-	if _, err := w.Write(exifSegment); err != nil {
-		return err
+	for _, segment := range segments {
+		if _, err := w.Write(segment); err != nil {
+			return err
+		}
 	}
 	_, err := w.Write(jpegData[2:])
 	return err
@@ -145,80 +483,101 @@ func writeJPEGWithEXIF(w *os.File, jpegData []byte, exifSegment []byte) error {
 // length + payload) embedding the given EXIF payload. The payload is
 // expected to already carry the "Exif\0\0" marker, as returned by
 // goheif.ExtractExif. Returns nil if there is no usable EXIF data or the
-// payload is too large to fit in a single APP1 segment.
+// payload is too large to fit in a single APP1 segment; ConvertHEIC shrinks
+// such payloads beforehand with fitEXIFSegment.
 func buildEXIFAPP1Segment(exifData []byte) []byte {
 	if len(exifData) == 0 || len(exifData) > maxEXIFSegmentPayload {
 		return nil
 	}
 
-	length := len(exifData) + 2 // length field covers itself
+	return buildAPP1Segment(exifData)
+}
+
+// buildAPP1Segment builds a complete JPEG APP1 marker segment whose payload
+// is the concatenation of parts. The caller ensures that the payload fits.
+func buildAPP1Segment(parts ...[]byte) []byte {
+	length := 2 // length field covers itself
+	for _, part := range parts {
+		length += len(part)
+	}
 	segment := make([]byte, 0, length+2)
 	segment = append(segment, 0xFF, jpegAPP1Marker)
 	segment = append(segment, byte(length>>8), byte(length&0xFF))
-	segment = append(segment, exifData...)
+	for _, part := range parts {
+		segment = append(segment, part...)
+	}
 	return segment
 }
 
+// ParseBackground parses a --background color given as "#RRGGBB", "#RGB"
+// (the "#" is optional) or one of the names "white" and "black".
+func ParseBackground(s string) (color.RGBA, error) {
+	switch strings.ToLower(s) {
+	case "", "white":
+		return DefaultBackground, nil
+	case "black":
+		return color.RGBA{A: 0xFF}, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	var r, g, b uint8
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("背景色の形式が正しくありません: %s（例: #FFFFFF, white, black）", s)
+	}
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return color.RGBA{}, fmt.Errorf("背景色の形式が正しくありません: %s（例: #FFFFFF, white, black）", s)
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 0xFF}, nil
+}
+
 // convertToRGBA converts an image to RGBA format.
 // Handles color spaces that jpeg.Encode cannot write directly (RGBA, NRGBA,
 // and other generic image.Image implementations), notably ones with an
-// alpha channel that needs to be composited away.
+// alpha channel that needs to be composited onto background.
 //
-// goheif.Decode never actually returns these types -- it always decodes to
-// *image.YCbCr (or *image.Gray), regardless of the source HEIC's real color
-// space or alpha channel, since goheif reads no alpha/auxiliary image data
-// at all. This function (and its alpha compositing) is therefore unreachable
-// from ConvertHEICToJPEG today; see docs/requirements.md REQ-010 and
-// https://github.com/sugiyan97/heic-image-converter-cli/issues/50. It is
-// kept, and unit-tested directly, in case a future goheif release or
-// alternate decode path produces these color models.
-func convertToRGBA(img image.Image) image.Image {
+// goheif.Decode itself always decodes to *image.YCbCr (or *image.Gray) and
+// reads no alpha data; images with an alpha plane reach this function as
+// *image.NRGBA after attachAlpha has merged in the HEIF auxiliary alpha
+// image. *image.RGBA is only produced for opaque images and is returned
+// unchanged.
+func convertToRGBA(img image.Image, background color.RGBA) image.Image {
 	switch src := img.(type) {
 	case *image.RGBA:
 		// Already RGBA, return as is
 		return src
 	case *image.NRGBA:
 		// Convert NRGBA to RGBA
-		return convertNRGBAToRGBA(src)
+		return convertNRGBAToRGBA(src, background)
 	default:
 		// Generic conversion for other types
-		return convertGenericToRGBA(img)
+		return convertGenericToRGBA(img, background)
 	}
 }
 
-// convertNRGBAToRGBA converts NRGBA to RGBA
-func convertNRGBAToRGBA(src *image.NRGBA) *image.RGBA {
+// convertNRGBAToRGBA converts NRGBA to RGBA, compositing translucent
+// pixels onto background
+func convertNRGBAToRGBA(src *image.NRGBA, background color.RGBA) *image.RGBA {
 	bounds := src.Bounds()
 	dst := image.NewRGBA(bounds)
+	bg := [3]uint32{uint32(background.R), uint32(background.G), uint32(background.B)}
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
 			srcIdx := src.PixOffset(x, y)
 			dstIdx := dst.PixOffset(x, y)
 
-			r := uint32(src.Pix[srcIdx+0])
-			g := uint32(src.Pix[srcIdx+1])
-			b := uint32(src.Pix[srcIdx+2])
 			a := uint32(src.Pix[srcIdx+3])
-
-			// Premultiply alpha
-			if a < 255 {
-				r = r * a / 255
-				g = g * a / 255
-				b = b * a / 255
-			}
-
-			// Composite on white background if alpha < 255
-			if a < 255 {
-				alpha := 255 - a
-				r = r + alpha
-				g = g + alpha
-				b = b + alpha
+			for c := 0; c < 3; c++ {
+				v := uint32(src.Pix[srcIdx+c])
+				// Composite on the background if alpha < 255
+				if a < 255 {
+					v = (v*a + bg[c]*(255-a) + 127) / 255
+				}
+				dst.Pix[dstIdx+c] = uint8(v)
 			}
-
-			dst.Pix[dstIdx+0] = uint8(r)
-			dst.Pix[dstIdx+1] = uint8(g)
-			dst.Pix[dstIdx+2] = uint8(b)
 			dst.Pix[dstIdx+3] = 255
 		}
 	}
@@ -227,33 +586,30 @@ func convertNRGBAToRGBA(src *image.NRGBA) *image.RGBA {
 }
 
 // convertGenericToRGBA converts any image type to RGBA
-// Handles alpha channel by compositing on white background
-func convertGenericToRGBA(img image.Image) *image.RGBA {
+// Handles alpha channel by compositing on background
+func convertGenericToRGBA(img image.Image, background color.RGBA) *image.RGBA {
 	bounds := img.Bounds()
 	dst := image.NewRGBA(bounds)
+	bg := [3]float64{float64(background.R), float64(background.G), float64(background.B)}
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			// Scale from 16-bit to 8-bit
-			r8 := uint8(r >> 8)
-			g8 := uint8(g >> 8)
-			b8 := uint8(b >> 8)
-			a8 := uint8(a >> 8)
-
-			// Composite on white background if alpha < 255
-			if a8 < 255 {
-				alpha := float64(a8) / 255.0
-				white := 255.0
-				r8 = uint8(float64(r8)*alpha + white*(1.0-alpha))
-				g8 = uint8(float64(g8)*alpha + white*(1.0-alpha))
-				b8 = uint8(float64(b8)*alpha + white*(1.0-alpha))
+			// Non-premultiplied 8-bit values
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb := [3]uint8{c.R, c.G, c.B}
+
+			// Composite on the background if alpha < 255
+			if c.A < 255 {
+				alpha := float64(c.A) / 255.0
+				for i := range rgb {
+					rgb[i] = uint8(float64(rgb[i])*alpha + bg[i]*(1.0-alpha) + 0.5)
+				}
 			}
 
 			dst.SetRGBA(x, y, color.RGBA{
-				R: r8,
-				G: g8,
-				B: b8,
+				R: rgb[0],
+				G: rgb[1],
+				B: rgb[2],
 				A: 255,
 			})
 		}
@@ -264,7 +620,32 @@ func convertGenericToRGBA(img image.Image) *image.RGBA {
 
 // GenerateOutputPath generates the output JPEG file path from input HEIC path
 func GenerateOutputPath(inputPath string) string {
+	return GenerateOutputPathForFormat(inputPath, FormatJPEG)
+}
+
+// MirrorOutputPath generates the output file path for inputPath under
+// outputDir, mirroring inputPath's location relative to sourceRoot. For
+// example, sourceRoot/a/b.HEIC maps to outputDir/a/b.jpg.
+func MirrorOutputPath(inputPath, sourceRoot, outputDir string, format Format) (string, error) {
+	rel, err := filepath.Rel(sourceRoot, inputPath)
+	if err != nil {
+		return "", fmt.Errorf("出力パスを決定できませんでした: %w", err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("入力ファイルが変換元ディレクトリの外にあります: %s", inputPath)
+	}
+	return filepath.Join(outputDir, GenerateOutputPathForFormat(rel, format)), nil
+}
+
+// GenerateOutputPathForFormat generates the output file path for format from
+// input HEIC path, replacing the source extension with the encoder's.
+func GenerateOutputPathForFormat(inputPath string, format Format) string {
 	ext := filepath.Ext(inputPath)
 	basePath := strings.TrimSuffix(inputPath, ext)
-	return basePath + ".jpg"
+
+	encoder, err := NewEncoder(format, ConvertOptions{})
+	if err != nil {
+		encoder = jpegEncoder{}
+	}
+	return basePath + encoder.Extension()
 }
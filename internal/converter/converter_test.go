@@ -2,6 +2,7 @@ package converter
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
@@ -11,6 +12,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
 )
 
 // setupTestFile copies the test HEIC file to a temporary directory
@@ -181,6 +186,67 @@ func TestGenerateOutputPath(t *testing.T) {
 	}
 }
 
+// TestMirrorOutputPath tests mirrored output path generation under an
+// output directory
+func TestMirrorOutputPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		input      string
+		sourceRoot string
+		format     Format
+		expected   string
+		wantErr    bool
+	}{
+		{"Top level", "/src/a.HEIC", "/src", FormatJPEG, "/out/a.jpg", false},
+		{"Nested", "/src/2024/05/a.heic", "/src", FormatJPEG, "/out/2024/05/a.jpg", false},
+		{"PNG", "/src/x/a.HEIC", "/src", FormatPNG, "/out/x/a.png", false},
+		{"Outside root", "/other/a.HEIC", "/src", FormatJPEG, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := MirrorOutputPath(filepath.FromSlash(tt.input), filepath.FromSlash(tt.sourceRoot), filepath.FromSlash("/out"), tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MirrorOutputPath failed: %v", err)
+			}
+			if got != filepath.FromSlash(tt.expected) {
+				t.Errorf("MirrorOutputPath(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestConvertHEIC_OutputPath verifies that options.OutputPath is honored and
+// that missing parent directories are created.
+func TestConvertHEIC_OutputPath(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	outputPath := filepath.Join(filepath.Dir(heicFile), "out", "nested", "photo.jpg")
+	result, err := ConvertHEIC(heicFile, ConvertOptions{OutputPath: outputPath})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if result.OutputPath != outputPath {
+		t.Errorf("Result.OutputPath = %q, want %q", result.OutputPath, outputPath)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if _, err := os.Stat(GenerateOutputPath(heicFile)); !os.IsNotExist(err) {
+		t.Error("No output should be written next to the source when OutputPath is set")
+	}
+}
+
 // TestConvertToRGBA_TC01001 tests TC-010-01, TC-010-02, TC-010-03, TC-010-04: Color space conversion
 // Note: These tests verify the conversion functions work correctly for different color spaces
 // Actual HEIC files with specific color spaces would be needed for complete testing
@@ -232,7 +298,7 @@ func TestConvertToRGBA_TC01001(t *testing.T) {
 	}
 
 	// Verify image can be converted to RGBA
-	rgbaImg := convertToRGBA(img)
+	rgbaImg := convertToRGBA(img, DefaultBackground)
 	if rgbaImg == nil {
 		t.Fatal("convertToRGBA returned nil")
 	}
@@ -262,6 +328,105 @@ func TestJPEGQuality(t *testing.T) {
 	}
 }
 
+// TestConvertHEICToJPEG_Quality verifies that ConvertOptions.Quality is
+// passed through to the JPEG encoder: a lower quality must produce a smaller
+// file than the default.
+func TestConvertHEICToJPEG_Quality(t *testing.T) {
+	t.Parallel()
+
+	sizeAt := func(quality int) int64 {
+		heicFile, cleanup := setupTestFile(t)
+		defer cleanup()
+
+		options := ConvertOptions{RemoveEXIF: true, Quality: quality}
+		if err := ConvertHEICToJPEG(heicFile, options); err != nil {
+			t.Fatalf("Conversion with Quality=%d failed: %v", quality, err)
+		}
+
+		info, err := os.Stat(GenerateOutputPath(heicFile))
+		if err != nil {
+			t.Fatalf("Failed to stat output file: %v", err)
+		}
+		return info.Size()
+	}
+
+	defaultSize := sizeAt(0)
+	lowSize := sizeAt(30)
+	if lowSize >= defaultSize {
+		t.Errorf("Expected Quality=30 output (%d bytes) to be smaller than default quality output (%d bytes)", lowSize, defaultSize)
+	}
+}
+
+// TestConvertHEICToJPEG_InvalidQuality verifies that an out-of-range
+// quality is rejected before any output file is written.
+func TestConvertHEICToJPEG_InvalidQuality(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	for _, q := range []int{-1, 101} {
+		if err := ConvertHEICToJPEG(heicFile, ConvertOptions{Quality: q}); err == nil {
+			t.Errorf("Expected error for Quality=%d, got nil", q)
+		}
+	}
+
+	if _, err := os.Stat(GenerateOutputPath(heicFile)); !os.IsNotExist(err) {
+		t.Error("Output file should not be created for an invalid quality")
+	}
+}
+
+// TestQualityForPreset tests preset name resolution
+func TestQualityForPreset(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		preset   string
+		expected int
+		wantErr  bool
+	}{
+		{"Web", "web", 75, false},
+		{"Balanced", "balanced", 85, false},
+		{"Archive", "archive", JPEGQuality, false},
+		{"Case insensitive", "WEB", 75, false},
+		{"Unknown", "print", 0, true},
+		{"Empty", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			q, err := QualityForPreset(tt.preset)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("QualityForPreset(%q) expected error, got %d", tt.preset, q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QualityForPreset(%q) failed: %v", tt.preset, err)
+			}
+			if q != tt.expected {
+				t.Errorf("QualityForPreset(%q) = %d, want %d", tt.preset, q, tt.expected)
+			}
+		})
+	}
+}
+
+// TestValidateQuality tests the accepted quality range
+func TestValidateQuality(t *testing.T) {
+	t.Parallel()
+	for _, q := range []int{MinJPEGQuality, 50, MaxJPEGQuality} {
+		if err := ValidateQuality(q); err != nil {
+			t.Errorf("ValidateQuality(%d) returned unexpected error: %v", q, err)
+		}
+	}
+	for _, q := range []int{0, -5, MaxJPEGQuality + 1} {
+		if err := ValidateQuality(q); err == nil {
+			t.Errorf("ValidateQuality(%d) expected error, got nil", q)
+		}
+	}
+}
+
 // exifMarker is the byte sequence that marks the start of an EXIF payload
 // inside a JPEG APP1 segment ("Exif\0\0").
 var exifMarker = []byte{'E', 'x', 'i', 'f', 0x00, 0x00}
@@ -364,6 +529,163 @@ func TestConvertOptions_RemoveEXIFTakesEffect(t *testing.T) {
 	})
 }
 
+// TestConvertHEIC_EXIFSinglePass verifies that the converter alone produces
+// a JPEG whose single EXIF segment is fully parseable, without any
+// post-processing of the output file.
+func TestConvertHEIC_EXIFSinglePass(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", result.Warnings)
+	}
+	if !result.EXIF {
+		t.Error("Expected Result.EXIF to report the carried over EXIF data")
+	}
+
+	outputData, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if n := bytes.Count(outputData, exifMarker); n != 1 {
+		t.Errorf("Expected exactly one EXIF marker, found %d", n)
+	}
+
+	rawExif, err := exifv3.SearchAndExtractExif(outputData)
+	if err != nil {
+		t.Fatalf("EXIF not found in output: %v", err)
+	}
+	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		t.Fatalf("Embedded EXIF is not parseable: %v", err)
+	}
+	found := false
+	for _, entry := range entries {
+		if entry.TagName == "Make" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected Make tag in embedded EXIF")
+	}
+}
+
+// TestConvertHEIC_EXIFFilter verifies that the tags removed by
+// ConvertOptions.EXIFFilter are missing from the output while the rest of
+// the EXIF data is carried over.
+func TestConvertHEIC_EXIFFilter(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	filter, err := exif.NewTagFilter([]string{"gps", "makernote"}, nil)
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+	result, err := ConvertHEIC(heicFile, ConvertOptions{EXIFFilter: filter})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if !result.EXIF {
+		t.Error("Expected Result.EXIF to report the carried over EXIF data")
+	}
+
+	outputData, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	tags, err := exif.ReadTags(outputData)
+	if err != nil {
+		t.Fatalf("Embedded EXIF is not parseable: %v", err)
+	}
+	var hasMake bool
+	for _, tag := range tags {
+		switch {
+		case tag.Name == "Make":
+			hasMake = true
+		case tag.IFD == "IFD0/GPSInfo", tag.Name == "GPSTag", tag.Name == "MakerNote":
+			t.Errorf("Expected %s to be removed", tag.Name)
+		}
+	}
+	if !hasMake {
+		t.Error("Expected Make tag in embedded EXIF")
+	}
+}
+
+// TestExtractEXIF_NoEXIF verifies that a HEIC file without EXIF yields no
+// data and no warnings
+func TestExtractEXIF_NoEXIF(t *testing.T) {
+	t.Parallel()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", "test_no_exif.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	exifData, warnings := extractEXIF(file, exif.RebuildOptions{})
+	if exifData != nil || len(warnings) != 0 {
+		t.Errorf("extractEXIF() = %d bytes, %v; want nil, no warnings", len(exifData), warnings)
+	}
+}
+
+// TestFitEXIFSegment verifies that EXIF data too large for an APP1 segment
+// is shrunk with a warning naming what was removed, or dropped if it
+// cannot fit
+func TestFitEXIFSegment(t *testing.T) {
+	t.Parallel()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		t.Fatalf("NewIfdMappingWithStandard failed: %v", err)
+	}
+	ti := exifv3.NewTagIndex()
+
+	// build encodes EXIF data with a description and a thumbnail of the
+	// given sizes.
+	build := func(description, thumbnail int) []byte {
+		rootIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, binary.BigEndian)
+		if err := rootIb.AddStandardWithName("ImageDescription", strings.Repeat("x", description)); err != nil {
+			t.Fatalf("Failed to add ImageDescription: %v", err)
+		}
+		ifd1Ib := exifv3.NewIfdBuilder(im, ti, exifcommon.Ifd1StandardIfdIdentity, binary.BigEndian)
+		if err := ifd1Ib.SetThumbnail(bytes.Repeat([]byte{0xA5}, thumbnail)); err != nil {
+			t.Fatalf("SetThumbnail failed: %v", err)
+		}
+		if err := rootIb.SetNextIb(ifd1Ib); err != nil {
+			t.Fatalf("SetNextIb failed: %v", err)
+		}
+		encoded, err := exifv3.NewIfdByteEncoder().EncodeToExif(rootIb)
+		if err != nil {
+			t.Fatalf("EncodeToExif failed: %v", err)
+		}
+		return append([]byte("Exif\x00\x00"), encoded...)
+	}
+
+	small := build(10, 1000)
+	if fitted, warnings := fitEXIFSegment(small); !bytes.Equal(fitted, small) || len(warnings) != 0 {
+		t.Errorf("fitEXIFSegment() = %d bytes, %v; want the data unchanged", len(fitted), warnings)
+	}
+
+	fitted, warnings := fitEXIFSegment(build(10, 70000))
+	if buildEXIFAPP1Segment(fitted) == nil {
+		t.Errorf("Shrunk EXIF data (%d bytes) does not fit in an APP1 segment", len(fitted))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "サムネイル") || strings.Contains(warnings[0], "メーカーノート") {
+		t.Errorf("Expected a warning naming the thumbnail only, got %v", warnings)
+	}
+
+	fitted, warnings = fitEXIFSegment(build(70000, 1000))
+	if fitted != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "埋め込まずに") {
+		t.Errorf("fitEXIFSegment() = %d bytes, %v; want nil and a warning", len(fitted), warnings)
+	}
+}
+
 // TestConvertToRGBA_RGBAPassthrough tests TD-005 / TC-010-01: convertToRGBA's
 // *image.RGBA branch, which returns the source image unchanged. This is the
 // one dispatch branch in convertToRGBA that TestConvertToRGBA_TC01001 doesn't
@@ -376,7 +698,7 @@ func TestConvertToRGBA_RGBAPassthrough(t *testing.T) {
 	src := image.NewRGBA(bounds)
 	src.SetRGBA(5, 5, color.RGBA{R: 10, G: 20, B: 30, A: 255})
 
-	result := convertToRGBA(src)
+	result := convertToRGBA(src, DefaultBackground)
 
 	rgba, ok := result.(*image.RGBA)
 	if !ok {
@@ -407,7 +729,7 @@ func TestConvertNRGBAToRGBA(t *testing.T) {
 	}
 
 	// Convert to RGBA
-	rgba := convertNRGBAToRGBA(nrgba)
+	rgba := convertNRGBAToRGBA(nrgba, DefaultBackground)
 
 	// Verify dimensions
 	if rgba.Bounds() != bounds {
@@ -477,7 +799,7 @@ func TestConvertGenericToRGBA(t *testing.T) {
 	}
 
 	// Convert using generic function
-	rgba := convertGenericToRGBA(nrgba)
+	rgba := convertGenericToRGBA(nrgba, DefaultBackground)
 
 	// Verify dimensions
 	if rgba.Bounds() != bounds {
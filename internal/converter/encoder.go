@@ -0,0 +1,251 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/tiff"
+)
+
+// Format identifies an output image format.
+type Format string
+
+const (
+	// FormatJPEG is the default output format.
+	FormatJPEG Format = "jpeg"
+	// FormatPNG is lossless PNG output.
+	FormatPNG Format = "png"
+	// FormatTIFF is lossless (Deflate-compressed) TIFF output.
+	FormatTIFF Format = "tiff"
+)
+
+// Metadata carries source metadata that an Encoder may embed alongside the
+// pixels. Each encoder embeds whatever its container format supports and
+// silently drops the rest.
+type Metadata struct {
+	// EXIF is the EXIF payload including its leading "Exif\0\0" marker, as
+	// returned by goheif.ExtractExif, or nil if there is none.
+	EXIF []byte
+	// ICC is the source image's ICC color profile, or nil if there is none.
+	ICC []byte
+	// XMP is the XMP packet describing the source image, or nil if there is
+	// none.
+	XMP []byte
+}
+
+// Encoder writes a decoded image in a specific output format.
+type Encoder interface {
+	// Format returns the format this encoder produces.
+	Format() Format
+	// Extension returns the output file extension, including the leading dot.
+	Extension() string
+	// Encode writes img to w, embedding the parts of meta the format supports.
+	Encode(w io.Writer, img image.Image, meta Metadata) error
+}
+
+// ParseFormat parses a --format value. Aliases such as "jpg" and "tif" are
+// accepted, and matching is case-insensitive.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "png":
+		return FormatPNG, nil
+	case "tif", "tiff":
+		return FormatTIFF, nil
+	case "webp", "avif":
+		// golang.org/x/image only ships decoders for these, and the available
+		// encoders all require an additional C library.
+		return "", fmt.Errorf("%s形式への変換は未対応です（純粋なGoのエンコーダが存在しないため）", strings.ToUpper(s))
+	default:
+		return "", fmt.Errorf("不明な出力形式です: %s（指定可能: jpeg, png, tiff）", s)
+	}
+}
+
+// NewEncoder returns the Encoder for format, configured from options.
+func NewEncoder(format Format, options ConvertOptions) (Encoder, error) {
+	switch format {
+	case "", FormatJPEG:
+		return jpegEncoder{quality: options.jpegQuality(), background: options.background()}, nil
+	case FormatPNG:
+		return pngEncoder{}, nil
+	case FormatTIFF:
+		return tiffEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("不明な出力形式です: %s", format)
+	}
+}
+
+// jpegEncoder encodes baseline JPEG, embedding EXIF and XMP as APP1
+// segments and the ICC profile as APP2 segments. Transparent pixels are
+// composited onto background.
+type jpegEncoder struct {
+	quality    int
+	background color.RGBA
+}
+
+func (jpegEncoder) Format() Format    { return FormatJPEG }
+func (jpegEncoder) Extension() string { return ".jpg" }
+
+func (e jpegEncoder) Encode(w io.Writer, img image.Image, meta Metadata) error {
+	// jpeg.Encode has a fast path for *image.YCbCr and *image.Gray that writes
+	// the image directly without per-pixel color conversion. goheif.Decode
+	// always returns *image.YCbCr, so pass it straight through in that case
+	// and only fall back to an RGBA conversion for other color models (e.g.
+	// the *image.NRGBA of images with an alpha channel, which needs to be
+	// composited away).
+	encodeImg := img
+	switch img.(type) {
+	case *image.YCbCr, *image.Gray:
+		// Already directly encodable by jpeg.Encode; no conversion needed.
+	default:
+		encodeImg = convertToRGBA(img, e.background)
+	}
+
+	// Encode as JPEG into a buffer so the metadata segments can be spliced
+	// in right after the SOI marker.
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, encodeImg, &jpeg.Options{Quality: e.quality}); err != nil {
+		return fmt.Errorf("JPEGファイルのエンコードに失敗しました: %w", err)
+	}
+
+	segments := append([][]byte{buildEXIFAPP1Segment(meta.EXIF)}, buildXMPAPP1Segments(meta.XMP)...)
+	segments = append(segments, buildICCAPP2Segments(meta.ICC)...)
+	if err := writeJPEGWithSegments(w, buf.Bytes(), segments...); err != nil {
+		return fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// pngEncoder encodes lossless PNG, keeping the alpha channel and embedding
+// EXIF as an eXIf chunk, XMP as an iTXt chunk and the ICC profile as an
+// iCCP chunk.
+type pngEncoder struct{}
+
+func (pngEncoder) Format() Format    { return FormatPNG }
+func (pngEncoder) Extension() string { return ".png" }
+
+func (pngEncoder) Encode(w io.Writer, img image.Image, meta Metadata) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, toDirectlyEncodable(img)); err != nil {
+		return fmt.Errorf("PNGファイルのエンコードに失敗しました: %w", err)
+	}
+
+	if err := writePNGWithMetadata(w, buf.Bytes(), meta); err != nil {
+		return fmt.Errorf("PNGファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// tiffEncoder encodes Deflate-compressed TIFF, keeping the alpha channel.
+// golang.org/x/image/tiff has no way to write extra IFD entries, so neither
+// EXIF and XMP metadata nor the ICC profile is carried over (see
+// droppedMetadata).
+type tiffEncoder struct{}
+
+func (tiffEncoder) Format() Format    { return FormatTIFF }
+func (tiffEncoder) Extension() string { return ".tiff" }
+
+func (tiffEncoder) Encode(w io.Writer, img image.Image, _ Metadata) error {
+	opts := &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+	if err := tiff.Encode(w, toDirectlyEncodable(img), opts); err != nil {
+		return fmt.Errorf("TIFFファイルのエンコードに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// droppedMetadata returns the names of the parts of meta that encoders of
+// format cannot embed and drop, for warning the user.
+func droppedMetadata(format Format, meta Metadata) []string {
+	if format != FormatTIFF {
+		return nil
+	}
+	var dropped []string
+	if len(meta.EXIF) > 0 {
+		dropped = append(dropped, "EXIF情報")
+	}
+	if len(meta.XMP) > 0 {
+		dropped = append(dropped, "XMP")
+	}
+	if len(meta.ICC) > 0 {
+		dropped = append(dropped, "ICCプロファイル")
+	}
+	return dropped
+}
+
+// toDirectlyEncodable converts img into a color model that the PNG and TIFF
+// encoders write without per-pixel interface calls. The YCbCr images that
+// goheif produces would otherwise go through the generic image.At path,
+// which is several times slower on full-resolution photos.
+func toDirectlyEncodable(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.Gray:
+		return img
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// pngSignatureAndIHDRSize is the length of the 8-byte PNG signature plus
+// the IHDR chunk (4-byte length, 4-byte type, 13-byte body, 4-byte CRC)
+// that image/png always writes first.
+const pngSignatureAndIHDRSize = 8 + 4 + 4 + 13 + 4
+
+// writePNGWithMetadata writes PNG data to w, inserting an iCCP chunk
+// carrying meta.ICC, an eXIf chunk carrying meta.EXIF and an iTXt chunk
+// carrying meta.XMP right after the IHDR chunk. The PNG eXIf chunk holds
+// the bare TIFF structure, so the "Exif\0\0" marker is stripped first.
+func writePNGWithMetadata(w io.Writer, pngData []byte, meta Metadata) error {
+	var chunks [][]byte
+	if len(meta.ICC) > 0 {
+		data, err := buildICCPChunkData(meta.ICC)
+		if err != nil {
+			return fmt.Errorf("ICCプロファイルの圧縮に失敗しました: %w", err)
+		}
+		chunks = append(chunks, buildPNGChunk("iCCP", data))
+	}
+	if tiffData := bytes.TrimPrefix(meta.EXIF, exifHeader); len(tiffData) > 0 {
+		chunks = append(chunks, buildPNGChunk("eXIf", tiffData))
+	}
+	if len(meta.XMP) > 0 {
+		chunks = append(chunks, buildPNGChunk("iTXt", buildXMPITXtChunkData(meta.XMP)))
+	}
+	if len(chunks) == 0 || len(pngData) < pngSignatureAndIHDRSize {
+		_, err := w.Write(pngData)
+		return err
+	}
+
+	if _, err := w.Write(pngData[:pngSignatureAndIHDRSize]); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(pngData[pngSignatureAndIHDRSize:])
+	return err
+}
+
+// buildPNGChunk builds a complete PNG chunk (length + type + data + CRC).
+func buildPNGChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(data)))
+	copy(chunk[4:8], chunkType)
+	chunk = append(chunk, data...)
+
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	return binary.BigEndian.AppendUint32(chunk, crc)
+}
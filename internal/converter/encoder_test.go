@@ -0,0 +1,227 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// TestParseFormat tests --format value parsing and aliases
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected Format
+		wantErr  bool
+	}{
+		{"", FormatJPEG, false},
+		{"jpeg", FormatJPEG, false},
+		{"JPG", FormatJPEG, false},
+		{"png", FormatPNG, false},
+		{"tif", FormatTIFF, false},
+		{"TIFF", FormatTIFF, false},
+		{"webp", "", true},
+		{"avif", "", true},
+		{"gif", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseFormat(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFormat(%q) expected error, got %q", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFormat(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGenerateOutputPathForFormat tests the per-format output extension
+func TestGenerateOutputPathForFormat(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		format   Format
+		expected string
+	}{
+		{"/path/to/test.HEIC", FormatJPEG, "/path/to/test.jpg"},
+		{"/path/to/test.HEIC", FormatPNG, "/path/to/test.png"},
+		{"/path/to/test.heif", FormatTIFF, "/path/to/test.tiff"},
+		{"test.HEIC", "", "test.jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := GenerateOutputPathForFormat(tt.input, tt.format); got != tt.expected {
+			t.Errorf("GenerateOutputPathForFormat(%q, %q) = %q, want %q", tt.input, tt.format, got, tt.expected)
+		}
+	}
+}
+
+// TestConvertHEIC_PNG verifies lossless PNG output, including EXIF carried
+// over as an eXIf chunk unless RemoveEXIF is set.
+func TestConvertHEIC_PNG(t *testing.T) {
+	t.Parallel()
+
+	for _, removeEXIF := range []bool{false, true} {
+		heicFile, cleanup := setupTestFile(t)
+		defer cleanup()
+
+		result, err := ConvertHEIC(heicFile, ConvertOptions{Format: FormatPNG, RemoveEXIF: removeEXIF})
+		if err != nil {
+			t.Fatalf("Conversion to PNG failed: %v", err)
+		}
+		if filepath.Ext(result.OutputPath) != ".png" {
+			t.Errorf("Expected .png output path, got %s", result.OutputPath)
+		}
+
+		data, err := os.ReadFile(result.OutputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+
+		// png.Decode verifies every chunk's CRC, including the eXIf chunk.
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output file is not a valid PNG: %v", err)
+		}
+		if img.Bounds().Dx() <= 0 || img.Bounds().Dy() <= 0 {
+			t.Errorf("Invalid image dimensions: %v", img.Bounds())
+		}
+
+		hasEXIF := bytes.Contains(data, []byte("eXIf"))
+		if hasEXIF == removeEXIF {
+			t.Errorf("RemoveEXIF=%v: eXIf chunk present=%v", removeEXIF, hasEXIF)
+		}
+	}
+}
+
+// TestConvertHEIC_TIFF verifies TIFF output decodes correctly
+func TestConvertHEIC_TIFF(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{Format: FormatTIFF})
+	if err != nil {
+		t.Fatalf("Conversion to TIFF failed: %v", err)
+	}
+	if result.OutputPath != GenerateOutputPathForFormat(heicFile, FormatTIFF) {
+		t.Errorf("Unexpected output path: %s", result.OutputPath)
+	}
+
+	file, err := os.Open(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err := tiff.Decode(file); err != nil {
+		t.Fatalf("Output file is not a valid TIFF: %v", err)
+	}
+
+	// The sample file has EXIF data and an ICC profile, which TIFF drops.
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "EXIF情報・ICCプロファイル") {
+		t.Errorf("Expected a warning about the dropped metadata, got %v", result.Warnings)
+	}
+}
+
+// TestDroppedMetadata verifies that only the TIFF encoder drops metadata,
+// and only the parts that are present
+func TestDroppedMetadata(t *testing.T) {
+	t.Parallel()
+	meta := Metadata{EXIF: []byte("Exif\x00\x00"), XMP: []byte("<x:xmpmeta/>"), ICC: []byte{0}}
+
+	tests := []struct {
+		format Format
+		meta   Metadata
+		want   []string
+	}{
+		{FormatJPEG, meta, nil},
+		{FormatPNG, meta, nil},
+		{FormatTIFF, meta, []string{"EXIF情報", "XMP", "ICCプロファイル"}},
+		{FormatTIFF, Metadata{ICC: meta.ICC}, []string{"ICCプロファイル"}},
+		{FormatTIFF, Metadata{}, nil},
+	}
+	for _, tt := range tests {
+		if got := droppedMetadata(tt.format, tt.meta); !slices.Equal(got, tt.want) {
+			t.Errorf("droppedMetadata(%s) = %v, want %v", tt.format, got, tt.want)
+		}
+	}
+}
+
+// TestConvertHEICToJPEG_IgnoresFormat verifies that ConvertHEICToJPEG
+// always writes JPEG regardless of options.Format.
+func TestConvertHEICToJPEG_IgnoresFormat(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	if err := ConvertHEICToJPEG(heicFile, ConvertOptions{Format: FormatPNG}); err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if _, err := os.Stat(GenerateOutputPath(heicFile)); err != nil {
+		t.Errorf("Expected JPEG output: %v", err)
+	}
+	if _, err := os.Stat(GenerateOutputPathForFormat(heicFile, FormatPNG)); !os.IsNotExist(err) {
+		t.Error("ConvertHEICToJPEG should not write PNG output")
+	}
+}
+
+// TestWritePNGWithEXIF verifies eXIf chunk placement and that the "Exif\0\0"
+// marker is stripped from the chunk payload.
+func TestWritePNGWithEXIF(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	src.SetNRGBA(1, 1, color.NRGBA{R: 200, A: 255})
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, src); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	tiffPayload := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	var out bytes.Buffer
+	if err := writePNGWithMetadata(&out, pngBuf.Bytes(), Metadata{EXIF: append(append([]byte{}, exifHeader...), tiffPayload...)}); err != nil {
+		t.Fatalf("writePNGWithMetadata failed: %v", err)
+	}
+
+	data := out.Bytes()
+	chunk := data[pngSignatureAndIHDRSize:]
+	if string(chunk[4:8]) != "eXIf" {
+		t.Fatalf("Expected eXIf chunk right after IHDR, got %q", chunk[4:8])
+	}
+	if !bytes.Equal(chunk[8:8+len(tiffPayload)], tiffPayload) {
+		t.Errorf("eXIf payload = %q, want %q", chunk[8:8+len(tiffPayload)], tiffPayload)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("PNG with eXIf chunk failed to decode: %v", err)
+	}
+
+	// Without EXIF the PNG passes through untouched.
+	out.Reset()
+	if err := writePNGWithMetadata(&out, pngBuf.Bytes(), Metadata{}); err != nil {
+		t.Fatalf("writePNGWithMetadata failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), pngBuf.Bytes()) {
+		t.Error("Expected PNG without EXIF to be written unchanged")
+	}
+}
@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/adrium/goheif/heif"
+)
+
+const (
+	// jpegAPP2Marker is the JPEG marker used for ICC profile segments.
+	jpegAPP2Marker = 0xE2
+
+	// maxICCChunkSize is the largest slice of an ICC profile that fits in a
+	// single APP2 segment after the "ICC_PROFILE\0" marker and the 2-byte
+	// sequence number / chunk count.
+	maxICCChunkSize = maxEXIFSegmentPayload - len(iccSegmentMarker) - 2
+
+	// maxICCChunks is the largest chunk count expressible in the 1-byte
+	// chunk count field of an APP2 ICC segment.
+	maxICCChunks = 255
+
+	// iccSegmentMarker prefixes every JPEG APP2 ICC profile segment.
+	iccSegmentMarker = "ICC_PROFILE\x00"
+
+	// pngICCProfileName is the profile name written to PNG iCCP chunks.
+	pngICCProfileName = "ICC Profile"
+
+	// iccColorSpaceRGB and iccColorSpaceGray are the data colour space
+	// signatures (header bytes 16-19) of RGB and grayscale profiles.
+	iccColorSpaceRGB  = "RGB "
+	iccColorSpaceGray = "GRAY"
+)
+
+// readICCProfile returns the ICC profile attached to the image item itemID
+// (0 for the primary image) of the HEIC file in ra through a colr property,
+// or nil if the image has none (e.g. it only carries an nclx color
+// description).
+func readICCProfile(ra io.ReaderAt, itemID uint32) ([]byte, error) {
+	item, err := imageItem(heif.Open(ra), itemID)
+	if err != nil {
+		return nil, err
+	}
+	return iccProfileFromItem(item)
+}
+
+// iccProfileFromItem returns the ICC profile from the item's colr property.
+// goheif does not parse colr boxes, so the raw box body is read: a 4-byte
+// colour_type followed, for "prof" (restricted) and "rICC" (unrestricted)
+// profiles, by the ICC profile itself.
+func iccProfileFromItem(item *heif.Item) ([]byte, error) {
+	for _, p := range item.Properties {
+		if !p.Type().EqualString("colr") {
+			continue
+		}
+		raw, ok := p.(interface{ Body() io.Reader })
+		if !ok {
+			continue
+		}
+		body, err := io.ReadAll(raw.Body())
+		if err != nil {
+			return nil, fmt.Errorf("ICCプロファイルの読み込みに失敗しました: %w", err)
+		}
+		if len(body) < 4 {
+			continue
+		}
+		switch string(body[:4]) {
+		case "prof", "rICC":
+			return body[4:], nil
+		}
+	}
+	return nil, nil
+}
+
+// iccColorSpace returns the data colour space signature of an ICC profile,
+// such as iccColorSpaceRGB, or "" if the profile is too short to have one.
+func iccColorSpace(icc []byte) string {
+	if len(icc) < 20 {
+		return ""
+	}
+	return string(icc[16:20])
+}
+
+// matchICCProfile returns img and icc adjusted so that the profile can be
+// embedded with the pixels: PNG and JPEG only allow a grayscale profile
+// with grayscale pixels and an RGB profile with color pixels. A grayscale
+// image with an RGB profile is expanded to RGBA to keep the profile; any
+// other mismatched profile is dropped, and ok is false.
+func matchICCProfile(img image.Image, icc []byte) (_ image.Image, _ []byte, ok bool) {
+	if icc == nil {
+		return img, nil, true
+	}
+	gray, isGray := img.(*image.Gray)
+	switch cs := iccColorSpace(icc); {
+	case cs == iccColorSpaceGray && isGray, cs == iccColorSpaceRGB && !isGray:
+		return img, icc, true
+	case cs == iccColorSpaceRGB && isGray:
+		bounds := gray.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), gray, bounds.Min, draw.Src)
+		return rgba, icc, true
+	default:
+		return img, nil, false
+	}
+}
+
+// buildICCAPP2Segments builds the JPEG APP2 marker segments (marker +
+// length + payload) that embed an ICC profile, splitting it into chunks as
+// described by the ICC specification (Annex B.4). Returns nil if there is no
+// profile or it is too large to be split into 255 segments.
+func buildICCAPP2Segments(icc []byte) [][]byte {
+	count := (len(icc) + maxICCChunkSize - 1) / maxICCChunkSize
+	if count == 0 || count > maxICCChunks {
+		return nil
+	}
+
+	segments := make([][]byte, 0, count)
+	for seq := 1; seq <= count; seq++ {
+		chunk := icc[(seq-1)*maxICCChunkSize : min(seq*maxICCChunkSize, len(icc))]
+
+		length := 2 + len(iccSegmentMarker) + 2 + len(chunk) // length field covers itself
+		segment := make([]byte, 0, length+2)
+		segment = append(segment, 0xFF, jpegAPP2Marker)
+		segment = append(segment, byte(length>>8), byte(length&0xFF))
+		segment = append(segment, iccSegmentMarker...)
+		segment = append(segment, byte(seq), byte(count))
+		segment = append(segment, chunk...)
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// buildICCPChunkData builds the body of a PNG iCCP chunk: the profile name,
+// a null separator, the compression method (0, zlib) and the compressed
+// profile.
+func buildICCPChunkData(icc []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(pngICCProfileName)
+	buf.Write([]byte{0x00, 0x00})
+
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(icc); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,247 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestICCProfile returns the ICC profile of a file in test_images
+func readTestICCProfile(t *testing.T, name string) []byte {
+	t.Helper()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", name))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	icc, err := readICCProfile(file, 0)
+	if err != nil {
+		t.Fatalf("readICCProfile failed: %v", err)
+	}
+	return icc
+}
+
+// jpegICCProfile reassembles the ICC profile from the APP2 segments of a
+// JPEG file, in sequence-number order
+func jpegICCProfile(t *testing.T, data []byte) []byte {
+	t.Helper()
+	chunks := map[int][]byte{}
+	count := 0
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] != 0xDA; {
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		payload := data[pos+4 : pos+2+length]
+		if data[pos+1] == jpegAPP2Marker && bytes.HasPrefix(payload, []byte(iccSegmentMarker)) {
+			seq := int(payload[len(iccSegmentMarker)])
+			count = int(payload[len(iccSegmentMarker)+1])
+			chunks[seq] = payload[len(iccSegmentMarker)+2:]
+		}
+		pos += 2 + length
+	}
+
+	if len(chunks) != count {
+		t.Fatalf("Found %d ICC chunks, want %d", len(chunks), count)
+	}
+	var icc []byte
+	for seq := 1; seq <= count; seq++ {
+		icc = append(icc, chunks[seq]...)
+	}
+	return icc
+}
+
+func TestReadICCProfile(t *testing.T) {
+	t.Parallel()
+	icc := readTestICCProfile(t, "test.HEIC")
+	// The profile header starts with the profile size and carries the
+	// "acsp" signature at offset 36.
+	if len(icc) < 128 {
+		t.Fatalf("Expected an ICC profile, got %d bytes", len(icc))
+	}
+	if size := binary.BigEndian.Uint32(icc[0:4]); int(size) != len(icc) {
+		t.Errorf("Profile header size = %d, got %d bytes", size, len(icc))
+	}
+	if string(icc[36:40]) != "acsp" {
+		t.Error("Expected the ICC profile signature 'acsp'")
+	}
+}
+
+// TestBuildICCAPP2Segments verifies that large profiles are split across
+// numbered APP2 segments that each fit in a JPEG marker segment
+func TestBuildICCAPP2Segments(t *testing.T) {
+	t.Parallel()
+
+	icc := make([]byte, 2*maxICCChunkSize+100)
+	for i := range icc {
+		icc[i] = byte(i)
+	}
+	segments := buildICCAPP2Segments(icc)
+	if len(segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %d", len(segments))
+	}
+
+	var jpegData []byte
+	jpegData = append(jpegData, 0xFF, 0xD8)
+	for i, segment := range segments {
+		if segment[0] != 0xFF || segment[1] != jpegAPP2Marker {
+			t.Errorf("Segment %d has marker %X%X", i, segment[0], segment[1])
+		}
+		if length := int(segment[2])<<8 | int(segment[3]); length != len(segment)-2 || length > 0xFFFF {
+			t.Errorf("Segment %d has length field %d for %d bytes", i, length, len(segment))
+		}
+		jpegData = append(jpegData, segment...)
+	}
+	jpegData = append(jpegData, 0xFF, 0xDA)
+
+	if got := jpegICCProfile(t, jpegData); !bytes.Equal(got, icc) {
+		t.Error("Reassembled profile does not match the original")
+	}
+
+	if segments := buildICCAPP2Segments(nil); segments != nil {
+		t.Errorf("Expected no segments without a profile, got %d", len(segments))
+	}
+	if segments := buildICCAPP2Segments(make([]byte, maxICCChunks*maxICCChunkSize+1)); segments != nil {
+		t.Errorf("Expected no segments for an oversized profile, got %d", len(segments))
+	}
+}
+
+func TestConvertHEIC_ICCProfile(t *testing.T) {
+	t.Parallel()
+	want := readTestICCProfile(t, "test.HEIC")
+
+	tests := []struct {
+		name    string
+		options ConvertOptions
+	}{
+		{"with EXIF", ConvertOptions{}},
+		{"without EXIF", ConvertOptions{RemoveEXIF: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			heicFile, cleanup := setupTestFile(t)
+			defer cleanup()
+
+			result, err := ConvertHEIC(heicFile, tt.options)
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("Unexpected warnings: %v", result.Warnings)
+			}
+
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if got := jpegICCProfile(t, data); !bytes.Equal(got, want) {
+				t.Errorf("Embedded profile is %d bytes, want the %d-byte source profile", len(got), len(want))
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("Output JPEG failed to decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestConvertHEIC_ICCProfilePNG(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{Format: FormatPNG, RemoveEXIF: true})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	chunk := data[pngSignatureAndIHDRSize:]
+	if string(chunk[4:8]) != "iCCP" {
+		t.Fatalf("Expected iCCP chunk right after IHDR, got %q", chunk[4:8])
+	}
+	if !bytes.HasPrefix(chunk[8:], []byte(pngICCProfileName+"\x00\x00")) {
+		t.Error("Expected the iCCP chunk to start with the profile name and compression method")
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("PNG with iCCP chunk failed to decode: %v", err)
+	}
+}
+
+func TestMatchICCProfile(t *testing.T) {
+	t.Parallel()
+	rgbProfile := readTestICCProfile(t, "test.HEIC")
+	if cs := iccColorSpace(rgbProfile); cs != iccColorSpaceRGB {
+		t.Fatalf("Expected the test profile to be RGB, got %q", cs)
+	}
+	grayProfile := bytes.Clone(rgbProfile)
+	copy(grayProfile[16:20], iccColorSpaceGray)
+
+	gray := image.NewGray(image.Rect(2, 3, 6, 8))
+	gray.SetGray(2, 3, color.Gray{Y: 200})
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		icc      []byte
+		wantICC  bool
+		wantOK   bool
+		wantRGBA bool
+	}{
+		{"no profile", gray, nil, false, true, false},
+		{"gray image with gray profile", gray, grayProfile, true, true, false},
+		{"gray image with RGB profile", gray, rgbProfile, true, true, true},
+		{"color image with RGB profile", ycbcr, rgbProfile, true, true, false},
+		{"color image with gray profile", ycbcr, grayProfile, false, false, false},
+		{"truncated profile", ycbcr, rgbProfile[:16], false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			img, icc, ok := matchICCProfile(tt.img, tt.icc)
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if (icc != nil) != tt.wantICC {
+				t.Errorf("profile kept = %v, want %v", icc != nil, tt.wantICC)
+			}
+			rgba, isRGBA := img.(*image.RGBA)
+			if isRGBA != tt.wantRGBA {
+				t.Fatalf("Expected RGBA = %v, got %T", tt.wantRGBA, img)
+			}
+			if !isRGBA {
+				if img != tt.img {
+					t.Error("Expected the image to be returned unchanged")
+				}
+				return
+			}
+			if rgba.Bounds().Dx() != gray.Bounds().Dx() || rgba.Bounds().Dy() != gray.Bounds().Dy() {
+				t.Errorf("Expected size %v, got %v", gray.Bounds().Size(), rgba.Bounds().Size())
+			}
+			if got := rgba.RGBAAt(0, 0); got != (color.RGBA{R: 200, G: 200, B: 200, A: 255}) {
+				t.Errorf("Expected the gray pixel to be copied, got %v", got)
+			}
+
+			// The expanded image must be written as a color PNG so that the
+			// RGB profile in its iCCP chunk is valid.
+			var buf bytes.Buffer
+			if err := (pngEncoder{}).Encode(&buf, rgba, Metadata{ICC: icc}); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if colorType := buf.Bytes()[25]; colorType&2 == 0 {
+				t.Errorf("Expected a color PNG, got color type %d", colorType)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+	"github.com/adrium/goheif/libde265"
+	xdraw "golang.org/x/image/draw"
+)
+
+// ItemRole describes what an item is used for within a HEIF file.
+type ItemRole string
+
+const (
+	// RolePrimary is the primary image (pitm).
+	RolePrimary ItemRole = "primary"
+	// RoleImage is a further full image, such as a frame of a burst or an
+	// image collection.
+	RoleImage ItemRole = "image"
+	// RoleThumbnail is a thumbnail of another image (thmb reference).
+	RoleThumbnail ItemRole = "thumbnail"
+	// RoleAuxiliary is an auxiliary image such as an alpha plane or depth
+	// map (auxl reference).
+	RoleAuxiliary ItemRole = "auxiliary"
+	// RoleTile is a tile of a grid image.
+	RoleTile ItemRole = "tile"
+	// RoleDerived is a derived image other than a grid, such as an HDR
+	// tone map (tmap) or an overlay (iovl).
+	RoleDerived ItemRole = "derived"
+	// RoleMetadata is a metadata item such as EXIF or XMP.
+	RoleMetadata ItemRole = "metadata"
+)
+
+// metadataItemTypes are the item types that carry metadata rather than
+// pixels.
+var metadataItemTypes = map[string]bool{
+	"Exif": true,
+	"mime": true,
+	"uri ": true,
+}
+
+// ImageItem describes an item of a HEIF file, as listed by ListItems.
+type ImageItem struct {
+	ID uint32
+	// Type is the item type, e.g. "hvc1", "grid" or "Exif".
+	Type string
+	// Width and Height are the dimensions from the ispe property, or 0 for
+	// items without one.
+	Width, Height int
+	Role          ItemRole
+	// AuxType is the aux_type URN of auxiliary images.
+	AuxType string
+	// Hidden reports whether the item is marked as not intended to be
+	// displayed on its own.
+	Hidden bool
+}
+
+// IsTopLevel reports whether the item is a full image that can be
+// converted on its own: the primary image or another visible image that is
+// not a thumbnail, auxiliary image, tile or derived image of another item.
+func (it ImageItem) IsTopLevel() bool {
+	return (it.Role == RolePrimary || it.Role == RoleImage) && !it.Hidden
+}
+
+// ListItems returns every item of the HEIF file at inputPath in the order
+// of its iinf box, with the role each item plays.
+func ListItems(inputPath string) ([]ImageItem, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルを開けませんでした: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hf := heif.Open(file)
+	primary, err := hf.PrimaryItem()
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+	ids, err := heifItemIDs(file)
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+
+	heifItems := make([]*heif.Item, len(ids))
+	tiles := make(map[uint32]bool)
+	for i, id := range ids {
+		item, err := hf.ItemByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+		}
+		heifItems[i] = item
+		if dimg := item.Reference("dimg"); dimg != nil && item.Info.ItemType == "grid" {
+			for _, tile := range dimg.ToItemIDs {
+				tiles[tile] = true
+			}
+		}
+	}
+
+	items := make([]ImageItem, len(heifItems))
+	for i, item := range heifItems {
+		it := ImageItem{
+			ID:     item.ID,
+			Type:   item.Info.ItemType,
+			Hidden: item.Info.Flags&1 != 0,
+		}
+		it.Width, it.Height, _ = item.SpatialExtents()
+		switch {
+		case item.ID == primary.ID:
+			it.Role = RolePrimary
+		case item.Reference("auxl") != nil:
+			it.Role = RoleAuxiliary
+			it.AuxType = auxiliaryType(item)
+		case item.Reference("thmb") != nil:
+			it.Role = RoleThumbnail
+		case tiles[item.ID]:
+			it.Role = RoleTile
+		case metadataItemTypes[it.Type]:
+			it.Role = RoleMetadata
+		case item.Reference("dimg") != nil && it.Type != "grid":
+			it.Role = RoleDerived
+		default:
+			it.Role = RoleImage
+		}
+		items[i] = it
+	}
+	return items, nil
+}
+
+// TopLevelImages returns the top-level images among items (see
+// ImageItem.IsTopLevel), with the primary image first.
+func TopLevelImages(items []ImageItem) []ImageItem {
+	var images []ImageItem
+	for _, it := range items {
+		if !it.IsTopLevel() {
+			continue
+		}
+		if it.Role == RolePrimary {
+			images = append([]ImageItem{it}, images...)
+		} else {
+			images = append(images, it)
+		}
+	}
+	return images
+}
+
+// NumberedOutputPath returns outputPath with "_NN" (the 1-based number n,
+// zero-padded to two digits) inserted before its extension, as used for
+// the images of a multi-image file.
+func NumberedOutputPath(outputPath string, n int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s_%02d%s", strings.TrimSuffix(outputPath, ext), n, ext)
+}
+
+// imageItem returns the item with id, or the primary item if id is 0.
+func imageItem(hf *heif.File, id uint32) (*heif.Item, error) {
+	var item *heif.Item
+	var err error
+	if id == 0 {
+		item, err = hf.PrimaryItem()
+	} else {
+		item, err = hf.ItemByID(id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+	return item, nil
+}
+
+// decodeImageItem decodes an hvc1 or grid item. goheif only decodes the
+// primary image, so other items are decoded here along the same lines. The
+// result is an *image.YCbCr, or an *image.Gray for monochrome streams.
+func decodeImageItem(hf *heif.File, item *heif.Item) (image.Image, error) {
+	dec, err := libde265.NewDecoder(libde265.WithSafeEncoding(goheif.SafeEncoding))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Free()
+
+	switch item.Info.ItemType {
+	case "hvc1":
+		return decodeHEVCTile(dec, hf, item)
+	case "grid":
+		return decodeHEVCGrid(dec, hf, item)
+	default:
+		return nil, fmt.Errorf("対応していない画像形式です: %s", item.Info.ItemType)
+	}
+}
+
+// decodeHEVCTile decodes a single hvc1 item into a newly allocated image.
+func decodeHEVCTile(dec *libde265.Decoder, hf *heif.File, item *heif.Item) (image.Image, error) {
+	hvcc, ok := item.HevcConfig()
+	if !ok {
+		return nil, fmt.Errorf("hvcCプロパティがありません")
+	}
+	data, err := hf.GetItemData(item)
+	if err != nil {
+		return nil, err
+	}
+
+	dec.Reset()
+	if err := dec.Push(hvcc.AsHeader()); err != nil {
+		return nil, err
+	}
+	tile, err := dec.DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	ycc, ok := tile.(*image.YCbCr)
+	if !ok {
+		return nil, fmt.Errorf("デコード結果が想定外の形式です: %T", tile)
+	}
+
+	// Copy the planes, since the decoder may reuse its buffers.
+	rect := image.Rect(0, 0, ycc.Rect.Dx(), ycc.Rect.Dy())
+	if len(ycc.Cb) == 0 {
+		// Monochrome (4:0:0) streams have no chroma planes.
+		out := image.NewGray(rect)
+		for y := 0; y < rect.Dy(); y++ {
+			copy(out.Pix[y*out.Stride:(y+1)*out.Stride], ycc.Y[y*ycc.YStride:])
+		}
+		return out, nil
+	}
+	out := image.NewYCbCr(rect, ycc.SubsampleRatio)
+	copyYCbCr(out, image.Point{}, ycc)
+	return out, nil
+}
+
+// decodeHEVCGrid decodes the tiles of a grid item and stitches them
+// together, cropped to the grid's output size.
+func decodeHEVCGrid(dec *libde265.Decoder, hf *heif.File, item *heif.Item) (image.Image, error) {
+	data, err := hf.GetItemData(item)
+	if err != nil {
+		return nil, err
+	}
+	// ImageGrid: version, flags, rows_minus_one, columns_minus_one, then the
+	// output width and height as 16-bit, or 32-bit if (flags & 1).
+	if len(data) < 8 || (data[1]&1 != 0 && len(data) < 12) {
+		return nil, fmt.Errorf("gridの形式が正しくありません")
+	}
+	rows, columns := int(data[2])+1, int(data[3])+1
+	var width, height int
+	if data[1]&1 != 0 {
+		width = int(data[4])<<24 | int(data[5])<<16 | int(data[6])<<8 | int(data[7])
+		height = int(data[8])<<24 | int(data[9])<<16 | int(data[10])<<8 | int(data[11])
+	} else {
+		width = int(data[4])<<8 | int(data[5])
+		height = int(data[6])<<8 | int(data[7])
+	}
+
+	dimg := item.Reference("dimg")
+	if dimg == nil || len(dimg.ToItemIDs) != rows*columns {
+		return nil, fmt.Errorf("gridのタイル数が正しくありません")
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	var out image.Image
+	for i, id := range dimg.ToItemIDs {
+		tileItem, err := hf.ItemByID(id)
+		if err != nil {
+			return nil, err
+		}
+		tile, err := decodeHEVCTile(dec, hf, tileItem)
+		if err != nil {
+			return nil, err
+		}
+		size := tile.Bounds().Size()
+		origin := image.Pt(i%columns*size.X, i/columns*size.Y)
+
+		switch tile := tile.(type) {
+		case *image.YCbCr:
+			if out == nil {
+				out = image.NewYCbCr(rect, tile.SubsampleRatio)
+			}
+			dst, ok := out.(*image.YCbCr)
+			if !ok || dst.SubsampleRatio != tile.SubsampleRatio {
+				return nil, fmt.Errorf("gridのタイルの形式が一致しません")
+			}
+			copyYCbCr(dst, origin, tile)
+		case *image.Gray:
+			if out == nil {
+				out = image.NewGray(rect)
+			}
+			dst, ok := out.(*image.Gray)
+			if !ok {
+				return nil, fmt.Errorf("gridのタイルの形式が一致しません")
+			}
+			xdraw.Copy(dst, origin, tile, tile.Rect, xdraw.Src, nil)
+		}
+	}
+	return out, nil
+}
+
+// copyYCbCr copies src into dst with its top-left corner at origin,
+// clipped to dst. Both images must share a subsampling ratio, and origin
+// must be aligned to the chroma sample grid.
+func copyYCbCr(dst *image.YCbCr, origin image.Point, src *image.YCbCr) {
+	w := min(src.Rect.Dx(), dst.Rect.Dx()-origin.X)
+	h := min(src.Rect.Dy(), dst.Rect.Dy()-origin.Y)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	for y := 0; y < h; y++ {
+		copy(dst.Y[dst.YOffset(origin.X, origin.Y+y):][:w], src.Y[y*src.YStride:])
+	}
+
+	// Horizontal and vertical chroma subsampling factors.
+	hs, vs := 1, 1
+	switch src.SubsampleRatio {
+	case image.YCbCrSubsampleRatio420:
+		hs, vs = 2, 2
+	case image.YCbCrSubsampleRatio422:
+		hs = 2
+	case image.YCbCrSubsampleRatio440:
+		vs = 2
+	case image.YCbCrSubsampleRatio411:
+		hs = 4
+	case image.YCbCrSubsampleRatio410:
+		hs, vs = 4, 2
+	}
+	cw, ch := (w+hs-1)/hs, (h+vs-1)/vs
+	for y := 0; y < ch; y++ {
+		i := dst.COffset(origin.X, origin.Y+y*vs)
+		copy(dst.Cb[i:i+cw], src.Cb[y*src.CStride:])
+		copy(dst.Cr[i:i+cw], src.Cr[y*src.CStride:])
+	}
+}
@@ -0,0 +1,210 @@
+package converter
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+)
+
+// test.HEIC item IDs
+const (
+	testPrimaryItemID   = 46
+	testThumbnailItemID = 47
+	// testGainMapItemID is the HDR gain map, the only item described by the
+	// file's XMP packet.
+	testGainMapItemID = 63
+)
+
+func TestListItems(t *testing.T) {
+	t.Parallel()
+	items, err := ListItems(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+
+	want := map[uint32]ImageItem{
+		46: {ID: 46, Type: "grid", Width: 5712, Height: 4284, Role: RolePrimary},
+		47: {ID: 47, Type: "hvc1", Width: 416, Height: 312, Role: RoleThumbnail},
+		63: {ID: 63, Type: "grid", Width: 2856, Height: 2142, Role: RoleAuxiliary, AuxType: appleGainMapType, Hidden: true},
+		64: {ID: 64, Type: "mime", Role: RoleMetadata, Hidden: true},
+		66: {ID: 66, Type: "tmap", Width: 4284, Height: 5712, Role: RoleDerived},
+		67: {ID: 67, Type: "Exif", Role: RoleMetadata, Hidden: true},
+	}
+	tiles := 0
+	for _, it := range items {
+		if it.Role == RoleTile {
+			tiles++
+			continue
+		}
+		if it != want[it.ID] {
+			t.Errorf("Item %d = %+v, want %+v", it.ID, it, want[it.ID])
+		}
+		delete(want, it.ID)
+	}
+	if len(want) != 0 {
+		t.Errorf("Missing items: %v", want)
+	}
+	// The primary image and the gain map are grids of 45 and 15 tiles.
+	if tiles != 60 {
+		t.Errorf("Found %d tiles, want 60", tiles)
+	}
+
+	top := TopLevelImages(items)
+	if len(top) != 1 || top[0].ID != testPrimaryItemID {
+		t.Errorf("TopLevelImages = %+v, want only the primary image", top)
+	}
+}
+
+func TestTopLevelImages(t *testing.T) {
+	t.Parallel()
+	items := []ImageItem{
+		{ID: 1, Role: RoleImage},
+		{ID: 2, Role: RoleTile},
+		{ID: 3, Role: RolePrimary},
+		{ID: 4, Role: RoleImage, Hidden: true},
+		{ID: 5, Role: RoleThumbnail},
+		{ID: 6, Role: RoleImage},
+	}
+	var got []uint32
+	for _, it := range TopLevelImages(items) {
+		got = append(got, it.ID)
+	}
+	if len(got) != 3 || got[0] != 3 || got[1] != 1 || got[2] != 6 {
+		t.Errorf("TopLevelImages IDs = %v, want [3 1 6]", got)
+	}
+}
+
+func TestNumberedOutputPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		path string
+		n    int
+		want string
+	}{
+		{filepath.Join("out", "IMG_0001.jpg"), 1, filepath.Join("out", "IMG_0001_01.jpg")},
+		{"burst.png", 12, "burst_12.png"},
+		{"burst.tiff", 100, "burst_100.tiff"},
+	}
+	for _, tt := range tests {
+		if got := NumberedOutputPath(tt.path, tt.n); got != tt.want {
+			t.Errorf("NumberedOutputPath(%q, %d) = %q, want %q", tt.path, tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestDecodeImageItem checks that the grid decoder stitches the primary
+// image of test.HEIC exactly as goheif does
+func TestDecodeImageItem(t *testing.T) {
+	t.Parallel()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hf := heif.Open(file)
+	primary, err := hf.PrimaryItem()
+	if err != nil {
+		t.Fatalf("Failed to read primary item: %v", err)
+	}
+	got, err := decodeImageItem(hf, primary)
+	if err != nil {
+		t.Fatalf("decodeImageItem failed: %v", err)
+	}
+	want, err := goheif.Decode(file)
+	if err != nil {
+		t.Fatalf("goheif.Decode failed: %v", err)
+	}
+
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("Bounds = %v, want %v", got.Bounds(), want.Bounds())
+	}
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += 97 {
+		for x := b.Min.X; x < b.Max.X; x += 89 {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("Pixel (%d, %d) = %v, want %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+func TestConvertHEIC_ItemID(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                  string
+		itemID                uint32
+		autoOrient            bool
+		wantWidth, wantHeight int
+	}{
+		{"thumbnail", testThumbnailItemID, false, 416, 312},
+		{"thumbnail auto-orient", testThumbnailItemID, true, 312, 416},
+		{"primary by ID", testPrimaryItemID, false, 5712, 4284},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			heicFile, cleanup := setupTestFile(t)
+			defer cleanup()
+
+			result, err := ConvertHEIC(heicFile, ConvertOptions{ItemID: tt.itemID, AutoOrient: tt.autoOrient})
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("Unexpected warnings: %v", result.Warnings)
+			}
+
+			f, err := os.Open(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to open output file: %v", err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			config, err := jpeg.DecodeConfig(f)
+			if err != nil {
+				t.Fatalf("Output is not a valid JPEG: %v", err)
+			}
+			if config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+				t.Errorf("Output is %dx%d, want %dx%d", config.Width, config.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+	if _, err := ConvertHEIC(heicFile, ConvertOptions{ItemID: 9999}); err == nil {
+		t.Error("Expected an error for a missing item")
+	}
+}
+
+// TestCopyYCbCr checks that chroma samples land at the tile's position in
+// a 4:2:0 image and that tiles are clipped to the destination
+func TestCopyYCbCr(t *testing.T) {
+	t.Parallel()
+	tile := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	for i := range tile.Y {
+		tile.Y[i] = 200
+	}
+	for i := range tile.Cb {
+		tile.Cb[i], tile.Cr[i] = 50, 60
+	}
+
+	dst := image.NewYCbCr(image.Rect(0, 0, 6, 6), image.YCbCrSubsampleRatio420)
+	copyYCbCr(dst, image.Pt(4, 4), tile)
+
+	if got := dst.YCbCrAt(5, 5); got.Y != 200 || got.Cb != 50 || got.Cr != 60 {
+		t.Errorf("Copied pixel = %v", got)
+	}
+	if got := dst.YCbCrAt(3, 3); got.Y != 0 || got.Cb != 0 {
+		t.Errorf("Pixel outside the tile = %v, want zero", got)
+	}
+}
@@ -0,0 +1,209 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrium/goheif"
+)
+
+// unknownNameValue is substituted for placeholders whose value is not
+// available (e.g. {model} for a file without EXIF data).
+const unknownNameValue = "unknown"
+
+// placeholderPattern matches a single {name} placeholder in a name template.
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// NameFields holds the per-file values a NameTemplate can reference.
+type NameFields struct {
+	// Stem is the input file name without its extension.
+	Stem string
+	// Index is the 1-based position of the input within the batch.
+	Index int
+	// DateTime is the capture time (EXIF DateTimeOriginal), or the zero
+	// time if unknown.
+	DateTime time.Time
+	// Make and Model are the camera make and model from EXIF.
+	Make  string
+	Model string
+	// Width and Height are the image dimensions in pixels, or zero if unknown.
+	Width  int
+	Height int
+}
+
+// namePlaceholders maps each supported placeholder to the function that
+// renders it, and records whether it needs metadata beyond the file name.
+var namePlaceholders = map[string]struct {
+	render        func(NameFields) string
+	needsMetadata bool
+}{
+	"stem":  {func(f NameFields) string { return f.Stem }, false},
+	"index": {func(f NameFields) string { return strconv.Itoa(f.Index) }, false},
+	"date": {func(f NameFields) string {
+		if f.DateTime.IsZero() {
+			return ""
+		}
+		return f.DateTime.Format("2006-01-02")
+	}, true},
+	"time": {func(f NameFields) string {
+		if f.DateTime.IsZero() {
+			return ""
+		}
+		return f.DateTime.Format("150405")
+	}, true},
+	"make":  {func(f NameFields) string { return f.Make }, true},
+	"model": {func(f NameFields) string { return f.Model }, true},
+	"width": {func(f NameFields) string {
+		if f.Width <= 0 {
+			return ""
+		}
+		return strconv.Itoa(f.Width)
+	}, true},
+	"height": {func(f NameFields) string {
+		if f.Height <= 0 {
+			return ""
+		}
+		return strconv.Itoa(f.Height)
+	}, true},
+}
+
+// NameTemplate renders output file names (without extension) from a
+// template such as "{date}_{time}_{model}".
+type NameTemplate struct {
+	raw           string
+	needsMetadata bool
+}
+
+// ParseNameTemplate parses and validates a --name-template value.
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("ファイル名テンプレートが空です")
+	}
+	if strings.ContainsAny(s, `/\`) {
+		return nil, fmt.Errorf("ファイル名テンプレートにパス区切り文字は使用できません: %s", s)
+	}
+
+	t := &NameTemplate{raw: s}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(s, -1) {
+		p, ok := namePlaceholders[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("不明なプレースホルダーです: %s（指定可能: %s）", m[0], strings.Join(NamePlaceholders(), ", "))
+		}
+		t.needsMetadata = t.needsMetadata || p.needsMetadata
+	}
+
+	// Any brace left over after removing the placeholders is unbalanced.
+	if strings.ContainsAny(placeholderPattern.ReplaceAllString(s, ""), "{}") {
+		return nil, fmt.Errorf("ファイル名テンプレートの括弧が対応していません: %s", s)
+	}
+	return t, nil
+}
+
+// NamePlaceholders returns the supported placeholders, e.g. "{stem}", in
+// sorted order.
+func NamePlaceholders() []string {
+	names := make([]string, 0, len(namePlaceholders))
+	for name := range namePlaceholders {
+		names = append(names, "{"+name+"}")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NeedsMetadata reports whether rendering the template requires EXIF data
+// or image dimensions, so callers can skip reading them otherwise.
+func (t *NameTemplate) NeedsMetadata() bool {
+	return t.needsMetadata
+}
+
+// Render returns the file name (without extension) for fields. Substituted
+// values have whitespace removed and characters that are invalid in file
+// names replaced, and missing values render as "unknown".
+func (t *NameTemplate) Render(fields NameFields) string {
+	return placeholderPattern.ReplaceAllStringFunc(t.raw, func(m string) string {
+		value := sanitizeNameValue(namePlaceholders[m[1:len(m)-1]].render(fields))
+		if value == "" {
+			return unknownNameValue
+		}
+		return value
+	})
+}
+
+// sanitizeNameValue makes a placeholder value safe to use in a file name on
+// every supported platform.
+func sanitizeNameValue(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == ' ' || r == '\t':
+			// "iPhone 15 Pro" -> "iPhone15Pro"
+		case r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ReadImageSize returns the dimensions of the primary image in a HEIC file
+// without decoding its pixels.
+func ReadImageSize(inputPath string) (width, height int, err error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("HEICファイルを開けませんでした: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	config, err := goheif.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
+
+// ApplyNameTemplate replaces the file name of outputPath with the name
+// rendered from t, keeping its directory and extension.
+func ApplyNameTemplate(outputPath string, t *NameTemplate, fields NameFields) string {
+	return filepath.Join(filepath.Dir(outputPath), t.Render(fields)+filepath.Ext(outputPath))
+}
+
+// OutputPlanner hands out output paths for a batch, renaming any path that
+// an earlier input of the same batch has already claimed so that two inputs
+// never overwrite each other's output.
+type OutputPlanner struct {
+	claimed map[string]bool
+}
+
+// NewOutputPlanner returns an empty OutputPlanner.
+func NewOutputPlanner() *OutputPlanner {
+	return &OutputPlanner{claimed: make(map[string]bool)}
+}
+
+// Claim reserves outputPath and returns it, or, if it was already claimed,
+// the first free variant with a "_1", "_2", ... suffix before the
+// extension. Paths are compared case-insensitively because the default
+// file systems on macOS and Windows are case-insensitive.
+func (p *OutputPlanner) Claim(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+
+	candidate := outputPath
+	for n := 1; p.claimed[plannerKey(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	p.claimed[plannerKey(candidate)] = true
+	return candidate
+}
+
+func plannerKey(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseNameTemplate tests --name-template validation
+func TestParseNameTemplate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		input        string
+		wantMetadata bool
+		wantErr      bool
+	}{
+		{"Stem only", "{stem}", false, false},
+		{"Stem and index", "{stem}_{index}", false, false},
+		{"Archive style", "{date}_{time}_{model}", true, false},
+		{"Dimensions", "{stem}_{width}x{height}", true, false},
+		{"Literal only", "photo", false, false},
+		{"Empty", "", false, true},
+		{"Unknown placeholder", "{stem}_{camera}", false, true},
+		{"Unbalanced brace", "{stem", false, true},
+		{"Path separator", "{date}/{stem}", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl, err := ParseNameTemplate(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseNameTemplate(%q) expected error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNameTemplate(%q) unexpected error: %v", tt.input, err)
+			}
+			if tmpl.NeedsMetadata() != tt.wantMetadata {
+				t.Errorf("NeedsMetadata() = %v, want %v", tmpl.NeedsMetadata(), tt.wantMetadata)
+			}
+		})
+	}
+}
+
+// TestNameTemplateRender tests placeholder substitution and sanitizing
+func TestNameTemplateRender(t *testing.T) {
+	t.Parallel()
+	fields := NameFields{
+		Stem:     "IMG_0001",
+		Index:    3,
+		DateTime: time.Date(2024, 5, 3, 14, 30, 15, 0, time.UTC),
+		Make:     "Apple",
+		Model:    "iPhone 15",
+		Width:    4032,
+		Height:   3024,
+	}
+
+	tests := []struct {
+		template string
+		fields   NameFields
+		expected string
+	}{
+		{"{date}_{time}_{model}", fields, "2024-05-03_143015_iPhone15"},
+		{"{stem}_{index}", fields, "IMG_0001_3"},
+		{"{make}-{width}x{height}", fields, "Apple-4032x3024"},
+		{"{model}", NameFields{Model: `a/b:c`}, "a_b_c"},
+		{"{date}_{stem}", NameFields{Stem: "IMG_0002"}, "unknown_IMG_0002"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			t.Parallel()
+			tmpl, err := ParseNameTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParseNameTemplate failed: %v", err)
+			}
+			if got := tmpl.Render(tt.fields); got != tt.expected {
+				t.Errorf("Render() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestApplyNameTemplate tests that the directory and extension are kept
+func TestApplyNameTemplate(t *testing.T) {
+	t.Parallel()
+	tmpl, err := ParseNameTemplate("{stem}_{index}")
+	if err != nil {
+		t.Fatalf("ParseNameTemplate failed: %v", err)
+	}
+
+	got := ApplyNameTemplate(filepath.Join("out", "a.png"), tmpl, NameFields{Stem: "a", Index: 7})
+	if expected := filepath.Join("out", "a_7.png"); got != expected {
+		t.Errorf("ApplyNameTemplate() = %q, want %q", got, expected)
+	}
+}
+
+// TestOutputPlannerClaim tests collision handling within a batch
+func TestOutputPlannerClaim(t *testing.T) {
+	t.Parallel()
+	planner := NewOutputPlanner()
+
+	claims := []struct {
+		input    string
+		expected string
+	}{
+		{"dir/a.jpg", "dir/a.jpg"},
+		{"dir/b.jpg", "dir/b.jpg"},
+		{"dir/a.jpg", "dir/a_1.jpg"},
+		{"dir/A.jpg", "dir/A_2.jpg"},
+		{"other/a.jpg", "other/a.jpg"},
+	}
+
+	for _, c := range claims {
+		if got := planner.Claim(c.input); got != c.expected {
+			t.Errorf("Claim(%q) = %q, want %q", c.input, got, c.expected)
+		}
+	}
+}
+
+// TestReadImageSize tests reading the image size without decoding
+func TestReadImageSize(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	width, height, err := ReadImageSize(heicFile)
+	if err != nil {
+		t.Fatalf("ReadImageSize failed: %v", err)
+	}
+	if width <= 0 || height <= 0 {
+		t.Errorf("Expected positive dimensions, got %dx%d", width, height)
+	}
+
+	if _, _, err := ReadImageSize(filepath.Join(t.TempDir(), "missing.HEIC")); err == nil {
+		t.Error("Expected error for nonexistent file")
+	}
+}
@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+	"github.com/adrium/goheif/heif/bmff"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// orientation describes how stored pixels must be transformed for display:
+// an optional left-right mirror followed by a clockwise rotation in 90
+// degree steps. Every one of the eight EXIF orientations can be expressed
+// this way.
+type orientation struct {
+	mirror   bool
+	rotateCW int // 0-3
+}
+
+// exifOrientations maps EXIF Orientation values to the transform that
+// displays the image upright.
+var exifOrientations = map[int]orientation{
+	1: {false, 0},
+	2: {true, 0},  // mirror horizontal
+	3: {false, 2}, // rotate 180
+	4: {true, 2},  // mirror vertical
+	5: {true, 3},  // mirror horizontal and rotate 270 CW
+	6: {false, 1}, // rotate 90 CW
+	7: {true, 1},  // mirror horizontal and rotate 90 CW
+	8: {false, 3}, // rotate 270 CW
+}
+
+// isIdentity reports whether o leaves the image unchanged.
+func (o orientation) isIdentity() bool {
+	return !o.mirror && o.rotateCW == 0
+}
+
+// thenRotateCW returns the transform that applies o and then rotates by
+// quarterTurns * 90 degrees clockwise.
+func (o orientation) thenRotateCW(quarterTurns int) orientation {
+	return orientation{o.mirror, ((o.rotateCW+quarterTurns)%4 + 4) % 4}
+}
+
+// thenMirror returns the transform that applies o and then mirrors the
+// image left-right. Mirroring after a rotation equals mirroring first and
+// rotating the other way.
+func (o orientation) thenMirror() orientation {
+	return orientation{!o.mirror, (4 - o.rotateCW) % 4}
+}
+
+// thenFlip returns the transform that applies o and then flips the image
+// top-bottom, which equals a left-right mirror followed by a 180 degree
+// rotation.
+func (o orientation) thenFlip() orientation {
+	return o.thenMirror().thenRotateCW(2)
+}
+
+// readOrientation determines how the image item itemID (0 for the primary
+// image) of the HEIC file in ra must be transformed for display. The HEIF
+// irot/imir properties are used when present, in the order they are
+// associated with the item; otherwise the EXIF Orientation tag is used,
+// which only describes the primary image.
+func readOrientation(ra io.ReaderAt, itemID uint32) (orientation, error) {
+	hf := heif.Open(ra)
+	item, err := imageItem(hf, itemID)
+	if err != nil {
+		return orientation{}, err
+	}
+
+	if o, ok := heifOrientation(item); ok {
+		return o, nil
+	}
+	if primary, err := hf.PrimaryItem(); err != nil || item.ID != primary.ID {
+		return orientation{}, nil
+	}
+
+	exifData, err := goheif.ExtractExif(ra)
+	if err != nil {
+		if errors.Is(err, heif.ErrNoEXIF) {
+			return orientation{}, nil
+		}
+		return orientation{}, fmt.Errorf("EXIF情報の抽出に失敗しました: %w", err)
+	}
+	value, err := exif.ReadOrientation(exifData)
+	if err != nil {
+		return orientation{}, err
+	}
+	return exifOrientations[value], nil
+}
+
+// autoOrient returns img rotated for display as described by the image
+// item itemID of the HEIC file in ra, and sets rebuild.ResetOrientation
+// once it has been. If the orientation cannot be read, img is returned
+// unrotated and the Orientation tag is kept so viewers still apply it.
+func autoOrient(ra io.ReaderAt, itemID uint32, img image.Image, rebuild *exif.RebuildOptions) (image.Image, error) {
+	o, err := readOrientation(ra, itemID)
+	if err != nil {
+		return img, err
+	}
+	rebuild.ResetOrientation = true
+	return applyOrientation(img, o), nil
+}
+
+// heifOrientation composes the item's irot and imir transformative
+// properties. ok is false if the item has neither.
+func heifOrientation(item *heif.Item) (o orientation, ok bool) {
+	for _, p := range item.Properties {
+		switch p := p.(type) {
+		case *bmff.ImageRotation:
+			// irot angles are counter-clockwise.
+			o = o.thenRotateCW(-int(p.Angle))
+			ok = true
+		case *bmff.ImageMirror:
+			// MirrorVertical mirrors about a vertical axis (left-right),
+			// MirrorHorizontal about a horizontal axis (top-bottom).
+			if p.Mirror == bmff.MirrorVertical {
+				o = o.thenMirror()
+			} else {
+				o = o.thenFlip()
+			}
+			ok = true
+		}
+	}
+	return o, ok
+}
+
+// applyOrientation returns img transformed by o. *image.Gray, *image.RGBA
+// and *image.NRGBA keep their type; other color models (including the
+// *image.YCbCr that goheif decodes to) are converted to *image.RGBA first.
+func applyOrientation(img image.Image, o orientation) image.Image {
+	if o.isIdentity() {
+		return img
+	}
+
+	switch src := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(orientedRect(src.Rect, o))
+		transformPixels(dst.Pix, dst.Stride, src.Pix, src.Stride, src.Rect.Dx(), src.Rect.Dy(), 1, o)
+		return dst
+	case *image.NRGBA:
+		dst := image.NewNRGBA(orientedRect(src.Rect, o))
+		transformPixels(dst.Pix, dst.Stride, src.Pix, src.Stride, src.Rect.Dx(), src.Rect.Dy(), 4, o)
+		return dst
+	case *image.RGBA:
+		dst := image.NewRGBA(orientedRect(src.Rect, o))
+		transformPixels(dst.Pix, dst.Stride, src.Pix, src.Stride, src.Rect.Dx(), src.Rect.Dy(), 4, o)
+		return dst
+	default:
+		bounds := img.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+		return applyOrientation(rgba, o)
+	}
+}
+
+// orientedRect returns the zero-origin bounds of r after transforming by o.
+func orientedRect(r image.Rectangle, o orientation) image.Rectangle {
+	if o.rotateCW%2 == 1 {
+		return image.Rect(0, 0, r.Dy(), r.Dx())
+	}
+	return image.Rect(0, 0, r.Dx(), r.Dy())
+}
+
+// transformPixels copies a w x h pixel buffer with bpp bytes per pixel from
+// src to dst, mirroring and rotating it as described by o.
+func transformPixels(dst []byte, dstStride int, src []byte, srcStride, w, h, bpp int, o orientation) {
+	for y := 0; y < h; y++ {
+		row := src[y*srcStride : y*srcStride+w*bpp]
+		for x := 0; x < w; x++ {
+			mx := x
+			if o.mirror {
+				mx = w - 1 - x
+			}
+
+			var dx, dy int
+			switch o.rotateCW {
+			case 0:
+				dx, dy = mx, y
+			case 1:
+				dx, dy = h-1-y, mx
+			case 2:
+				dx, dy = w-1-mx, h-1-y
+			case 3:
+				dx, dy = y, w-1-mx
+			}
+
+			off := dy*dstStride + dx*bpp
+			copy(dst[off:off+bpp], row[x*bpp:x*bpp+bpp])
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrium/goheif"
+	"github.com/adrium/goheif/heif"
+	"github.com/adrium/goheif/heif/bmff"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// newTestGray returns a w x h gray image whose pixels are all distinct
+func newTestGray(w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i + 1)
+	}
+	return img
+}
+
+// TestApplyOrientation_EXIF tests every EXIF orientation against the
+// standard display mapping
+func TestApplyOrientation_EXIF(t *testing.T) {
+	t.Parallel()
+	const w, h = 3, 2
+	src := newTestGray(w, h)
+
+	// stored returns the stored pixel shown at display position (x, y).
+	tests := map[int]func(x, y int) (int, int){
+		1: func(x, y int) (int, int) { return x, y },
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}
+
+	for value, stored := range tests {
+		dst := applyOrientation(src, exifOrientations[value]).(*image.Gray)
+		b := dst.Bounds()
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				sx, sy := stored(x, y)
+				if got, want := dst.GrayAt(x, y), src.GrayAt(sx, sy); got != want {
+					t.Errorf("Orientation %d: pixel (%d,%d) = %v, want %v", value, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestApplyOrientation_YCbCr tests that other color models are converted
+// and rotated
+func TestApplyOrientation_YCbCr(t *testing.T) {
+	t.Parallel()
+	src := image.NewYCbCr(image.Rect(0, 0, 4, 2), image.YCbCrSubsampleRatio420)
+
+	dst := applyOrientation(src, exifOrientations[6])
+	if _, ok := dst.(*image.RGBA); !ok {
+		t.Fatalf("Expected *image.RGBA, got %T", dst)
+	}
+	if b := dst.Bounds(); b.Dx() != 2 || b.Dy() != 4 {
+		t.Errorf("Bounds = %v, want 2x4", b)
+	}
+	if applyOrientation(src, exifOrientations[1]) != image.Image(src) {
+		t.Error("Identity orientation should return the source image")
+	}
+}
+
+// TestHeifOrientation tests composing irot/imir properties in order
+func TestHeifOrientation(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		properties []bmff.Box
+		expected   int // EXIF orientation
+		ok         bool
+	}{
+		{"None", nil, 1, false},
+		{"irot 90 CCW", []bmff.Box{&bmff.ImageRotation{Angle: 1}}, 8, true},
+		{"irot 270 CCW", []bmff.Box{&bmff.ImageRotation{Angle: 3}}, 6, true},
+		{"imir vertical axis", []bmff.Box{&bmff.ImageMirror{Mirror: bmff.MirrorVertical}}, 2, true},
+		{"imir horizontal axis", []bmff.Box{&bmff.ImageMirror{Mirror: bmff.MirrorHorizontal}}, 4, true},
+		{"irot then imir", []bmff.Box{&bmff.ImageRotation{Angle: 1}, &bmff.ImageMirror{Mirror: bmff.MirrorVertical}}, 7, true},
+		{"imir then irot", []bmff.Box{&bmff.ImageMirror{Mirror: bmff.MirrorVertical}, &bmff.ImageRotation{Angle: 1}}, 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			o, ok := heifOrientation(&heif.Item{Properties: tt.properties})
+			if ok != tt.ok {
+				t.Errorf("ok = %v, want %v", ok, tt.ok)
+			}
+			if o != exifOrientations[tt.expected] {
+				t.Errorf("orientation = %+v, want EXIF %d (%+v)", o, tt.expected, exifOrientations[tt.expected])
+			}
+		})
+	}
+}
+
+// TestConvertHEIC_AutoOrient verifies that the sample photo (stored
+// landscape with a 90 degree irot) is written upright with Orientation 1
+func TestConvertHEIC_AutoOrient(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, err := ConvertHEIC(heicFile, ConvertOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", result.Warnings)
+	}
+
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if config.Height <= config.Width {
+		t.Errorf("Expected portrait output, got %dx%d", config.Width, config.Height)
+	}
+
+	orientation, err := exif.ReadOrientation(data)
+	if err != nil {
+		t.Fatalf("ReadOrientation failed: %v", err)
+	}
+	if orientation != 1 {
+		t.Errorf("Orientation = %d, want 1", orientation)
+	}
+}
+
+// TestAutoOrient_ReadFailure verifies that when the orientation cannot be
+// read, the pixels are left alone and the EXIF Orientation tag is kept
+func TestAutoOrient_ReadFailure(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	exifData, err := goheif.ExtractExif(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ExtractExif failed: %v", err)
+	}
+	want, err := exif.ReadOrientation(exifData)
+	if err != nil {
+		t.Fatalf("ReadOrientation failed: %v", err)
+	}
+	if want == 1 {
+		t.Fatal("Expected the test file to carry a non-upright Orientation tag")
+	}
+
+	src := newTestGray(3, 2)
+	var rebuild exif.RebuildOptions
+	img, err := autoOrient(bytes.NewReader([]byte("not a HEIC file")), 0, src, &rebuild)
+	if err == nil {
+		t.Fatal("Expected an error for an unreadable file")
+	}
+	if img != src {
+		t.Error("Expected the image to be returned unrotated")
+	}
+	if rebuild.ResetOrientation {
+		t.Error("Expected ResetOrientation to stay false")
+	}
+
+	rebuilt, err := exif.RebuildEXIF(exifData, rebuild)
+	if err != nil {
+		t.Fatalf("RebuildEXIF failed: %v", err)
+	}
+	got, err := exif.ReadOrientation(rebuilt)
+	if err != nil {
+		t.Fatalf("ReadOrientation failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("Orientation = %d, want the original %d", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ResizeOptions limits the size of the output image. The zero value leaves
+// the image at its original size. Images are only ever scaled down, and the
+// aspect ratio is always preserved.
+type ResizeOptions struct {
+	// MaxWidth and MaxHeight bound the output dimensions in pixels, as the
+	// image is displayed. Zero means no limit.
+	MaxWidth  int
+	MaxHeight int
+
+	// MaxPixels bounds the output width*height. Zero means no limit.
+	MaxPixels int
+
+	// Scale scales the image by a factor in (0, 1]. Zero means 1.
+	Scale float64
+}
+
+// IsZero reports whether o requests no resizing at all.
+func (o ResizeOptions) IsZero() bool {
+	return o == ResizeOptions{}
+}
+
+// Validate reports an error if any limit is out of range.
+func (o ResizeOptions) Validate() error {
+	if o.MaxWidth < 0 || o.MaxHeight < 0 || o.MaxPixels < 0 {
+		return fmt.Errorf("サイズの上限には0以上の値を指定してください")
+	}
+	if o.Scale < 0 || o.Scale > 1 || math.IsNaN(o.Scale) {
+		return fmt.Errorf("縮小率は0より大きく1以下の値で指定してください: %g", o.Scale)
+	}
+	return nil
+}
+
+// targetSize returns the output size for a w x h image. The limits are
+// combined by taking the smallest resulting scale factor.
+func (o ResizeOptions) targetSize(w, h int) (int, int) {
+	factor := 1.0
+	if o.Scale > 0 {
+		factor = o.Scale
+	}
+	if o.MaxWidth > 0 {
+		factor = math.Min(factor, float64(o.MaxWidth)/float64(w))
+	}
+	if o.MaxHeight > 0 {
+		factor = math.Min(factor, float64(o.MaxHeight)/float64(h))
+	}
+	if o.MaxPixels > 0 {
+		factor = math.Min(factor, math.Sqrt(float64(o.MaxPixels)/(float64(w)*float64(h))))
+	}
+	if factor >= 1 {
+		return w, h
+	}
+
+	return scaleDimension(w, factor), scaleDimension(h, factor)
+}
+
+// scaleDimension scales n by factor, rounding down so that the limits are
+// never exceeded. The small epsilon keeps a dimension that exactly matches a
+// limit (e.g. 5712 * 2048/5712) from being rounded down by float error.
+func scaleDimension(n int, factor float64) int {
+	return max(1, int(math.Floor(float64(n)*factor+1e-6)))
+}
+
+// rotated returns o with the width and height limits swapped, for images
+// whose stored orientation is rotated by 90 degrees from how they display.
+func (o ResizeOptions) rotated() ResizeOptions {
+	o.MaxWidth, o.MaxHeight = o.MaxHeight, o.MaxWidth
+	return o
+}
+
+// resizeImage scales img down as requested by o using the Catmull-Rom
+// filter. It returns img unchanged if no resizing is needed. *image.Gray
+// and *image.NRGBA keep their type; everything else is resampled into
+// *image.RGBA.
+func resizeImage(img image.Image, o ResizeOptions) image.Image {
+	bounds := img.Bounds()
+	w, h := o.targetSize(bounds.Dx(), bounds.Dy())
+	if w == bounds.Dx() && h == bounds.Dy() {
+		return img
+	}
+
+	rect := image.Rect(0, 0, w, h)
+	var dst xdraw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	xdraw.CatmullRom.Scale(dst, rect, img, bounds, xdraw.Src, nil)
+
+	if _, ok := img.(*image.NRGBA); ok {
+		// Resampling needs premultiplied colors, so *image.NRGBA goes through
+		// *image.RGBA and is converted back to straight alpha afterwards.
+		rgba := dst.(*image.RGBA)
+		for i := 0; i+3 < len(rgba.Pix); i += 4 {
+			if a := rgba.Pix[i+3]; a != 0 && a != 0xFF {
+				for c := i; c < i+3; c++ {
+					rgba.Pix[c] = unpremultiply(rgba.Pix[c], a)
+				}
+			}
+		}
+		return &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rgba.Rect}
+	}
+	return dst
+}
@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// TestResizeOptionsTargetSize tests combining the resize limits
+func TestResizeOptionsTargetSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		options          ResizeOptions
+		w, h             int
+		expectW, expectH int
+	}{
+		{"No limits", ResizeOptions{}, 4000, 3000, 4000, 3000},
+		{"Max width", ResizeOptions{MaxWidth: 2048}, 5712, 4284, 2048, 1536},
+		{"Max height", ResizeOptions{MaxHeight: 1000}, 4000, 3000, 1333, 1000},
+		{"Both, width wins", ResizeOptions{MaxWidth: 1000, MaxHeight: 1000}, 4000, 3000, 1000, 750},
+		{"Never upscales", ResizeOptions{MaxWidth: 8000}, 4000, 3000, 4000, 3000},
+		{"Max pixels", ResizeOptions{MaxPixels: 3000000}, 4000, 3000, 2000, 1500},
+		{"Scale", ResizeOptions{Scale: 0.5}, 4000, 3000, 2000, 1500},
+		{"Scale and max width", ResizeOptions{Scale: 0.5, MaxWidth: 1000}, 4000, 3000, 1000, 750},
+		{"Tiny", ResizeOptions{MaxWidth: 1}, 4000, 3000, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w, h := tt.options.targetSize(tt.w, tt.h)
+			if w != tt.expectW || h != tt.expectH {
+				t.Errorf("targetSize(%d, %d) = %dx%d, want %dx%d", tt.w, tt.h, w, h, tt.expectW, tt.expectH)
+			}
+		})
+	}
+}
+
+// TestResizeOptionsValidate tests rejecting out-of-range limits
+func TestResizeOptionsValidate(t *testing.T) {
+	t.Parallel()
+	valid := []ResizeOptions{{}, {MaxWidth: 2048}, {Scale: 1}, {Scale: 0.25, MaxPixels: 1000000}}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("Validate(%+v) unexpected error: %v", o, err)
+		}
+	}
+
+	invalid := []ResizeOptions{{MaxWidth: -1}, {MaxHeight: -1}, {MaxPixels: -1}, {Scale: -0.5}, {Scale: 1.5}}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("Validate(%+v) expected error", o)
+		}
+	}
+}
+
+// TestResizeImage tests the output type and size of resampled images
+func TestResizeImage(t *testing.T) {
+	t.Parallel()
+	gray := image.NewGray(image.Rect(0, 0, 100, 50))
+	if dst, ok := resizeImage(gray, ResizeOptions{Scale: 0.5}).(*image.Gray); !ok || dst.Bounds().Dx() != 50 || dst.Bounds().Dy() != 25 {
+		t.Errorf("Expected 50x25 *image.Gray, got %T %v", dst, dst.Bounds())
+	}
+
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 100, 50), image.YCbCrSubsampleRatio420)
+	if dst, ok := resizeImage(ycbcr, ResizeOptions{MaxWidth: 40}).(*image.RGBA); !ok || dst.Bounds().Dx() != 40 || dst.Bounds().Dy() != 20 {
+		t.Errorf("Expected 40x20 *image.RGBA, got %T %v", dst, dst.Bounds())
+	}
+
+	if resizeImage(ycbcr, ResizeOptions{MaxWidth: 200}) != image.Image(ycbcr) {
+		t.Error("Image within the limits should be returned unchanged")
+	}
+
+	// Straight alpha survives resampling.
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		copy(nrgba.Pix[i:i+4], []byte{200, 100, 50, 128})
+	}
+	dst, ok := resizeImage(nrgba, ResizeOptions{Scale: 0.5}).(*image.NRGBA)
+	if !ok || dst.Bounds().Dx() != 50 {
+		t.Fatalf("Expected 50x25 *image.NRGBA, got %T", dst)
+	}
+	if got := dst.NRGBAAt(25, 12); got.A != 128 || got.R < 199 || got.R > 201 || got.G < 99 || got.G > 101 {
+		t.Errorf("Resampled pixel = %v, want about {200 100 50 128}", got)
+	}
+}
+
+// TestConvertHEIC_Resize verifies that the limits apply to the displayed
+// orientation and that the EXIF pixel dimensions follow the new size
+func TestConvertHEIC_Resize(t *testing.T) {
+	t.Parallel()
+
+	// The sample photo is stored landscape and displayed portrait.
+	tests := []struct {
+		name             string
+		autoOrient       bool
+		expectW, expectH int
+	}{
+		{"Stored orientation", false, 2730, 2048},
+		{"Auto-oriented", true, 2048, 2730},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			heicFile, cleanup := setupTestFile(t)
+			defer cleanup()
+
+			options := ConvertOptions{AutoOrient: tt.autoOrient, Resize: ResizeOptions{MaxWidth: 2048}}
+			result, err := ConvertHEIC(heicFile, options)
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Output is not a valid JPEG: %v", err)
+			}
+			if config.Width != tt.expectW || config.Height != tt.expectH {
+				t.Errorf("Output size = %dx%d, want %dx%d", config.Width, config.Height, tt.expectW, tt.expectH)
+			}
+
+			info, err := exif.ReadImageInfo(data)
+			if err != nil {
+				t.Fatalf("Failed to read EXIF: %v", err)
+			}
+			if info.Width != tt.expectW || info.Height != tt.expectH {
+				t.Errorf("EXIF dimensions = %dx%d, want %dx%d", info.Width, info.Height, tt.expectW, tt.expectH)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrium/goheif/heif"
+)
+
+// DefaultThumbnailSize is the longest side, in pixels, of the thumbnail
+// ConvertThumbnail generates for files without an embedded thumbnail.
+const DefaultThumbnailSize = 320
+
+// thumbnailSuffix is appended to the input's name by ThumbnailOutputPath.
+const thumbnailSuffix = "_thumb"
+
+// ThumbnailOutputPath returns the path the thumbnail of inputPath is
+// written to by default: the input's name with "_thumb" and the extension
+// of format.
+func ThumbnailOutputPath(inputPath string, format Format) string {
+	outputPath := GenerateOutputPathForFormat(inputPath, format)
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + thumbnailSuffix + ext
+}
+
+// thumbnailItemID returns the ID of the first item in the HEIC file at
+// inputPath that is a thumbnail (thmb reference) of the primary image. ok
+// is false if the file has none.
+func thumbnailItemID(inputPath string) (id uint32, ok bool, err error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, false, fmt.Errorf("ファイルを開けませんでした: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hf := heif.Open(file)
+	primary, err := hf.PrimaryItem()
+	if err != nil {
+		return 0, false, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+	ids, err := heifItemIDs(file)
+	if err != nil {
+		return 0, false, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+	for _, id := range ids {
+		item, err := hf.ItemByID(id)
+		if err != nil {
+			return 0, false, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+		}
+		if ref := item.Reference("thmb"); ref != nil && containsItemID(ref.ToItemIDs, primary.ID) {
+			return id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ConvertThumbnail writes a preview of the HEIC file at inputPath, by
+// default to ThumbnailOutputPath. The thumbnail embedded in the file is
+// used when there is one, so only its small HEVC stream is decoded;
+// embedded is false if the file has none and the primary image was decoded
+// and downscaled instead, to DefaultThumbnailSize unless options.Resize is
+// set. options.ItemID is ignored.
+func ConvertThumbnail(inputPath string, options ConvertOptions) (result *Result, embedded bool, err error) {
+	if options.OutputPath == "" {
+		encoder, err := NewEncoder(options.Format, options)
+		if err != nil {
+			return nil, false, err
+		}
+		options.OutputPath = ThumbnailOutputPath(inputPath, encoder.Format())
+	}
+
+	id, embedded, err := thumbnailItemID(inputPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if embedded {
+		options.ItemID = id
+	} else {
+		options.ItemID = 0
+		if options.Resize.IsZero() {
+			options.Resize = ResizeOptions{MaxWidth: DefaultThumbnailSize, MaxHeight: DefaultThumbnailSize}
+		}
+	}
+
+	result, err = ConvertHEIC(inputPath, options)
+	return result, embedded, err
+}
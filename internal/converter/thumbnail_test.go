@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"bytes"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+func TestThumbnailOutputPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input  string
+		format Format
+		want   string
+	}{
+		{filepath.Join("photos", "IMG_0001.HEIC"), FormatJPEG, filepath.Join("photos", "IMG_0001_thumb.jpg")},
+		{"IMG_0001.heic", FormatPNG, "IMG_0001_thumb.png"},
+	}
+	for _, tt := range tests {
+		if got := ThumbnailOutputPath(tt.input, tt.format); got != tt.want {
+			t.Errorf("ThumbnailOutputPath(%q, %s) = %q, want %q", tt.input, tt.format, got, tt.want)
+		}
+	}
+}
+
+// decodeJPEGSize returns the dimensions of the JPEG file at path
+func decodeJPEGSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	return config.Width, config.Height
+}
+
+func TestConvertThumbnail_Embedded(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestFile(t)
+	defer cleanup()
+
+	result, embedded, err := ConvertThumbnail(heicFile, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("ConvertThumbnail failed: %v", err)
+	}
+	if !embedded {
+		t.Error("Expected the embedded thumbnail to be used")
+	}
+	if want := ThumbnailOutputPath(heicFile, FormatJPEG); result.OutputPath != want {
+		t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+	}
+	if w, h := decodeJPEGSize(t, result.OutputPath); w != 416 || h != 312 {
+		t.Errorf("Thumbnail is %dx%d, want 416x312", w, h)
+	}
+
+	// The carried-over EXIF data describes the thumbnail's size.
+	exifData, err := exif.ExtractEXIFFromJPEG(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to extract EXIF: %v", err)
+	}
+	info, err := exif.ReadImageInfo(exifData)
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+	if info.Width != 416 || info.Height != 312 {
+		t.Errorf("EXIF dimensions = %dx%d, want 416x312", info.Width, info.Height)
+	}
+}
+
+// TestConvertThumbnail_Fallback disables the thmb reference of a test file
+// so that the primary image is decoded and downscaled instead
+func TestConvertThumbnail_Fallback(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile(filepath.Join("..", "..", "test_images", "test_no_exif.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	heicFile := filepath.Join(t.TempDir(), "no_thumb.HEIC")
+	if err := os.WriteFile(heicFile, bytes.Replace(data, []byte("thmb"), []byte("xxxx"), 1), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	result, embedded, err := ConvertThumbnail(heicFile, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("ConvertThumbnail failed: %v", err)
+	}
+	if embedded {
+		t.Error("Expected no embedded thumbnail")
+	}
+	// 1596x1064 scaled to fit 320x320.
+	if w, h := decodeJPEGSize(t, result.OutputPath); w != DefaultThumbnailSize || h != 213 {
+		t.Errorf("Thumbnail is %dx%d, want %dx213", w, h, DefaultThumbnailSize)
+	}
+}
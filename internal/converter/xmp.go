@@ -0,0 +1,149 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/adrium/goheif/heif"
+)
+
+const (
+	// xmpContentType is the content type of the mime items holding XMP.
+	xmpContentType = "application/rdf+xml"
+
+	// xmpNamespace prefixes the JPEG APP1 segment holding the (standard)
+	// XMP packet.
+	xmpNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+
+	// xmpExtensionNamespace prefixes the JPEG APP1 segments holding the
+	// chunks of an Extended XMP packet.
+	xmpExtensionNamespace = "http://ns.adobe.com/xmp/extension/\x00"
+
+	// maxXMPPacketSize is the largest XMP packet that fits in a single APP1
+	// segment after the namespace.
+	maxXMPPacketSize = maxEXIFSegmentPayload - len(xmpNamespace)
+
+	// extendedXMPGUIDSize is the length of the GUID identifying an Extended
+	// XMP packet: the MD5 digest of the packet in uppercase hexadecimal.
+	extendedXMPGUIDSize = 32
+
+	// maxExtendedXMPChunkSize is the largest chunk of an Extended XMP packet
+	// that fits in an APP1 segment after the namespace, the GUID, and the
+	// 4-byte full length and offset (XMP Specification Part 3, 1.1.3.1).
+	maxExtendedXMPChunkSize = maxEXIFSegmentPayload - len(xmpExtensionNamespace) - extendedXMPGUIDSize - 4 - 4
+
+	// pngXMPKeyword is the keyword of the PNG iTXt chunk holding XMP.
+	pngXMPKeyword = "XML:com.adobe.xmp"
+)
+
+// extendedXMPStandardPacket is the standard XMP packet written in place of
+// a packet too large for one segment. It only points readers at the
+// Extended XMP packet, which holds every property, by its GUID.
+const extendedXMPStandardPacket = `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmpNote="http://ns.adobe.com/xmp/note/" xmpNote:HasExtendedXMP="%s"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// readXMP returns the XMP packet describing the image item itemID (0 for
+// the primary image) of the HEIC file in ra: the mime item of type
+// application/rdf+xml linked to it by a cdsc reference, or nil if there is
+// none. XMP describing other items, such as the HDR gain map, is ignored.
+func readXMP(ra io.ReaderAt, itemID uint32) ([]byte, error) {
+	hf := heif.Open(ra)
+	target, err := imageItem(hf, itemID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := heifItemIDs(ra)
+	if err != nil {
+		return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+	}
+
+	for _, id := range ids {
+		item, err := hf.ItemByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("HEICファイルの解析に失敗しました: %w", err)
+		}
+		if item.Info == nil || item.Info.ItemType != "mime" || item.Info.ContentType != xmpContentType {
+			continue
+		}
+		ref := item.Reference("cdsc")
+		if ref == nil || !containsItemID(ref.ToItemIDs, target.ID) {
+			continue
+		}
+		if item.Info.ContentEncoding != "" {
+			return nil, fmt.Errorf("XMPのエンコーディングに対応していません: %s", item.Info.ContentEncoding)
+		}
+		data, err := hf.GetItemData(item)
+		if err != nil {
+			return nil, fmt.Errorf("XMPの読み込みに失敗しました: %w", err)
+		}
+		return bytes.TrimRight(data, "\x00"), nil
+	}
+	return nil, nil
+}
+
+// buildXMPAPP1Segments builds the JPEG APP1 marker segments embedding an
+// XMP packet. A packet too large for one segment is written as Extended
+// XMP: a standard packet pointing at it by its GUID, followed by the packet
+// itself in chunks. Returns nil if there is no packet.
+func buildXMPAPP1Segments(xmp []byte) [][]byte {
+	if len(xmp) == 0 {
+		return nil
+	}
+	if len(xmp) <= maxXMPPacketSize {
+		return [][]byte{buildAPP1Segment([]byte(xmpNamespace), xmp)}
+	}
+
+	// The Extended XMP packet is serialized without a packet wrapper.
+	extended := stripXPacketWrapper(xmp)
+	digest := md5.Sum(extended)
+	guid := strings.ToUpper(hex.EncodeToString(digest[:]))
+
+	standard := fmt.Sprintf(extendedXMPStandardPacket, guid)
+	segments := [][]byte{buildAPP1Segment([]byte(xmpNamespace), []byte(standard))}
+	for offset := 0; offset < len(extended); offset += maxExtendedXMPChunkSize {
+		header := make([]byte, 0, len(xmpExtensionNamespace)+extendedXMPGUIDSize+8)
+		header = append(header, xmpExtensionNamespace...)
+		header = append(header, guid...)
+		header = binary.BigEndian.AppendUint32(header, uint32(len(extended)))
+		header = binary.BigEndian.AppendUint32(header, uint32(offset))
+		chunk := extended[offset:min(offset+maxExtendedXMPChunkSize, len(extended))]
+		segments = append(segments, buildAPP1Segment(header, chunk))
+	}
+	return segments
+}
+
+// stripXPacketWrapper returns xmp without the leading <?xpacket begin ...?>
+// and trailing <?xpacket end ...?> processing instructions, if present.
+func stripXPacketWrapper(xmp []byte) []byte {
+	xmp = bytes.TrimSpace(xmp)
+	if bytes.HasPrefix(xmp, []byte("<?xpacket")) {
+		if i := bytes.Index(xmp, []byte("?>")); i >= 0 {
+			xmp = xmp[i+2:]
+		}
+	}
+	if i := bytes.LastIndex(xmp, []byte("<?xpacket")); i >= 0 {
+		xmp = xmp[:i]
+	}
+	return bytes.TrimSpace(xmp)
+}
+
+// buildXMPITXtChunkData builds the body of an uncompressed PNG iTXt chunk
+// holding an XMP packet: the keyword, a null separator, the compression
+// flag and method, an empty language tag and translated keyword (each
+// null-terminated), and the packet.
+func buildXMPITXtChunkData(xmp []byte) []byte {
+	data := make([]byte, 0, len(pngXMPKeyword)+5+len(xmp))
+	data = append(data, pngXMPKeyword...)
+	data = append(data, 0x00, 0x00, 0x00, 0x00, 0x00)
+	return append(data, xmp...)
+}
@@ -0,0 +1,188 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+)
+
+// jpegXMP returns the standard XMP packet of JPEG data and the Extended XMP
+// packet reassembled from its chunks, or nil for the parts that are missing
+func jpegXMP(t *testing.T, data []byte) (standard, extended []byte) {
+	t.Helper()
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] != 0xDA; {
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		payload := data[pos+4 : pos+2+length]
+		switch {
+		case data[pos+1] != jpegAPP1Marker:
+		case bytes.HasPrefix(payload, []byte(xmpNamespace)):
+			standard = payload[len(xmpNamespace):]
+		case bytes.HasPrefix(payload, []byte(xmpExtensionNamespace)):
+			header := payload[len(xmpExtensionNamespace)+extendedXMPGUIDSize:]
+			fullLength := binary.BigEndian.Uint32(header[0:4])
+			offset := binary.BigEndian.Uint32(header[4:8])
+			if extended == nil {
+				extended = make([]byte, fullLength)
+			}
+			copy(extended[offset:], header[8:])
+		}
+		pos += 2 + length
+	}
+	return standard, extended
+}
+
+func TestReadXMP(t *testing.T) {
+	t.Parallel()
+	file, err := os.Open(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// The file's XMP describes the HDR gain map, not the primary image.
+	xmp, err := readXMP(file, 0)
+	if err != nil || xmp != nil {
+		t.Errorf("readXMP(primary) = %d bytes (err: %v), want none", len(xmp), err)
+	}
+
+	xmp, err = readXMP(file, testGainMapItemID)
+	if err != nil {
+		t.Fatalf("readXMP failed: %v", err)
+	}
+	if !bytes.HasPrefix(xmp, []byte("<x:xmpmeta")) || !bytes.Contains(xmp, []byte("HDRGainMap")) {
+		t.Errorf("Unexpected XMP packet: %q", xmp)
+	}
+}
+
+// TestBuildXMPAPP1Segments verifies that a packet that fits is written as
+// is, and a larger one as Extended XMP referenced from a standard packet
+func TestBuildXMPAPP1Segments(t *testing.T) {
+	t.Parallel()
+
+	small := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`)
+	segments := buildXMPAPP1Segments(small)
+	if len(segments) != 1 {
+		t.Fatalf("Expected 1 segment, got %d", len(segments))
+	}
+	standard, extended := jpegXMP(t, append(append([]byte{0xFF, 0xD8}, segments[0]...), 0xFF, 0xDA))
+	if !bytes.Equal(standard, small) || extended != nil {
+		t.Errorf("Standard packet = %q, extended = %d bytes", standard, len(extended))
+	}
+
+	body := `<x:xmpmeta xmlns:x="adobe:ns:meta/">` + strings.Repeat("<dc:subject>keyword</dc:subject>", 5000) + `</x:xmpmeta>`
+	large := []byte(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` + "\n" + body + "\n" + `<?xpacket end="w"?>`)
+	segments = buildXMPAPP1Segments(large)
+	wantChunks := (len(body) + maxExtendedXMPChunkSize - 1) / maxExtendedXMPChunkSize
+	if len(segments) != 1+wantChunks {
+		t.Fatalf("Expected %d segments, got %d", 1+wantChunks, len(segments))
+	}
+
+	jpegData := []byte{0xFF, 0xD8}
+	for i, segment := range segments {
+		if length := int(segment[2])<<8 | int(segment[3]); length != len(segment)-2 || length > 0xFFFF {
+			t.Errorf("Segment %d has length field %d for %d bytes", i, length, len(segment))
+		}
+		jpegData = append(jpegData, segment...)
+	}
+	jpegData = append(jpegData, 0xFF, 0xDA)
+
+	standard, extended = jpegXMP(t, jpegData)
+	if string(extended) != body {
+		t.Errorf("Extended XMP is %d bytes, want the %d-byte packet without its wrapper", len(extended), len(body))
+	}
+	digest := md5.Sum([]byte(body))
+	guid := strings.ToUpper(hex.EncodeToString(digest[:]))
+	if !bytes.Contains(standard, []byte(`xmpNote:HasExtendedXMP="`+guid+`"`)) {
+		t.Errorf("Standard packet does not reference GUID %s: %q", guid, standard)
+	}
+
+	if segments := buildXMPAPP1Segments(nil); segments != nil {
+		t.Errorf("Expected no segments without a packet, got %d", len(segments))
+	}
+}
+
+func TestWritePNGWithXMP(t *testing.T) {
+	t.Parallel()
+
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`)
+	var out bytes.Buffer
+	if err := writePNGWithMetadata(&out, pngBuf.Bytes(), Metadata{XMP: xmp}); err != nil {
+		t.Fatalf("writePNGWithMetadata failed: %v", err)
+	}
+
+	chunk := out.Bytes()[pngSignatureAndIHDRSize:]
+	if string(chunk[4:8]) != "iTXt" {
+		t.Fatalf("Expected iTXt chunk right after IHDR, got %q", chunk[4:8])
+	}
+	want := append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), xmp...)
+	if length := binary.BigEndian.Uint32(chunk[0:4]); !bytes.Equal(chunk[8:8+length], want) {
+		t.Errorf("iTXt payload = %q, want %q", chunk[8:8+length], want)
+	}
+	if _, err := png.Decode(bytes.NewReader(out.Bytes())); err != nil {
+		t.Errorf("PNG with iTXt chunk failed to decode: %v", err)
+	}
+}
+
+func TestConvertHEIC_XMP(t *testing.T) {
+	t.Parallel()
+	noGPS, err := exif.NewTagFilter([]string{"gps"}, nil)
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+	noXMP, err := exif.NewTagFilter([]string{"xmp"}, nil)
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		options ConvertOptions
+		wantXMP bool
+	}{
+		{"primary image", ConvertOptions{}, false},
+		{"described item", ConvertOptions{ItemID: testGainMapItemID}, true},
+		{"filter keeping XMP", ConvertOptions{ItemID: testGainMapItemID, EXIFFilter: noGPS}, true},
+		{"filter stripping XMP", ConvertOptions{ItemID: testGainMapItemID, EXIFFilter: noXMP}, false},
+		{"remove EXIF", ConvertOptions{ItemID: testGainMapItemID, RemoveEXIF: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			heicFile, cleanup := setupTestFile(t)
+			defer cleanup()
+
+			result, err := ConvertHEIC(heicFile, tt.options)
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("Unexpected warnings: %v", result.Warnings)
+			}
+
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			standard, _ := jpegXMP(t, data)
+			if got := bytes.Contains(standard, []byte("HDRGainMap")); got != tt.wantXMP {
+				t.Errorf("XMP embedded = %v, want %v", got, tt.wantXMP)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"strings"
+
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	jpegstructure "github.com/dsoprea/go-jpeg-image-structure/v2"
+)
+
+// RiskLevel ranks how much the metadata of a file reveals about where it
+// was taken, by whom or with which device.
+type RiskLevel int
+
+const (
+	// RiskNone means no metadata was found.
+	RiskNone RiskLevel = iota
+	// RiskLow covers metadata that rarely identifies anyone, such as
+	// camera settings.
+	RiskLow
+	// RiskMedium covers metadata that can link photos to a device or
+	// carry free text, such as serial numbers and XMP or IPTC blocks.
+	RiskMedium
+	// RiskHigh covers metadata that reveals a location or a person, or a
+	// thumbnail that may show what was cropped out.
+	RiskHigh
+)
+
+// riskLevelNames are the names of the risk levels, indexed by level.
+var riskLevelNames = []string{"none", "low", "medium", "high"}
+
+// String returns the name of the level, e.g. "high".
+func (r RiskLevel) String() string {
+	if r < RiskNone || int(r) >= len(riskLevelNames) {
+		return fmt.Sprintf("RiskLevel(%d)", int(r))
+	}
+	return riskLevelNames[r]
+}
+
+// MarshalText encodes the level by name, so it reads as e.g. "high" in JSON.
+func (r RiskLevel) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ParseRiskLevel parses the name of a risk level. Matching is
+// case-insensitive.
+func ParseRiskLevel(s string) (RiskLevel, error) {
+	for i, name := range riskLevelNames {
+		if strings.EqualFold(s, name) {
+			return RiskLevel(i), nil
+		}
+	}
+	return RiskNone, fmt.Errorf("不明なリスクレベルです: %s（指定可能: %s）", s, strings.Join(riskLevelNames, ", "))
+}
+
+// Kinds of Finding.
+const (
+	FindingGPS       = "gps"
+	FindingSerials   = "serials"
+	FindingOwner     = "owner"
+	FindingThumbnail = "thumbnail"
+	FindingXMP       = "xmp"
+	FindingIPTC      = "iptc"
+	FindingMakerNote = "makernote"
+	// FindingEXIF covers the EXIF tags not reported by another finding.
+	FindingEXIF = "exif"
+)
+
+// Finding is a kind of metadata found by AuditJPEG.
+type Finding struct {
+	Kind string    `json:"kind"`
+	Risk RiskLevel `json:"risk"`
+	// Detail describes what was found, in Japanese.
+	Detail string `json:"detail"`
+}
+
+// Audit is the result of AuditJPEG.
+type Audit struct {
+	Findings []Finding
+	// Risk is the highest risk of the findings.
+	Risk RiskLevel
+}
+
+func (a *Audit) add(kind string, risk RiskLevel, format string, args ...any) {
+	a.Findings = append(a.Findings, Finding{Kind: kind, Risk: risk, Detail: fmt.Sprintf(format, args...)})
+	a.Risk = max(a.Risk, risk)
+}
+
+// thumbnailAspectTolerance is how much the aspect ratios of an embedded
+// thumbnail and its image may differ before the thumbnail is considered to
+// show a different (e.g. uncropped) picture.
+const thumbnailAspectTolerance = 0.02
+
+// ps30Prefix starts the APP13 segment holding Photoshop image resources,
+// the usual container of IPTC data in JPEG files.
+var ps30Prefix = []byte("Photoshop 3.0\x00")
+
+// AuditJPEG classifies the metadata of a JPEG file by what it leaks: GPS
+// coordinates, device serial numbers, owner names, an embedded thumbnail
+// (in particular one that differs from the image, as happens when the
+// image was cropped without updating it), XMP and IPTC blocks, the maker
+// note and any other EXIF tags.
+func AuditJPEG(jpegPath string) (*Audit, error) {
+	data, err := os.ReadFile(jpegPath)
+	if err != nil {
+		return nil, fmt.Errorf("JPEGファイルの読み込みに失敗しました: %w", err)
+	}
+
+	jmp := jpegstructure.NewJpegMediaParser()
+	intfc, err := jmp.ParseBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("JPEG構造の解析に失敗しました: %w", err)
+	}
+	sl := intfc.(*jpegstructure.SegmentList)
+
+	audit := &Audit{}
+	if _, rawExif, err := sl.Exif(); err == nil {
+		if err := auditEXIF(audit, rawExif, data); err != nil {
+			return nil, err
+		}
+	}
+
+	// An Extended XMP packet spans several segments, reported together.
+	var xmpSize int
+	var xmpLocation bool
+	for _, s := range sl.Segments() {
+		switch {
+		case isXMPSegment(s):
+			xmpSize += len(s.Data)
+			xmpLocation = xmpLocation || XMPHasLocation(s.Data)
+		case s.MarkerId == jpegstructure.MARKER_APP13 && bytes.HasPrefix(s.Data, ps30Prefix):
+			audit.add(FindingIPTC, RiskMedium, "IPTC（Photoshop）メタデータ（%dバイト）", len(s.Data))
+		}
+	}
+	switch {
+	case xmpLocation:
+		audit.add(FindingXMP, RiskHigh, "XMPメタデータに位置情報が含まれています（%dバイト）", xmpSize)
+	case xmpSize > 0:
+		audit.add(FindingXMP, RiskMedium, "XMPメタデータ（%dバイト）", xmpSize)
+	}
+
+	return audit, nil
+}
+
+// auditEXIF adds the findings for the raw EXIF data of the JPEG file data.
+func auditEXIF(audit *Audit, rawExif, data []byte) error {
+	tags, err := ReadTags(rawExif)
+	if err != nil {
+		return err
+	}
+
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		return fmt.Errorf("IFDマッピングの初期化に失敗しました: %w", err)
+	}
+	_, index, err := exifv3.Collect(im, exifv3.NewTagIndex(), rawExif)
+	if err != nil {
+		return fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
+	}
+
+	// Tags reported by a specific finding; the rest are summed up as EXIF.
+	reported := map[tagKey]bool{}
+
+	var gpsTags []string
+	for _, tag := range tags {
+		if tag.ifdPath == gpsPath {
+			gpsTags = append(gpsTags, tag.Name)
+			reported[tag.groupKey()] = true
+		}
+	}
+	if len(gpsTags) > 0 {
+		gpsIfd, err := index.RootIfd.ChildWithIfdPath(exifcommon.IfdGpsInfoStandardIfdIdentity)
+		if gi, giErr := gpsIfdInfo(gpsIfd, err); giErr == nil {
+			audit.add(FindingGPS, RiskHigh, "GPS位置情報: 緯度 %.6f, 経度 %.6f", gi.Latitude.Decimal(), gi.Longitude.Decimal())
+		} else {
+			audit.add(FindingGPS, RiskMedium, "GPS情報（位置以外）: %s", strings.Join(gpsTags, ", "))
+		}
+	}
+
+	for _, group := range []struct {
+		kind  string
+		tags  TagGroup
+		risk  RiskLevel
+		label string
+	}{
+		{FindingSerials, TagGroupSerials, RiskMedium, "シリアル番号"},
+		{FindingOwner, TagGroupOwner, RiskHigh, "所有者名・撮影者名"},
+	} {
+		var values []string
+		for _, tag := range tags {
+			for _, key := range groupTags[group.tags] {
+				if key == tag.groupKey() {
+					values = append(values, tag.Name+"="+strings.TrimSpace(tag.Value))
+					reported[key] = true
+				}
+			}
+		}
+		if len(values) > 0 {
+			audit.add(group.kind, group.risk, "%s: %s", group.label, strings.Join(values, ", "))
+		}
+	}
+
+	for _, tag := range tags {
+		if key := tag.groupKey(); key == groupTags[TagGroupMakerNote][0] {
+			audit.add(FindingMakerNote, RiskLow, "メーカーノート（%dバイト）", len(tag.Raw)/2)
+			reported[key] = true
+		}
+	}
+
+	for cur := index.RootIfd.NextIfd(); cur != nil; cur = cur.NextIfd() {
+		thumbnail, err := cur.Thumbnail()
+		if err != nil {
+			continue
+		}
+		auditThumbnail(audit, thumbnail, data)
+		break
+	}
+
+	var others int
+	for _, tag := range tags {
+		if !reported[tag.groupKey()] {
+			others++
+		}
+	}
+	if others > 0 {
+		audit.add(FindingEXIF, RiskLow, "その他のEXIFタグ（%d個）", others)
+	}
+	return nil
+}
+
+// gpsIfdInfo returns the coordinates of the GPS IFD found by
+// ChildWithIfdPath with err.
+func gpsIfdInfo(gpsIfd *exifv3.Ifd, err error) (*exifv3.GpsInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	return gpsIfd.GpsInfo()
+}
+
+// auditThumbnail adds the finding for the embedded thumbnail of the JPEG
+// file data.
+func auditThumbnail(audit *Audit, thumbnail, data []byte) {
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		audit.add(FindingThumbnail, RiskMedium, "サムネイル（%dバイト、形式を判別できません）", len(thumbnail))
+		return
+	}
+	img, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || thumb.Width == 0 || thumb.Height == 0 || img.Width == 0 || img.Height == 0 {
+		audit.add(FindingThumbnail, RiskMedium, "サムネイル（%dx%d）", thumb.Width, thumb.Height)
+		return
+	}
+
+	thumbAspect := float64(thumb.Width) / float64(thumb.Height)
+	imgAspect := float64(img.Width) / float64(img.Height)
+	if diff := thumbAspect/imgAspect - 1; diff > thumbnailAspectTolerance || diff < -thumbnailAspectTolerance {
+		audit.add(FindingThumbnail, RiskHigh, "サムネイル（%dx%d）の縦横比が画像（%dx%d）と異なります。トリミング前の画像が残っている可能性があります", thumb.Width, thumb.Height, img.Width, img.Height)
+		return
+	}
+	audit.add(FindingThumbnail, RiskLow, "サムネイル（%dx%d）", thumb.Width, thumb.Height)
+}
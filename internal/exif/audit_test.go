@@ -0,0 +1,202 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+)
+
+// findingKinds returns the kinds of the findings of an audit, mapped to
+// their risk.
+func findingKinds(audit *Audit) map[string]RiskLevel {
+	kinds := make(map[string]RiskLevel, len(audit.Findings))
+	for _, f := range audit.Findings {
+		kinds[f.Kind] = f.Risk
+	}
+	return kinds
+}
+
+// appSegment encodes a JPEG APPn segment with the given marker and payload.
+func appSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// insertSegments inserts encoded segments right after the SOI marker of the
+// JPEG file at path.
+func insertSegments(t *testing.T, path string, segments ...[]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read JPEG: %v", err)
+	}
+	out := append([]byte{}, data[:2]...)
+	for _, seg := range segments {
+		out = append(out, seg...)
+	}
+	out = append(out, data[2:]...)
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+}
+
+// TestAuditJPEG_SampleFile tests auditing the EXIF data of the sample file
+func TestAuditJPEG_SampleFile(t *testing.T) {
+	t.Parallel()
+	jpegFile, cleanup := setupTestJPEGFile(t)
+	defer cleanup()
+
+	audit, err := AuditJPEG(jpegFile)
+	if err != nil {
+		t.Fatalf("AuditJPEG failed: %v", err)
+	}
+	if audit.Risk != RiskHigh {
+		t.Errorf("Risk = %v, want high", audit.Risk)
+	}
+	kinds := findingKinds(audit)
+	if kinds[FindingGPS] != RiskHigh {
+		t.Errorf("Expected a high-risk GPS finding, got %+v", audit.Findings)
+	}
+	for _, kind := range []string{FindingMakerNote, FindingEXIF} {
+		if _, ok := kinds[kind]; !ok {
+			t.Errorf("Expected a %s finding, got %+v", kind, audit.Findings)
+		}
+	}
+	for _, kind := range []string{FindingSerials, FindingOwner, FindingThumbnail, FindingXMP, FindingIPTC} {
+		if _, ok := kinds[kind]; ok {
+			t.Errorf("Unexpected %s finding: %+v", kind, audit.Findings)
+		}
+	}
+}
+
+// TestAuditJPEG_NoMetadata tests auditing a JPEG file without metadata
+func TestAuditJPEG_NoMetadata(t *testing.T) {
+	t.Parallel()
+	jpegFile := filepath.Join(t.TempDir(), "clean.jpg")
+	writeTestJPEG(t, jpegFile)
+
+	audit, err := AuditJPEG(jpegFile)
+	if err != nil {
+		t.Fatalf("AuditJPEG failed: %v", err)
+	}
+	if audit.Risk != RiskNone || len(audit.Findings) != 0 {
+		t.Errorf("Audit = %+v, want no findings", audit)
+	}
+}
+
+// TestAuditJPEG_Synthetic tests the findings that the sample file lacks,
+// on metadata built for the test
+func TestAuditJPEG_Synthetic(t *testing.T) {
+	t.Parallel()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		t.Fatalf("NewIfdMappingWithStandard failed: %v", err)
+	}
+	ti := exifv3.NewTagIndex()
+
+	rootIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, binary.BigEndian)
+	if err := rootIb.AddStandardWithName("Artist", "Jane Doe"); err != nil {
+		t.Fatalf("Failed to add Artist: %v", err)
+	}
+	exifIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdExifStandardIfdIdentity, binary.BigEndian)
+	if err := exifIb.AddStandardWithName("BodySerialNumber", "C39XK"); err != nil {
+		t.Fatalf("Failed to add BodySerialNumber: %v", err)
+	}
+	if err := rootIb.AddChildIb(exifIb); err != nil {
+		t.Fatalf("AddChildIb failed: %v", err)
+	}
+
+	// A wide thumbnail of the square test image, as left behind by cropping.
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 32, 16)), nil); err != nil {
+		t.Fatalf("Failed to encode thumbnail: %v", err)
+	}
+	ifd1Ib := exifv3.NewIfdBuilder(im, ti, exifcommon.Ifd1StandardIfdIdentity, binary.BigEndian)
+	if err := ifd1Ib.SetThumbnail(thumbnail.Bytes()); err != nil {
+		t.Fatalf("SetThumbnail failed: %v", err)
+	}
+	if err := rootIb.SetNextIb(ifd1Ib); err != nil {
+		t.Fatalf("SetNextIb failed: %v", err)
+	}
+	exifData, err := exifv3.NewIfdByteEncoder().EncodeToExif(rootIb)
+	if err != nil {
+		t.Fatalf("EncodeToExif failed: %v", err)
+	}
+
+	jpegFile := filepath.Join(t.TempDir(), "synthetic.jpg")
+	writeTestJPEG(t, jpegFile)
+	if err := EmbedEXIFToJPEG(jpegFile, exifData); err != nil {
+		t.Fatalf("EmbedEXIFToJPEG failed: %v", err)
+	}
+	insertSegments(t, jpegFile,
+		appSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>")),
+		// A chunk of an Extended XMP packet, reported with the standard one.
+		appSegment(0xE1, []byte("http://ns.adobe.com/xmp/extension/\x0000000000000000000000000000000000\x00\x00\x00\x20\x00\x00\x00\x00<exif:GPSLatitude>35,40.5N</exif:GPSLatitude>")),
+		appSegment(0xED, []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00\x00\x00\x00\x00")),
+	)
+
+	audit, err := AuditJPEG(jpegFile)
+	if err != nil {
+		t.Fatalf("AuditJPEG failed: %v", err)
+	}
+	want := map[string]RiskLevel{
+		FindingOwner:     RiskHigh,
+		FindingSerials:   RiskMedium,
+		FindingThumbnail: RiskHigh,
+		FindingXMP:       RiskHigh,
+		FindingIPTC:      RiskMedium,
+	}
+	kinds := findingKinds(audit)
+	for kind, risk := range want {
+		if got, ok := kinds[kind]; !ok || got != risk {
+			t.Errorf("Finding %s: risk = %v (found: %v), want %v", kind, got, ok, risk)
+		}
+	}
+	var xmpFindings int
+	for _, f := range audit.Findings {
+		if f.Kind == FindingXMP {
+			xmpFindings++
+		}
+	}
+	if xmpFindings != 1 {
+		t.Errorf("Got %d XMP findings, want 1: %+v", xmpFindings, audit.Findings)
+	}
+	if _, ok := kinds[FindingGPS]; ok {
+		t.Errorf("Unexpected GPS finding: %+v", audit.Findings)
+	}
+	if audit.Risk != RiskHigh {
+		t.Errorf("Risk = %v, want high", audit.Risk)
+	}
+}
+
+// TestAuditJPEG_NonexistentFile tests auditing a missing file
+func TestAuditJPEG_NonexistentFile(t *testing.T) {
+	t.Parallel()
+	if _, err := AuditJPEG(filepath.Join(t.TempDir(), "missing.jpg")); err == nil {
+		t.Error("Expected an error for a nonexistent file")
+	}
+}
+
+// TestParseRiskLevel tests parsing risk level names
+func TestParseRiskLevel(t *testing.T) {
+	t.Parallel()
+	for _, level := range []RiskLevel{RiskNone, RiskLow, RiskMedium, RiskHigh} {
+		if got, err := ParseRiskLevel(level.String()); err != nil || got != level {
+			t.Errorf("ParseRiskLevel(%s) = %v, %v", level, got, err)
+		}
+	}
+	if got, err := ParseRiskLevel("HIGH"); err != nil || got != RiskHigh {
+		t.Errorf("ParseRiskLevel(HIGH) = %v, %v", got, err)
+	}
+	if _, err := ParseRiskLevel("severe"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
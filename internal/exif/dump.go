@@ -0,0 +1,141 @@
+package exif
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DumpFormat selects the format DumpWriter writes EXIF tags in.
+type DumpFormat string
+
+const (
+	// DumpJSON writes a JSON array with one object per file.
+	DumpJSON DumpFormat = "json"
+	// DumpYAML writes a YAML sequence with one mapping per file.
+	DumpYAML DumpFormat = "yaml"
+	// DumpCSV writes one row per tag, with the file in the first column.
+	DumpCSV DumpFormat = "csv"
+)
+
+// ParseDumpFormat parses the format of a structured EXIF dump.
+// Matching is case-insensitive and "yml" is accepted for YAML.
+func ParseDumpFormat(s string) (DumpFormat, error) {
+	switch f := DumpFormat(strings.ToLower(s)); f {
+	case DumpJSON, DumpYAML, DumpCSV:
+		return f, nil
+	case "yml":
+		return DumpYAML, nil
+	default:
+		return "", fmt.Errorf("不明なEXIF情報の出力形式です: %s（指定可能: json, yaml, csv）", s)
+	}
+}
+
+// FileTags holds the EXIF tags of a single file in a dump.
+type FileTags struct {
+	File string `json:"file" yaml:"file"`
+	// Tags is empty if the file has no EXIF data.
+	Tags []Tag `json:"tags" yaml:"tags"`
+	// Error is set if the tags could not be read.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// csvHeader is the header row of CSV dumps.
+var csvHeader = []string{"file", "ifd", "id", "name", "type", "value", "raw"}
+
+// DumpWriter writes the EXIF tags of many files as a single JSON, YAML or
+// CSV document. Files are written as they are added, so the whole dump is
+// never held in memory; Close must be called to complete the document.
+type DumpWriter struct {
+	w      io.Writer
+	format DumpFormat
+	csv    *csv.Writer
+	count  int
+}
+
+// NewDumpWriter returns a DumpWriter writing to w in format.
+func NewDumpWriter(w io.Writer, format DumpFormat) *DumpWriter {
+	d := &DumpWriter{w: w, format: format}
+	if format == DumpCSV {
+		d.csv = csv.NewWriter(w)
+	}
+	return d
+}
+
+// Write adds the tags of one file to the dump.
+func (d *DumpWriter) Write(ft FileTags) error {
+	if ft.Tags == nil {
+		ft.Tags = []Tag{}
+	}
+	defer func() { d.count++ }()
+
+	switch d.format {
+	case DumpJSON:
+		data, err := json.MarshalIndent(ft, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if d.count == 0 {
+			sep = "[\n  "
+		}
+		_, err = fmt.Fprintf(d.w, "%s%s", sep, data)
+		return err
+	case DumpYAML:
+		// A one-element sequence per file concatenates into one sequence.
+		data, err := yaml.Marshal([]FileTags{ft})
+		if err != nil {
+			return err
+		}
+		_, err = d.w.Write(data)
+		return err
+	case DumpCSV:
+		if d.count == 0 {
+			if err := d.csv.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+		for _, tag := range ft.Tags {
+			row := []string{ft.File, tag.IFD, fmt.Sprintf("0x%04x", tag.ID), tag.Name, tag.Type, tag.Value, tag.Raw}
+			if err := d.csv.Write(row); err != nil {
+				return err
+			}
+		}
+		d.csv.Flush()
+		return d.csv.Error()
+	default:
+		return fmt.Errorf("不明なEXIF情報の出力形式です: %s", d.format)
+	}
+}
+
+// Close completes the document. An empty dump is still a valid document:
+// "[]" in JSON and YAML, and just the header row in CSV.
+func (d *DumpWriter) Close() error {
+	switch d.format {
+	case DumpJSON:
+		if d.count == 0 {
+			_, err := io.WriteString(d.w, "[]\n")
+			return err
+		}
+		_, err := io.WriteString(d.w, "\n]\n")
+		return err
+	case DumpYAML:
+		if d.count == 0 {
+			_, err := io.WriteString(d.w, "[]\n")
+			return err
+		}
+	case DumpCSV:
+		if d.count == 0 {
+			if err := d.csv.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+		d.csv.Flush()
+		return d.csv.Error()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var testFileTags = []FileTags{
+	{File: "a.HEIC", Tags: []Tag{
+		{IFD: "IFD0", ID: 0x010f, Name: "Make", Type: "ASCII", Value: "Apple", Raw: "4170706c6500"},
+		{IFD: "IFD0/Exif", ID: 0x829a, Name: "ExposureTime", Type: "RATIONAL", Value: "[1/60]", Raw: "000000010000003c"},
+	}},
+	{File: "b.HEIC"},
+	{File: "c.HEIC", Error: "broken"},
+}
+
+func writeDump(t *testing.T, format DumpFormat, files []FileTags) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	dump := NewDumpWriter(&buf, format)
+	for _, ft := range files {
+		if err := dump.Write(ft); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := dump.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDumpWriter_JSON(t *testing.T) {
+	t.Parallel()
+	var got []FileTags
+	if err := json.Unmarshal(writeDump(t, DumpJSON, testFileTags), &got); err != nil {
+		t.Fatalf("Dump is not valid JSON: %v", err)
+	}
+	if len(got) != 3 || len(got[0].Tags) != 2 || got[0].Tags[1] != testFileTags[0].Tags[1] || got[2].Error != "broken" {
+		t.Errorf("Unexpected dump: %+v", got)
+	}
+
+	if err := json.Unmarshal(writeDump(t, DumpJSON, nil), &got); err != nil || len(got) != 0 {
+		t.Errorf("Expected an empty JSON array, got %+v, %v", got, err)
+	}
+}
+
+func TestDumpWriter_YAML(t *testing.T) {
+	t.Parallel()
+	var got []FileTags
+	if err := yaml.Unmarshal(writeDump(t, DumpYAML, testFileTags), &got); err != nil {
+		t.Fatalf("Dump is not valid YAML: %v", err)
+	}
+	if len(got) != 3 || got[0].Tags[0] != testFileTags[0].Tags[0] || got[1].File != "b.HEIC" {
+		t.Errorf("Unexpected dump: %+v", got)
+	}
+}
+
+func TestDumpWriter_CSV(t *testing.T) {
+	t.Parallel()
+	rows, err := csv.NewReader(bytes.NewReader(writeDump(t, DumpCSV, testFileTags))).ReadAll()
+	if err != nil {
+		t.Fatalf("Dump is not valid CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %v", rows)
+	}
+	want := []string{"a.HEIC", "IFD0/Exif", "0x829a", "ExposureTime", "RATIONAL", "[1/60]", "000000010000003c"}
+	for i := range want {
+		if rows[2][i] != want[i] {
+			t.Errorf("Row = %v, want %v", rows[2], want)
+			break
+		}
+	}
+
+	rows, err = csv.NewReader(bytes.NewReader(writeDump(t, DumpCSV, nil))).ReadAll()
+	if err != nil || len(rows) != 1 {
+		t.Errorf("Expected only the header, got %v, %v", rows, err)
+	}
+}
+
+func TestParseDumpFormat(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]DumpFormat{"json": DumpJSON, "YAML": DumpYAML, "yml": DumpYAML, "csv": DumpCSV} {
+		if got, err := ParseDumpFormat(in); err != nil || got != want {
+			t.Errorf("ParseDumpFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseDumpFormat("png"); err == nil {
+		t.Error("Expected an error for png")
+	}
+}
@@ -3,18 +3,25 @@
 package exif
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/adrium/goheif"
 	"github.com/adrium/goheif/heif"
 	exifv3 "github.com/dsoprea/go-exif/v3"
 	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	exifundefined "github.com/dsoprea/go-exif/v3/undefined"
 	jpegstructure "github.com/dsoprea/go-jpeg-image-structure/v2"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/fileutil"
 )
 
 // ErrNoEXIF is returned by ExtractEXIFFromHEIC when the HEIC file does not
@@ -51,6 +58,92 @@ func ExtractEXIFFromHEIC(heicPath string) ([]byte, error) {
 	return exifBytes, nil
 }
 
+// exifDateTimeLayout is the layout of EXIF DateTime* tag values.
+const exifDateTimeLayout = "2006:01:02 15:04:05"
+
+// ImageInfo holds the descriptive EXIF fields used to name output files.
+type ImageInfo struct {
+	// DateTimeOriginal is the capture time, falling back to DateTime. It is
+	// the zero time if neither tag is present or parseable.
+	DateTimeOriginal time.Time
+	Make             string
+	Model            string
+	// Width and Height come from PixelXDimension/PixelYDimension, or zero
+	// if the tags are missing.
+	Width  int
+	Height int
+}
+
+// ExtractImageInfoFromHEIC reads the descriptive EXIF fields of a HEIC file.
+// It returns ErrNoEXIF if the file has no EXIF data.
+func ExtractImageInfoFromHEIC(heicPath string) (ImageInfo, error) {
+	exifBytes, err := ExtractEXIFFromHEIC(heicPath)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return ReadImageInfo(exifBytes)
+}
+
+// ReadImageInfo reads the ImageInfo fields from an EXIF payload (with or
+// without its leading "Exif\0\0" marker, or a whole JPEG file).
+func ReadImageInfo(exifBytes []byte) (ImageInfo, error) {
+	var info ImageInfo
+
+	rawExif, err := exifv3.SearchAndExtractExif(exifBytes)
+	if err != nil {
+		return info, fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		return info, fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+	}
+
+	var dateTime string
+	for _, entry := range entries {
+		switch entry.TagName {
+		case "DateTimeOriginal":
+			if t, err := time.Parse(exifDateTimeLayout, strings.TrimSpace(entry.Formatted)); err == nil {
+				info.DateTimeOriginal = t
+			}
+		case "DateTime":
+			dateTime = strings.TrimSpace(entry.Formatted)
+		case "Make":
+			info.Make = strings.TrimSpace(entry.Formatted)
+		case "Model":
+			info.Model = strings.TrimSpace(entry.Formatted)
+		case "PixelXDimension":
+			info.Width = firstIntValue(entry.Value)
+		case "PixelYDimension":
+			info.Height = firstIntValue(entry.Value)
+		}
+	}
+
+	if info.DateTimeOriginal.IsZero() && dateTime != "" {
+		if t, err := time.Parse(exifDateTimeLayout, dateTime); err == nil {
+			info.DateTimeOriginal = t
+		}
+	}
+
+	return info, nil
+}
+
+// firstIntValue returns the first element of a SHORT or LONG tag value, or
+// zero for any other type.
+func firstIntValue(value interface{}) int {
+	switch v := value.(type) {
+	case []uint16:
+		if len(v) > 0 {
+			return int(v[0])
+		}
+	case []uint32:
+		if len(v) > 0 {
+			return int(v[0])
+		}
+	}
+	return 0
+}
+
 // EmbedEXIFToJPEG embeds EXIF data into a JPEG file
 func EmbedEXIFToJPEG(jpegPath string, exifData []byte) error {
 	if len(exifData) == 0 {
@@ -93,7 +186,7 @@ func EmbedEXIFToJPEG(jpegPath string, exifData []byte) error {
 		return fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
 	}
 
-	ib, err := buildIfdChain(im, ti, index.RootIfd)
+	ib, err := buildIfdChain(im, ti, index.RootIfd, nil)
 	if err != nil {
 		return fmt.Errorf("EXIF情報の再構築に失敗しました: %w", err)
 	}
@@ -103,25 +196,268 @@ func EmbedEXIFToJPEG(jpegPath string, exifData []byte) error {
 		return fmt.Errorf("EXIF情報の埋め込みに失敗しました: %w", err)
 	}
 
-	// Write the modified JPEG
-	outFile, err := os.Create(jpegPath)
+	if err := fileutil.WriteAtomic(jpegPath, sl.Write); err != nil {
+		return fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
+	}
+
+	return nil
+}
+
+// RebuildOptions adjusts the EXIF data produced by RebuildEXIF to match the
+// pixels it is written with.
+type RebuildOptions struct {
+	// ResetOrientation sets the Orientation tag to 1 (upright), for images
+	// whose pixels have already been rotated for display.
+	ResetOrientation bool
+
+	// Width and Height, when non-zero, replace the PixelXDimension and
+	// PixelYDimension tags if they are present.
+	Width  int
+	Height int
+
+	// Filter, when non-nil, removes the tags and sub-IFDs it does not keep.
+	Filter *TagFilter
+}
+
+// RebuildEXIF parses an EXIF payload (with or without its leading
+// "Exif\0\0" marker) and re-encodes it through buildIfdChain, dropping
+// malformed tags that would otherwise corrupt the block when written into a
+// new file, and applying opts. The returned payload carries the
+// "Exif\0\0" marker, ready to be stored in a JPEG APP1 segment. If
+// opts.Filter removes every tag, RebuildEXIF returns nil.
+func RebuildEXIF(exifData []byte, opts RebuildOptions) ([]byte, error) {
+	rawExif, err := exifv3.SearchAndExtractExif(exifData)
 	if err != nil {
-		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
+		return nil, fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
 	}
-	defer func() {
-		if closeErr := outFile.Close(); closeErr != nil {
-			// Log error but don't fail operation
-			_ = closeErr
+
+	ib, err := rebuildIfdChain(rawExif, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(ib.Tags()) == 0 {
+		return nil, nil
+	}
+
+	if err := applyRebuildOptions(ib, opts); err != nil {
+		return nil, fmt.Errorf("EXIF情報の更新に失敗しました: %w", err)
+	}
+
+	encoded, err := exifv3.NewIfdByteEncoder().EncodeToExif(ib)
+	if err != nil {
+		return nil, fmt.Errorf("EXIF情報のエンコードに失敗しました: %w", err)
+	}
+
+	return append([]byte("Exif\x00\x00"), encoded...), nil
+}
+
+// shrinkGroups are the tag groups that ShrinkEXIF removes, in order, from
+// EXIF data that is too large: first the IFD1 thumbnail, which viewers can
+// regenerate from the image, then the maker note, which only vendor tools
+// read.
+var shrinkGroups = []TagGroup{TagGroupThumbnail, TagGroupMakerNote}
+
+// Removal is a tag group removed by ShrinkEXIF and the number of bytes
+// removing it saved.
+type Removal struct {
+	Group TagGroup
+	Size  int
+}
+
+// ShrinkEXIF returns an EXIF payload, as returned by RebuildEXIF, reduced to
+// at most maxSize bytes by removing the IFD1 thumbnail and then the maker
+// note, stopping as soon as it fits, along with what was removed. A payload
+// that already fits is returned unchanged. It returns an error if the
+// payload cannot be parsed or is still too large without both.
+func ShrinkEXIF(exifData []byte, maxSize int) ([]byte, []Removal, error) {
+	if len(exifData) <= maxSize {
+		return exifData, nil, nil
+	}
+
+	var (
+		removals []Removal
+		strip    []string
+	)
+	shrunk := exifData
+	for _, group := range shrinkGroups {
+		strip = append(strip, string(group))
+		filter, err := NewTagFilter(strip, nil)
+		if err != nil {
+			return nil, nil, err
 		}
-	}()
+		rebuilt, err := RebuildEXIF(exifData, RebuildOptions{Filter: filter})
+		if err != nil {
+			return nil, nil, err
+		}
+		// Groups missing from the payload remove nothing.
+		if len(rebuilt) < len(shrunk) {
+			removals = append(removals, Removal{Group: group, Size: len(shrunk) - len(rebuilt)})
+			shrunk = rebuilt
+		}
+		if len(shrunk) <= maxSize {
+			return shrunk, removals, nil
+		}
+	}
+	return nil, removals, fmt.Errorf("EXIF情報（%dバイト）はサムネイルとメーカーノートを削除しても%dバイトに収まりません", len(shrunk), maxSize)
+}
 
-	if err := sl.Write(outFile); err != nil {
-		return fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
+// rebuildIfdChain parses raw EXIF data (without the "Exif\0\0" marker) and
+// rebuilds it through buildIfdChain with filter.
+func rebuildIfdChain(rawExif []byte, filter *TagFilter) (*exifv3.IfdBuilder, error) {
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		return nil, fmt.Errorf("IFDマッピングの初期化に失敗しました: %w", err)
+	}
+	ti := exifv3.NewTagIndex()
+
+	_, index, err := exifv3.Collect(im, ti, rawExif)
+	if err != nil {
+		return nil, fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
+	}
+
+	ib, err := buildIfdChain(im, ti, index.RootIfd, filter)
+	if err != nil {
+		return nil, fmt.Errorf("EXIF情報の再構築に失敗しました: %w", err)
+	}
+	return ib, nil
+}
+
+// applyRebuildOptions updates the tags of the rebuilt IFD chain rooted at
+// rootIb as requested by opts. Tags that are absent are left absent.
+func applyRebuildOptions(rootIb *exifv3.IfdBuilder, opts RebuildOptions) error {
+	if opts.ResetOrientation {
+		if err := replaceTag(rootIb, "Orientation", []uint16{1}); err != nil {
+			return err
+		}
+	}
+
+	if opts.Width > 0 && opts.Height > 0 {
+		exifIb, err := rootIb.ChildWithTagId(exifcommon.IfdExifStandardIfdIdentity.TagId())
+		if err != nil {
+			// No Exif sub-IFD, so there are no dimension tags to update.
+			return nil
+		}
+		if err := replaceTag(exifIb, "PixelXDimension", []uint32{uint32(opts.Width)}); err != nil {
+			return err
+		}
+		if err := replaceTag(exifIb, "PixelYDimension", []uint32{uint32(opts.Height)}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// replaceTag sets the value of the named standard tag in ib if the tag is
+// already present.
+func replaceTag(ib *exifv3.IfdBuilder, tagName string, value interface{}) error {
+	if _, err := ib.FindTagWithName(tagName); err != nil {
+		return nil
+	}
+	return ib.SetStandardWithName(tagName, value)
+}
+
+// ReadOrientation returns the Orientation tag (1-8) of an EXIF payload, or
+// 1 if the tag is absent or out of range.
+func ReadOrientation(exifData []byte) (int, error) {
+	rawExif, err := exifv3.SearchAndExtractExif(exifData)
+	if err != nil {
+		return 0, fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		return 0, fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IfdPath == exifcommon.IfdStandardIfdIdentity.UnindexedString() && entry.TagName == "Orientation" {
+			if v := firstIntValue(entry.Value); v >= 1 && v <= 8 {
+				return v, nil
+			}
+		}
+	}
+	return 1, nil
+}
+
+// appleMakerNoteHeader starts the maker note written by Apple devices,
+// followed by a 2-byte version, the byte order ("MM" or "II") and an IFD
+// whose offsets are relative to the start of the maker note.
+const appleMakerNoteHeader = "Apple iOS\x00"
+
+// appleContentIdentifierTag is the Apple maker note tag holding the Live
+// Photo content identifier shared by a photo and its companion video.
+const appleContentIdentifierTag = 0x0011
+
+// ReadContentIdentifier returns the Live Photo content identifier stored in
+// the Apple maker note of an EXIF payload, or "" if there is none (e.g. the
+// photo is not a Live Photo or was not taken by an Apple device).
+func ReadContentIdentifier(exifData []byte) (string, error) {
+	rawExif, err := exifv3.SearchAndExtractExif(exifData)
+	if err != nil {
+		return "", fmt.Errorf("EXIFデータの解析に失敗しました: %w", err)
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		return "", fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.TagId != 0x927c {
+			continue
+		}
+		makerNote, ok := entry.Value.(exifundefined.Tag927CMakerNote)
+		if !ok {
+			return "", nil
+		}
+		return appleMakerNoteString(makerNote.MakerNoteBytes, appleContentIdentifierTag), nil
+	}
+	return "", nil
+}
+
+// appleMakerNoteString returns the value of the ASCII tag in an Apple maker
+// note, or "" if the maker note is not Apple's or lacks the tag.
+func appleMakerNoteString(note []byte, tag uint16) string {
+	const ifdOffset = len(appleMakerNoteHeader) + 4
+	if len(note) < ifdOffset+2 || string(note[:len(appleMakerNoteHeader)]) != appleMakerNoteHeader {
+		return ""
+	}
+	var order binary.ByteOrder
+	switch string(note[ifdOffset-2 : ifdOffset]) {
+	case "MM":
+		order = binary.BigEndian
+	case "II":
+		order = binary.LittleEndian
+	default:
+		return ""
+	}
+
+	count := int(order.Uint16(note[ifdOffset:]))
+	for i := 0; i < count; i++ {
+		entry := note[min(ifdOffset+2+12*i, len(note)):]
+		if len(entry) < 12 {
+			return ""
+		}
+		if order.Uint16(entry[0:2]) != tag || order.Uint16(entry[2:4]) != uint16(exifcommon.TypeAscii) {
+			continue
+		}
+		size := int(order.Uint32(entry[4:8]))
+		value := entry[8:12]
+		if size > 4 {
+			offset := int(order.Uint32(entry[8:12]))
+			if offset < 0 || size < 0 || offset > len(note) || size > len(note)-offset {
+				return ""
+			}
+			value = note[offset : offset+size]
+		} else {
+			value = value[:size]
+		}
+		return strings.TrimRight(string(value), "\x00")
+	}
+	return ""
+}
+
 // componentSize returns the byte size of a single unit of the given tag
 // type. exifcommon.TagTypePrimitive.Size() panics for UNDEFINED, so it is
 // special-cased here to the conventional 1-byte-per-unit size.
@@ -138,10 +474,18 @@ func componentSize(tagType exifcommon.TagTypePrimitive) int {
 // unit count imply. Some cameras (e.g. Apple's padded SceneType tag) write
 // non-conforming values here, and re-encoding them as-is corrupts the offsets
 // of every tag that follows, making the whole EXIF block unreadable.
-func buildIfdChain(im *exifcommon.IfdMapping, ti *exifv3.TagIndex, rootIfd *exifv3.Ifd) (*exifv3.IfdBuilder, error) {
+//
+// Tags that filter does not keep are skipped as well, and so are sub-IFDs
+// left without tags and, unless filter keeps the thumbnail, the IFDs after
+// the first one (IFD1 and its thumbnail).
+func buildIfdChain(im *exifcommon.IfdMapping, ti *exifv3.TagIndex, rootIfd *exifv3.Ifd, filter *TagFilter) (*exifv3.IfdBuilder, error) {
 	var firstIb, lastIb *exifv3.IfdBuilder
 
 	for cur := rootIfd; cur != nil; cur = cur.NextIfd() {
+		if firstIb != nil && !filter.keepsThumbnail() {
+			break
+		}
+
 		ib := exifv3.NewIfdBuilder(im, ti, cur.IfdIdentity(), cur.ByteOrder())
 
 		if thumbnailData, err := cur.Thumbnail(); err == nil {
@@ -167,16 +511,24 @@ func buildIfdChain(im *exifcommon.IfdMapping, ti *exifv3.TagIndex, rootIfd *exif
 					continue
 				}
 
-				childIb, err := buildIfdChain(im, ti, childIfd)
+				childIb, err := buildIfdChain(im, ti, childIfd, filter)
 				if err != nil {
 					return nil, err
 				}
+				if len(childIb.Tags()) == 0 {
+					continue
+				}
 				if err := ib.AddChildIb(childIb); err != nil {
 					return nil, err
 				}
 				continue
 			}
 
+			// The tags of IFD1 go with the thumbnail, checked above.
+			if cur.IfdIdentity().Index() == 0 && !filter.keepsTag(cur.IfdIdentity(), ite.TagId(), ite.TagName()) {
+				continue
+			}
+
 			rawBytes, err := ite.GetRawBytes()
 			if err != nil {
 				return nil, err
@@ -227,84 +579,191 @@ func RemoveEXIFFromJPEG(jpegPath string) error {
 		return fmt.Errorf("EXIFセグメントの削除に失敗しました: %w", err)
 	}
 
-	// Write the modified JPEG
-	outFile, err := os.Create(jpegPath)
-	if err != nil {
-		return fmt.Errorf("出力ファイルの作成に失敗しました: %w", err)
-	}
-	defer func() {
-		if closeErr := outFile.Close(); closeErr != nil {
-			// Log error but don't fail operation
-			_ = closeErr
-		}
-	}()
-
-	if err := sl.Write(outFile); err != nil {
+	if err := fileutil.WriteAtomic(jpegPath, sl.Write); err != nil {
 		return fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
 	}
 
 	return nil
 }
 
-// ShowEXIFFromHEIC displays EXIF information from a HEIC file
-func ShowEXIFFromHEIC(heicPath string) error {
-	// Extract EXIF data from HEIC
-	exifBytes, err := ExtractEXIFFromHEIC(heicPath)
+// FilterEXIFInJPEG rewrites the EXIF data of a JPEG file without the tags
+// that filter does not keep, and returns the removed tags. The EXIF segment
+// is dropped if no tag is left. If filter does not keep the XMP packet, its
+// segments are dropped too and reported as a single tag named "XMP". A file
+// from which nothing is removed is left untouched.
+func FilterEXIFInJPEG(jpegPath string, filter *TagFilter) ([]Tag, error) {
+	if filter == nil {
+		// Nothing to remove
+		return nil, nil
+	}
+
+	// Read the JPEG file
+	data, err := os.ReadFile(jpegPath)
 	if err != nil {
-		if errors.Is(err, ErrNoEXIF) {
-			fmt.Printf("=== EXIF情報: %s ===\n", filepath.Base(heicPath))
-			fmt.Println("EXIF情報: なし")
-			fmt.Println()
-			return nil
+		return nil, fmt.Errorf("JPEGファイルの読み込みに失敗しました: %w", err)
+	}
+
+	// Parse JPEG structure
+	jmp := jpegstructure.NewJpegMediaParser()
+	intfc, err := jmp.ParseBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("JPEG構造の解析に失敗しました: %w", err)
+	}
+
+	sl := intfc.(*jpegstructure.SegmentList)
+
+	var removed []Tag
+	if _, rawExif, err := sl.Exif(); err == nil {
+		if removed, err = filterExifSegment(sl, rawExif, filter); err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("HEICファイルからEXIF情報の抽出に失敗しました: %w", err)
+	}
+	if !filter.KeepsXMP() || !filter.KeepsXMPLocation() && xmpSegmentsHaveLocation(sl) {
+		var dropped bool
+		if sl, dropped = dropXMPSegments(sl); dropped {
+			removed = append(removed, Tag{IFD: xmpTagName, Name: xmpTagName})
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
 	}
 
-	if len(exifBytes) == 0 {
-		fmt.Printf("=== EXIF情報: %s ===\n", filepath.Base(heicPath))
-		fmt.Println("EXIF情報: なし")
-		fmt.Println()
-		return nil
+	if err := fileutil.WriteAtomic(jpegPath, sl.Write); err != nil {
+		return nil, fmt.Errorf("JPEGファイルの書き込みに失敗しました: %w", err)
 	}
 
-	// Search and extract EXIF data
-	rawExif, err := exifv3.SearchAndExtractExif(exifBytes)
+	return removed, nil
+}
+
+// filterExifSegment replaces the EXIF segment of sl, holding rawExif, with
+// the tags that filter keeps, dropping it if none is left, and returns the
+// removed tags.
+func filterExifSegment(sl *jpegstructure.SegmentList, rawExif []byte, filter *TagFilter) ([]Tag, error) {
+	before, err := ReadTags(rawExif)
+	if err != nil {
+		return nil, err
+	}
+
+	ib, err := rebuildIfdChain(rawExif, filter)
 	if err != nil {
-		// SearchAndExtractExifが失敗した場合、直接GetFlatExifDataを試す
-		entries, _, err := exifv3.GetFlatExifData(exifBytes, nil)
+		return nil, err
+	}
+
+	var after []Tag
+	if len(ib.Tags()) == 0 {
+		if _, err := sl.DropExif(); err != nil {
+			return nil, fmt.Errorf("EXIFセグメントの削除に失敗しました: %w", err)
+		}
+	} else {
+		if err := sl.SetExif(ib); err != nil {
+			return nil, fmt.Errorf("EXIF情報の埋め込みに失敗しました: %w", err)
+		}
+		_, filtered, err := sl.Exif()
 		if err != nil {
-			return fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+			return nil, fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+		}
+		if after, err = ReadTags(filtered); err != nil {
+			return nil, err
 		}
+	}
 
-		// Display EXIF information
-		fmt.Printf("=== EXIF情報: %s ===\n", filepath.Base(heicPath))
-		if len(entries) == 0 {
-			fmt.Println("EXIF情報: なし")
-		} else {
-			printExifEntries(entries)
+	return removedTags(before, after), nil
+}
+
+// xmpTagName stands for the XMP packet among the tags returned by
+// FilterEXIFInJPEG.
+const xmpTagName = "XMP"
+
+// xmpExtensionPrefix starts the APP1 segments holding the chunks of an
+// Extended XMP packet, which go-jpeg-image-structure does not recognize as
+// XMP.
+var xmpExtensionPrefix = []byte("http://ns.adobe.com/xmp/extension/\x00")
+
+// XMPHasLocation reports whether an XMP packet, or a chunk of one, carries
+// GPS coordinates (exif:GPSLatitude or exif:GPSLongitude).
+func XMPHasLocation(xmp []byte) bool {
+	return bytes.Contains(xmp, []byte("GPSLatitude")) || bytes.Contains(xmp, []byte("GPSLongitude"))
+}
+
+// xmpSegmentsHaveLocation reports whether any XMP segment of sl carries
+// GPS coordinates.
+func xmpSegmentsHaveLocation(sl *jpegstructure.SegmentList) bool {
+	for _, s := range sl.Segments() {
+		if isXMPSegment(s) && XMPHasLocation(s.Data) {
+			return true
 		}
-		fmt.Println()
-		return nil
 	}
+	return false
+}
 
-	// Parse EXIF data
-	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
-	if err != nil {
-		return fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+// isXMPSegment reports whether s holds an XMP packet or a chunk of an
+// Extended XMP packet.
+func isXMPSegment(s *jpegstructure.Segment) bool {
+	return s.IsXmp() || (s.MarkerId == jpegstructure.MARKER_APP1 && bytes.HasPrefix(s.Data, xmpExtensionPrefix))
+}
+
+// dropXMPSegments returns sl without its XMP segments, and whether there
+// were any.
+func dropXMPSegments(sl *jpegstructure.SegmentList) (*jpegstructure.SegmentList, bool) {
+	segments := sl.Segments()
+	kept := make([]*jpegstructure.Segment, 0, len(segments))
+	for _, s := range segments {
+		if !isXMPSegment(s) {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(segments) {
+		return sl, false
 	}
+	return jpegstructure.NewSegmentList(kept), true
+}
 
-	// Display EXIF information
-	fmt.Printf("=== EXIF情報: %s ===\n", filepath.Base(heicPath))
-	if len(entries) == 0 {
-		fmt.Println("EXIF情報: なし")
-	} else {
-		printExifEntries(entries)
+// removedTags returns the tags of before that are missing from after,
+// matching tags by IFD path and ID.
+func removedTags(before, after []Tag) []Tag {
+	type key struct {
+		ifd string
+		id  uint16
 	}
-	fmt.Println()
+	left := make(map[key]bool, len(after))
+	for _, tag := range after {
+		left[key{tag.IFD, tag.ID}] = true
+	}
+	var removed []Tag
+	for _, tag := range before {
+		if !left[key{tag.IFD, tag.ID}] {
+			removed = append(removed, tag)
+		}
+	}
+	return removed
+}
+
+// ShowEXIFFromHEIC displays EXIF information from a HEIC file
+func ShowEXIFFromHEIC(heicPath string) error {
+	return FprintEXIFFromHEIC(os.Stdout, heicPath)
+}
 
+// FprintEXIFFromHEIC writes the EXIF information of a HEIC file to w in the
+// same format as ShowEXIFFromHEIC. Callers converting files concurrently use
+// it to buffer each file's output so that lines do not interleave.
+func FprintEXIFFromHEIC(w io.Writer, heicPath string) error {
+	tags, err := ReadTagsFromHEIC(heicPath)
+	if err != nil {
+		return err
+	}
+	FprintEXIFTags(w, heicPath, tags)
 	return nil
 }
 
+// FprintEXIFTags writes tags, as returned by ReadTagsFromHEIC for the file
+// at path, to w in the same format as ShowEXIFFromHEIC, for callers that
+// also need the tags themselves.
+func FprintEXIFTags(w io.Writer, path string, tags []Tag) {
+	fmt.Fprintf(w, "=== EXIF情報: %s ===\n", filepath.Base(path))
+	printExifEntries(w, tags)
+	fmt.Fprintln(w)
+}
+
 // ShowEXIFFromJPEG displays EXIF information from a JPEG file
 func ShowEXIFFromJPEG(jpegPath string) error {
 	// Read the JPEG file
@@ -336,16 +795,113 @@ func ShowEXIFFromJPEG(jpegPath string) error {
 
 	// Display EXIF information
 	fmt.Printf("=== EXIF情報: %s ===\n", filepath.Base(jpegPath))
-	printExifEntries(entries)
+	printExifEntries(os.Stdout, entryTags(entries))
 	fmt.Println()
 
 	return nil
 }
 
+// Tag is a single EXIF tag as listed by ReadTags.
+type Tag struct {
+	// IFD is the indexed path of the IFD holding the tag, e.g. "IFD0",
+	// "IFD0/Exif" or "IFD1" for the thumbnail IFD.
+	IFD string `json:"ifd" yaml:"ifd"`
+	ID  uint16 `json:"id" yaml:"id"`
+	// Name is the tag name, or "Tag_0xXXXX" for tags unknown to go-exif.
+	Name string `json:"name" yaml:"name"`
+	// Type is the EXIF type name, e.g. "ASCII" or "RATIONAL".
+	Type string `json:"type" yaml:"type"`
+	// Value is the human-readable value, as printed by ShowEXIFFromHEIC.
+	Value string `json:"value" yaml:"value"`
+	// Raw is the encoded value in hexadecimal, in the byte order of the
+	// EXIF payload.
+	Raw string `json:"raw" yaml:"raw"`
+
+	// ifdPath is the IFD path as go-exif spells it, omitting index 0, so
+	// that IFD0 tags match the keys of groupTags and IFD1 tags do not.
+	ifdPath string
+}
+
+// groupKey returns the key that identifies the tag in groupTags.
+func (t Tag) groupKey() tagKey {
+	return tagKey{t.ifdPath, t.ID}
+}
+
+// indexedIfdPath returns a fully-qualified IFD path as reported by go-exif
+// with the index of the top-level IFD spelled out: go-exif omits index 0,
+// so IFD0 would otherwise read "IFD" next to "IFD1".
+func indexedIfdPath(path string) string {
+	if path == ifd0Path || strings.HasPrefix(path, ifd0Path+"/") {
+		return ifd0Path + "0" + path[len(ifd0Path):]
+	}
+	return path
+}
+
+// ReadTags returns every tag of an EXIF payload, sorted by IFD path and tag
+// ID so that the tags of different files line up.
+func ReadTags(exifData []byte) ([]Tag, error) {
+	rawExif, err := exifv3.SearchAndExtractExif(exifData)
+	if err != nil {
+		rawExif = exifData
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rawExif, nil)
+	if err != nil {
+		return nil, fmt.Errorf("EXIF情報の解析に失敗しました: %w", err)
+	}
+
+	tags := entryTags(entries)
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].IFD != tags[j].IFD {
+			return tags[i].IFD < tags[j].IFD
+		}
+		return tags[i].ID < tags[j].ID
+	})
+	return tags, nil
+}
+
+// entryTags converts the entries returned by GetFlatExifData to Tags, in
+// the same order.
+func entryTags(entries []exifv3.ExifTag) []Tag {
+	tags := make([]Tag, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.TagName
+		if name == "" {
+			name = fmt.Sprintf("Tag_0x%04x", entry.TagId)
+		}
+		tags = append(tags, Tag{
+			IFD:     indexedIfdPath(entry.IfdPath),
+			ID:      entry.TagId,
+			Name:    name,
+			Type:    entry.TagTypeName,
+			Value:   entry.Formatted,
+			Raw:     hex.EncodeToString(entry.ValueBytes),
+			ifdPath: entry.IfdPath,
+		})
+	}
+	return tags
+}
+
+// ReadTagsFromHEIC returns the EXIF tags of a HEIC file (see ReadTags), or
+// nil if it has no EXIF data.
+func ReadTagsFromHEIC(heicPath string) ([]Tag, error) {
+	exifBytes, err := ExtractEXIFFromHEIC(heicPath)
+	if err != nil {
+		if errors.Is(err, ErrNoEXIF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("HEICファイルからEXIF情報の抽出に失敗しました: %w", err)
+	}
+	if len(exifBytes) == 0 {
+		return nil, nil
+	}
+	return ReadTags(exifBytes)
+}
+
 // printExifEntries displays EXIF entries in a formatted way
-func printExifEntries(entries []exifv3.ExifTag) {
+func printExifEntries(w io.Writer, entries []Tag) {
 	if len(entries) == 0 {
-		fmt.Println("EXIF情報: なし")
+		fmt.Fprintln(w, "EXIF情報: なし")
 		return
 	}
 
@@ -359,19 +915,15 @@ func printExifEntries(entries []exifv3.ExifTag) {
 	}
 
 	// Create a map for quick lookup
-	entryMap := make(map[string]exifv3.ExifTag)
+	entryMap := make(map[string]Tag)
 	for _, entry := range entries {
-		tagName := entry.TagName
-		if tagName == "" {
-			tagName = fmt.Sprintf("Tag_0x%04x", entry.TagId)
-		}
-		entryMap[tagName] = entry
+		entryMap[entry.Name] = entry
 	}
 
 	// Display important tags first
 	for _, tag := range importantTags {
 		if entry, ok := entryMap[tag]; ok {
-			fmt.Printf("  %s: %s\n", tag, entry.Formatted)
+			fmt.Fprintf(w, "  %s: %s\n", tag, entry.Value)
 			delete(entryMap, tag)
 		}
 	}
@@ -384,14 +936,14 @@ func printExifEntries(entries []exifv3.ExifTag) {
 		}
 
 		if len(otherTags) > 0 {
-			fmt.Printf("  その他のタグ (%d個):\n", len(otherTags))
+			fmt.Fprintf(w, "  その他のタグ (%d個):\n", len(otherTags))
 			for i, tag := range otherTags {
 				if i >= 10 {
-					fmt.Printf("    ... 他 %d 個のタグ\n", len(otherTags)-10)
+					fmt.Fprintf(w, "    ... 他 %d 個のタグ\n", len(otherTags)-10)
 					break
 				}
 				entry := entryMap[tag]
-				fmt.Printf("    %s: %s\n", tag, entry.Formatted)
+				fmt.Fprintf(w, "    %s: %s\n", tag, entry.Value)
 			}
 		}
 	}
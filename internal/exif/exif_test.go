@@ -1,13 +1,19 @@
 package exif
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"image"
+	"image/jpeg"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
-	"github.com/sugiyan97/heic-image-converter-cli/internal/converter"
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
 )
 
 // setupTestHEICFile copies the test HEIC file to a temporary directory
@@ -40,24 +46,39 @@ func setupTestHEICFile(t *testing.T) (string, func()) {
 	return destFile, cleanup
 }
 
-// setupTestJPEGFile creates a JPEG file from HEIC for testing
+// writeTestJPEG writes a small EXIF-less JPEG image to path. The pixels are
+// irrelevant to the EXIF tests, so a generated image stands in for a
+// converted photo.
+func writeTestJPEG(t *testing.T, path string) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Failed to encode test JPEG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test JPEG: %v", err)
+	}
+}
+
+// setupTestJPEGFile creates a JPEG file carrying the test HEIC file's EXIF
+// data for testing
 func setupTestJPEGFile(t *testing.T) (string, func()) {
 	t.Helper()
 
 	heicFile, _ := setupTestHEICFile(t)
 	// Don't defer cleanup here - we need the HEIC file to remain until cleanup is called
 
-	// Convert HEIC to JPEG
-	options := converter.ConvertOptions{RemoveEXIF: false}
-	if err := converter.ConvertHEICToJPEG(heicFile, options); err != nil {
-		_ = os.RemoveAll(filepath.Dir(heicFile))
-		t.Fatalf("Failed to convert HEIC to JPEG: %v", err)
-	}
-
-	jpegFile := converter.GenerateOutputPath(heicFile)
-	if _, err := os.Stat(jpegFile); os.IsNotExist(err) {
+	jpegFile := strings.TrimSuffix(heicFile, filepath.Ext(heicFile)) + ".jpg"
+	writeTestJPEG(t, jpegFile)
+	if err := CopyEXIFFromHEICToJPEG(heicFile, jpegFile); err != nil {
 		_ = os.RemoveAll(filepath.Dir(heicFile))
-		t.Fatalf("JPEG file was not created: %s", jpegFile)
+		t.Fatalf("Failed to copy EXIF to JPEG: %v", err)
 	}
 
 	cleanup := func() {
@@ -333,6 +354,231 @@ func TestExtractEXIFFromHEIC(t *testing.T) {
 	}
 }
 
+// TestRebuildEXIF tests that a HEIC EXIF payload is rebuilt into a valid
+// payload with the "Exif\0\0" marker
+func TestRebuildEXIF(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	exifData, err := ExtractEXIFFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ExtractEXIFFromHEIC failed: %v", err)
+	}
+
+	rebuilt, err := RebuildEXIF(exifData, RebuildOptions{})
+	if err != nil {
+		t.Fatalf("RebuildEXIF failed: %v", err)
+	}
+	if !bytes.HasPrefix(rebuilt, []byte("Exif\x00\x00")) {
+		t.Errorf("Rebuilt payload lacks the Exif marker: % x", rebuilt[:8])
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rebuilt[6:], nil)
+	if err != nil {
+		t.Fatalf("Rebuilt payload is not parseable: %v", err)
+	}
+	tagNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		tagNames = append(tagNames, entry.TagName)
+	}
+	if !containsTag(tagNames, "Make") || !containsTag(tagNames, "DateTimeOriginal") {
+		t.Errorf("Expected Make and DateTimeOriginal to survive, got tags: %v", tagNames)
+	}
+
+	if _, err := RebuildEXIF([]byte("not exif"), RebuildOptions{}); err == nil {
+		t.Error("Expected error for invalid EXIF data")
+	}
+}
+
+// TestRebuildEXIF_Options tests resetting Orientation and updating the
+// pixel dimensions
+func TestRebuildEXIF_Options(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	exifData, err := ExtractEXIFFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ExtractEXIFFromHEIC failed: %v", err)
+	}
+	if orientation, err := ReadOrientation(exifData); err != nil || orientation == 1 {
+		t.Fatalf("Sample file should have a non-default Orientation, got %d (err: %v)", orientation, err)
+	}
+
+	rebuilt, err := RebuildEXIF(exifData, RebuildOptions{ResetOrientation: true, Width: 300, Height: 400})
+	if err != nil {
+		t.Fatalf("RebuildEXIF failed: %v", err)
+	}
+
+	if orientation, err := ReadOrientation(rebuilt); err != nil || orientation != 1 {
+		t.Errorf("Orientation = %d (err: %v), want 1", orientation, err)
+	}
+
+	info, err := ReadImageInfo(rebuilt)
+	if err != nil {
+		t.Fatalf("Failed to parse rebuilt EXIF: %v", err)
+	}
+	if info.Width != 300 || info.Height != 400 {
+		t.Errorf("Dimensions = %dx%d, want 300x400", info.Width, info.Height)
+	}
+}
+
+// buildOversizedEXIF encodes an EXIF payload with a thumbnail, a maker note
+// and an image description of the given sizes (0 for none).
+func buildOversizedEXIF(t *testing.T, thumbnail, makerNote, description int) []byte {
+	t.Helper()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		t.Fatalf("NewIfdMappingWithStandard failed: %v", err)
+	}
+	ti := exifv3.NewTagIndex()
+
+	rootIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, binary.BigEndian)
+	if err := rootIb.AddStandardWithName("Make", "Apple"); err != nil {
+		t.Fatalf("Failed to add Make: %v", err)
+	}
+	if description > 0 {
+		if err := rootIb.AddStandardWithName("ImageDescription", strings.Repeat("x", description)); err != nil {
+			t.Fatalf("Failed to add ImageDescription: %v", err)
+		}
+	}
+	exifIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdExifStandardIfdIdentity, binary.BigEndian)
+	if makerNote > 0 {
+		value := exifv3.NewIfdBuilderTagValueFromBytes(bytes.Repeat([]byte{0x5A}, makerNote))
+		bt := exifv3.NewBuilderTag(exifPath, 0x927c, exifcommon.TypeUndefined, value, binary.BigEndian)
+		if err := exifIb.Add(bt); err != nil {
+			t.Fatalf("Failed to add MakerNote: %v", err)
+		}
+	}
+	if err := exifIb.AddStandardWithName("ExposureTime", []exifcommon.Rational{{Numerator: 1, Denominator: 60}}); err != nil {
+		t.Fatalf("Failed to add ExposureTime: %v", err)
+	}
+	if err := rootIb.AddChildIb(exifIb); err != nil {
+		t.Fatalf("AddChildIb failed: %v", err)
+	}
+
+	if thumbnail > 0 {
+		ifd1Ib := exifv3.NewIfdBuilder(im, ti, exifcommon.Ifd1StandardIfdIdentity, binary.BigEndian)
+		if err := ifd1Ib.SetThumbnail(bytes.Repeat([]byte{0xA5}, thumbnail)); err != nil {
+			t.Fatalf("SetThumbnail failed: %v", err)
+		}
+		if err := rootIb.SetNextIb(ifd1Ib); err != nil {
+			t.Fatalf("SetNextIb failed: %v", err)
+		}
+	}
+
+	encoded, err := exifv3.NewIfdByteEncoder().EncodeToExif(rootIb)
+	if err != nil {
+		t.Fatalf("EncodeToExif failed: %v", err)
+	}
+	return append([]byte("Exif\x00\x00"), encoded...)
+}
+
+// TestShrinkEXIF tests that the thumbnail and then the maker note are
+// removed until the payload fits, and no more
+func TestShrinkEXIF(t *testing.T) {
+	t.Parallel()
+	const maxSize = 0xFFFF - 2
+
+	tests := []struct {
+		name                              string
+		thumbnail, makerNote, description int
+		wantGroups                        []TagGroup
+		wantErr                           bool
+	}{
+		{"fits", 1000, 1000, 0, nil, false},
+		{"thumbnail only", 70000, 1000, 0, []TagGroup{TagGroupThumbnail}, false},
+		{"thumbnail and maker note", 20000, 50000, 20000, []TagGroup{TagGroupThumbnail, TagGroupMakerNote}, false},
+		{"maker note without thumbnail", 0, 70000, 0, []TagGroup{TagGroupMakerNote}, false},
+		{"too large", 1000, 1000, 70000, []TagGroup{TagGroupThumbnail, TagGroupMakerNote}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			exifData := buildOversizedEXIF(t, tt.thumbnail, tt.makerNote, tt.description)
+
+			shrunk, removals, err := ShrinkEXIF(exifData, maxSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShrinkEXIF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var groups []TagGroup
+			for _, r := range removals {
+				if r.Size <= 0 {
+					t.Errorf("Removal %s saved %d bytes", r.Group, r.Size)
+				}
+				groups = append(groups, r.Group)
+			}
+			if !slices.Equal(groups, tt.wantGroups) {
+				t.Errorf("Removed %v, want %v", groups, tt.wantGroups)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(shrunk) > maxSize {
+				t.Errorf("Shrunk payload is %d bytes, want at most %d", len(shrunk), maxSize)
+			}
+			if removals == nil && !bytes.Equal(shrunk, exifData) {
+				t.Error("Expected a payload that fits to be returned unchanged")
+			}
+			tags, err := ReadTags(shrunk)
+			if err != nil {
+				t.Fatalf("ReadTags failed: %v", err)
+			}
+			var names []string
+			for _, tag := range tags {
+				names = append(names, tag.Name)
+			}
+			if !containsTag(names, "Make") || !containsTag(names, "ExposureTime") {
+				t.Errorf("Expected the other tags to be kept, got %v", names)
+			}
+			wantMakerNote := tt.makerNote > 0 && !slices.Contains(groups, TagGroupMakerNote)
+			if got := containsTag(names, "MakerNote"); got != wantMakerNote {
+				t.Errorf("MakerNote kept = %v, want %v", got, wantMakerNote)
+			}
+			wantThumbnail := tt.thumbnail > 0 && !slices.Contains(groups, TagGroupThumbnail)
+			if got := hasThumbnail(t, shrunk[len("Exif\x00\x00"):]); got != wantThumbnail {
+				t.Errorf("Thumbnail kept = %v, want %v", got, wantThumbnail)
+			}
+		})
+	}
+}
+
+// TestExtractImageInfoFromHEIC tests reading the fields used for output
+// file naming
+func TestExtractImageInfoFromHEIC(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	info, err := ExtractImageInfoFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ExtractImageInfoFromHEIC failed: %v", err)
+	}
+
+	if info.DateTimeOriginal.IsZero() {
+		t.Error("Expected DateTimeOriginal to be set")
+	}
+	if info.Make == "" || info.Model == "" {
+		t.Errorf("Expected Make and Model to be set, got %q / %q", info.Make, info.Model)
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		t.Errorf("Expected positive dimensions, got %dx%d", info.Width, info.Height)
+	}
+}
+
+// TestExtractImageInfoFromHEIC_NoEXIF tests that a file without EXIF reports
+// ErrNoEXIF
+func TestExtractImageInfoFromHEIC_NoEXIF(t *testing.T) {
+	t.Parallel()
+
+	heicFile := filepath.Join("..", "..", "test_images", "test_no_exif.HEIC")
+	if _, err := ExtractImageInfoFromHEIC(heicFile); !errors.Is(err, ErrNoEXIF) {
+		t.Errorf("Expected ErrNoEXIF, got %v", err)
+	}
+}
+
 // TestExtractEXIFFromHEIC_InvalidFile tests that a genuine extraction failure
 // (e.g. a corrupted/non-HEIC file) is reported as an error distinct from
 // ErrNoEXIF, so callers don't silently treat it as "no EXIF present".
@@ -380,13 +626,9 @@ func TestCopyEXIFFromHEICToJPEG(t *testing.T) {
 	heicFile, cleanupHEIC := setupTestHEICFile(t)
 	defer cleanupHEIC()
 
-	// Convert to JPEG first
-	options := converter.ConvertOptions{RemoveEXIF: false}
-	if err := converter.ConvertHEICToJPEG(heicFile, options); err != nil {
-		t.Fatalf("Failed to convert HEIC to JPEG: %v", err)
-	}
-
-	jpegFile := converter.GenerateOutputPath(heicFile)
+	// Start from a JPEG without EXIF
+	jpegFile := strings.TrimSuffix(heicFile, filepath.Ext(heicFile)) + ".jpg"
+	writeTestJPEG(t, jpegFile)
 	defer func() {
 		_ = os.Remove(jpegFile)
 		_ = os.Remove(heicFile)
@@ -501,3 +743,139 @@ func TestFindJPEGFiles_NonexistentDirectory(t *testing.T) {
 	}
 }
 
+// TestReadContentIdentifier tests that a photo that is not a Live Photo has
+// no content identifier even though it has an Apple maker note
+func TestReadContentIdentifier(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	exifData, err := ExtractEXIFFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ExtractEXIFFromHEIC failed: %v", err)
+	}
+	id, err := ReadContentIdentifier(exifData)
+	if err != nil {
+		t.Fatalf("ReadContentIdentifier failed: %v", err)
+	}
+	if id != "" {
+		t.Errorf("Expected no content identifier, got %q", id)
+	}
+}
+
+// appleMakerNote builds an Apple maker note with a single ASCII tag
+func appleMakerNote(bigEndian bool, tag uint16, value string) []byte {
+	put16 := func(b []byte, v uint16) {
+		if bigEndian {
+			b[0], b[1] = byte(v>>8), byte(v)
+		} else {
+			b[0], b[1] = byte(v), byte(v>>8)
+		}
+	}
+	put32 := func(b []byte, v uint32) {
+		if bigEndian {
+			b[0], b[1], b[2], b[3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+		} else {
+			b[0], b[1], b[2], b[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+		}
+	}
+
+	note := []byte(appleMakerNoteHeader + "\x00\x01")
+	if bigEndian {
+		note = append(note, "MM"...)
+	} else {
+		note = append(note, "II"...)
+	}
+	ifd := make([]byte, 2+12+4)
+	put16(ifd[0:], 1)
+	put16(ifd[2:], tag)
+	put16(ifd[4:], 2) // ASCII
+	data := append([]byte(value), 0)
+	put32(ifd[6:], uint32(len(data)))
+	if len(data) <= 4 {
+		copy(ifd[10:], data)
+		return append(note, ifd...)
+	}
+	put32(ifd[10:], uint32(len(note)+len(ifd)))
+	return append(append(note, ifd...), data...)
+}
+
+func TestAppleMakerNoteString(t *testing.T) {
+	t.Parallel()
+	const id = "2F9D8A24-5C71-4E0B-9D3A-7B1E0C6F4A52"
+	tests := []struct {
+		name string
+		note []byte
+		want string
+	}{
+		{"big endian", appleMakerNote(true, appleContentIdentifierTag, id), id},
+		{"little endian", appleMakerNote(false, appleContentIdentifierTag, id), id},
+		{"inline value", appleMakerNote(true, appleContentIdentifierTag, "abc"), "abc"},
+		{"other tag", appleMakerNote(true, 0x0020, id), ""},
+		{"not Apple", []byte("Nikon\x00\x02\x10\x00\x00MM\x00\x00"), ""},
+		{"truncated", appleMakerNote(true, appleContentIdentifierTag, id)[:20], ""},
+	}
+	for _, tt := range tests {
+		if got := appleMakerNoteString(tt.note, appleContentIdentifierTag); got != tt.want {
+			t.Errorf("%s: appleMakerNoteString() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestReadTags_IndexedIFD verifies that the tags of IFD0 and the IFD1
+// thumbnail IFD are told apart and do not interleave
+func TestReadTags_IndexedIFD(t *testing.T) {
+	t.Parallel()
+	tags, err := ReadTags(buildOversizedEXIF(t, 100, 100, 10))
+	if err != nil {
+		t.Fatalf("ReadTags failed: %v", err)
+	}
+
+	ifds := map[string]string{}
+	for _, tag := range tags {
+		ifds[tag.Name] = tag.IFD
+	}
+	want := map[string]string{
+		"Make":                  "IFD0",
+		"ExposureTime":          "IFD0/Exif",
+		"JPEGInterchangeFormat": "IFD1",
+	}
+	for name, ifd := range want {
+		if ifds[name] != ifd {
+			t.Errorf("%s: IFD = %q, want %q", name, ifds[name], ifd)
+		}
+	}
+	if last := tags[len(tags)-1]; last.IFD != "IFD1" {
+		t.Errorf("Expected the IFD1 tags to come last, got %+v", last)
+	}
+}
+
+// TestReadTagsFromHEIC tests listing the EXIF tags of a HEIC file
+func TestReadTagsFromHEIC(t *testing.T) {
+	t.Parallel()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	tags, err := ReadTagsFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ReadTagsFromHEIC failed: %v", err)
+	}
+
+	found := false
+	for i, tag := range tags {
+		if tag.Name == "Make" {
+			found = tag.IFD == "IFD0" && tag.ID == 0x010f && tag.Type == "ASCII" && tag.Value == "Apple" && tag.Raw == "4170706c6500"
+		}
+		if i > 0 && (tags[i-1].IFD > tag.IFD || tags[i-1].IFD == tag.IFD && tags[i-1].ID > tag.ID) {
+			t.Errorf("Tags are not sorted: %+v before %+v", tags[i-1], tag)
+		}
+	}
+	if !found {
+		t.Errorf("Expected a Make tag in IFD0, got %+v", tags)
+	}
+
+	noEXIF := filepath.Join("..", "..", "test_images", "test_no_exif.HEIC")
+	if tags, err := ReadTagsFromHEIC(noEXIF); err != nil || tags != nil {
+		t.Errorf("Expected no tags for a file without EXIF, got %v, %v", tags, err)
+	}
+}
@@ -0,0 +1,241 @@
+package exif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+)
+
+// TagGroup names a set of EXIF tags that TagFilter strips or keeps
+// together.
+type TagGroup string
+
+const (
+	// TagGroupGPS is the whole GPS IFD: coordinates, altitude, direction,
+	// speed and the GPS time stamp.
+	TagGroupGPS TagGroup = "gps"
+	// TagGroupSerials is the serial numbers of the camera body and lens.
+	TagGroupSerials TagGroup = "serials"
+	// TagGroupOwner is the name of the camera owner and of the
+	// photographer.
+	TagGroupOwner TagGroup = "owner"
+	// TagGroupMakerNote is the vendor-specific maker note, which can hold
+	// anything from focus points to device identifiers.
+	TagGroupMakerNote TagGroup = "makernote"
+	// TagGroupThumbnail is IFD1 with its embedded thumbnail image, which may
+	// still show an uncropped version of the photo.
+	TagGroupThumbnail TagGroup = "thumbnail"
+	// TagGroupXMP is the XMP packet stored next to the EXIF data. It is kept
+	// or removed as a whole, as its properties (ratings, keywords, regions
+	// and possibly a location) are not EXIF tags.
+	TagGroupXMP TagGroup = "xmp"
+)
+
+// tagKey identifies a tag by the unindexed path of its IFD and its ID.
+type tagKey struct {
+	ifd string
+	id  uint16
+}
+
+var (
+	ifd0Path = exifcommon.IfdStandardIfdIdentity.UnindexedString()
+	exifPath = exifcommon.IfdExifStandardIfdIdentity.UnindexedString()
+	gpsPath  = exifcommon.IfdGpsInfoStandardIfdIdentity.UnindexedString()
+)
+
+// groupTags lists the tags of the groups made of individual tags. The GPS
+// and thumbnail groups are whole IFDs instead, and the XMP group is not
+// part of the EXIF data at all.
+var groupTags = map[TagGroup][]tagKey{
+	TagGroupSerials: {
+		{exifPath, 0xa431}, // BodySerialNumber
+		{exifPath, 0xa435}, // LensSerialNumber
+		{ifd0Path, 0xc62f}, // CameraSerialNumber (DNG)
+	},
+	TagGroupOwner: {
+		{exifPath, 0xa430}, // CameraOwnerName
+		{ifd0Path, 0x013b}, // Artist
+	},
+	TagGroupMakerNote: {
+		{exifPath, 0x927c}, // MakerNote
+	},
+}
+
+// TagGroups returns the names of the tag groups accepted by NewTagFilter.
+func TagGroups() []string {
+	return []string{string(TagGroupGPS), string(TagGroupSerials), string(TagGroupOwner), string(TagGroupMakerNote), string(TagGroupThumbnail), string(TagGroupXMP)}
+}
+
+// tagSet is a list of tag groups, tag names and tag IDs.
+type tagSet struct {
+	groups map[TagGroup]bool
+	names  map[string]bool
+	// ids holds the tags given by ID, such as those go-exif does not know
+	// and ReadTags lists as "Tag_0xXXXX". They match in any IFD.
+	ids map[uint16]bool
+}
+
+// contains reports whether the tag id named name in the IFD at ifdPath is
+// in the set.
+func (s *tagSet) contains(ifdPath string, id uint16, name string) bool {
+	if s.names[name] || s.ids[id] || (ifdPath == gpsPath && s.groups[TagGroupGPS]) {
+		return true
+	}
+	for group := range s.groups {
+		for _, key := range groupTags[group] {
+			if key == (tagKey{ifdPath, id}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TagFilter selects the EXIF tags that RebuildEXIF keeps. A tag is removed
+// if it is in the strip list, or if there is a keep list and the tag is not
+// in it. Sub-IFDs left without tags, such as the GPS IFD once every GPS tag
+// is removed, are removed along with the tag pointing at them. The XMP
+// packet, which is not part of the EXIF data, is kept or removed as a whole
+// (see KeepsXMP and KeepsXMPLocation). A nil *TagFilter keeps every tag.
+type TagFilter struct {
+	strip tagSet
+	// keep is nil if every tag that is not stripped is kept.
+	keep *tagSet
+}
+
+// NewTagFilter returns a filter removing the tags in strip and, if keep is
+// not empty, every tag not in keep. Each entry is either a tag group (see
+// TagGroups, case-insensitive) or a tag name as listed by ReadTags, such as
+// "DateTimeOriginal" or "Tag_0x0001" for a tag go-exif does not know. A tag
+// ID alone ("0x0001") is accepted too. It returns nil if both lists are
+// empty.
+func NewTagFilter(strip, keep []string) (*TagFilter, error) {
+	if len(strip) == 0 && len(keep) == 0 {
+		return nil, nil
+	}
+
+	f := &TagFilter{}
+	var err error
+	if f.strip, err = parseTagSet(strip); err != nil {
+		return nil, err
+	}
+	if len(keep) > 0 {
+		set, err := parseTagSet(keep)
+		if err != nil {
+			return nil, err
+		}
+		f.keep = &set
+	}
+	return f, nil
+}
+
+// parseTagSet parses a list of tag groups, tag names and tag IDs.
+func parseTagSet(entries []string) (tagSet, error) {
+	set := tagSet{groups: map[TagGroup]bool{}, names: map[string]bool{}, ids: map[uint16]bool{}}
+	ti := exifv3.NewTagIndex()
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if group := TagGroup(strings.ToLower(entry)); isTagGroup(group) {
+			set.groups[group] = true
+			continue
+		}
+		if id, ok := parseTagID(entry); ok {
+			set.ids[id] = true
+			continue
+		}
+		if !isStandardTagName(ti, entry) {
+			return tagSet{}, fmt.Errorf("不明なEXIFタグまたはグループです: %s（グループ: %s）", entry, strings.Join(TagGroups(), ", "))
+		}
+		set.names[entry] = true
+	}
+	return set, nil
+}
+
+// parseTagID parses a tag given by ID, as "Tag_0xXXXX" (the name ReadTags
+// lists for tags go-exif does not know) or "0xXXXX".
+func parseTagID(entry string) (uint16, bool) {
+	digits, ok := strings.CutPrefix(strings.TrimPrefix(strings.ToLower(entry), "tag_"), "0x")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(digits, 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(id), true
+}
+
+// isTagGroup reports whether group is one of TagGroups.
+func isTagGroup(group TagGroup) bool {
+	for _, g := range TagGroups() {
+		if string(group) == g {
+			return true
+		}
+	}
+	return false
+}
+
+// isStandardTagName reports whether name is a tag go-exif knows in any of
+// the standard IFDs.
+func isStandardTagName(ti *exifv3.TagIndex, name string) bool {
+	for _, ii := range []*exifcommon.IfdIdentity{
+		exifcommon.IfdStandardIfdIdentity,
+		exifcommon.IfdExifStandardIfdIdentity,
+		exifcommon.IfdGpsInfoStandardIfdIdentity,
+		exifcommon.IfdExifIopStandardIfdIdentity,
+	} {
+		if _, err := ti.GetWithName(ii, name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsTag reports whether the tag id named name in the IFD ii is kept.
+func (f *TagFilter) keepsTag(ii *exifcommon.IfdIdentity, id uint16, name string) bool {
+	if f == nil {
+		return true
+	}
+	ifdPath := ii.UnindexedString()
+	if f.strip.contains(ifdPath, id, name) {
+		return false
+	}
+	return f.keep == nil || f.keep.contains(ifdPath, id, name)
+}
+
+// keepsThumbnail reports whether IFD1 and the thumbnail image are kept.
+func (f *TagFilter) keepsThumbnail() bool {
+	if f == nil {
+		return true
+	}
+	if f.strip.groups[TagGroupThumbnail] {
+		return false
+	}
+	return f.keep == nil || f.keep.groups[TagGroupThumbnail]
+}
+
+// KeepsXMP reports whether the XMP packet is kept.
+func (f *TagFilter) KeepsXMP() bool {
+	if f == nil {
+		return true
+	}
+	if f.strip.groups[TagGroupXMP] {
+		return false
+	}
+	return f.keep == nil || f.keep.groups[TagGroupXMP]
+}
+
+// KeepsXMPLocation reports whether an XMP packet carrying a location (see
+// XMPHasLocation) is kept. XMP properties are not removed one by one, so
+// such a packet is removed whenever the GPS latitude or longitude tag is,
+// lest it leak the location the filter hides.
+func (f *TagFilter) KeepsXMPLocation() bool {
+	gps := exifcommon.IfdGpsInfoStandardIfdIdentity
+	return f.KeepsXMP() && f.keepsTag(gps, 0x0002, "GPSLatitude") && f.keepsTag(gps, 0x0004, "GPSLongitude")
+}
@@ -0,0 +1,274 @@
+package exif
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	exifv3 "github.com/dsoprea/go-exif/v3"
+	exifcommon "github.com/dsoprea/go-exif/v3/common"
+)
+
+// rebuiltTagNames rebuilds the EXIF data of test_images/test.HEIC with
+// filter and returns the names of the remaining tags.
+func rebuiltTagNames(t *testing.T, filter *TagFilter) []string {
+	t.Helper()
+	heicFile, cleanup := setupTestHEICFile(t)
+	defer cleanup()
+
+	exifData, err := ExtractEXIFFromHEIC(heicFile)
+	if err != nil {
+		t.Fatalf("ExtractEXIFFromHEIC failed: %v", err)
+	}
+	rebuilt, err := RebuildEXIF(exifData, RebuildOptions{Filter: filter})
+	if err != nil {
+		t.Fatalf("RebuildEXIF failed: %v", err)
+	}
+	tags, err := ReadTags(rebuilt)
+	if err != nil {
+		t.Fatalf("Rebuilt payload is not parseable: %v", err)
+	}
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// TestRebuildEXIF_StripTags tests removing the GPS IFD and the maker note
+// while keeping the camera settings
+func TestRebuildEXIF_StripTags(t *testing.T) {
+	t.Parallel()
+	filter, err := NewTagFilter([]string{"gps", "MakerNote"}, nil)
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+
+	names := rebuiltTagNames(t, filter)
+	for _, removed := range []string{"GPSTag", "GPSLatitude", "GPSLongitude", "MakerNote"} {
+		if containsTag(names, removed) {
+			t.Errorf("Expected %s to be removed, got tags: %v", removed, names)
+		}
+	}
+	for _, kept := range []string{"Make", "Model", "ExposureTime", "FNumber", "LensModel", "DateTimeOriginal"} {
+		if !containsTag(names, kept) {
+			t.Errorf("Expected %s to be kept, got tags: %v", kept, names)
+		}
+	}
+}
+
+// TestRebuildEXIF_KeepTags tests keeping only the listed tags and groups
+func TestRebuildEXIF_KeepTags(t *testing.T) {
+	t.Parallel()
+	filter, err := NewTagFilter(nil, []string{"Orientation", "DateTimeOriginal", "GPS"})
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+
+	names := rebuiltTagNames(t, filter)
+	for _, name := range names {
+		switch name {
+		case "Orientation", "DateTimeOriginal", "ExifTag", "GPSTag":
+		default:
+			if len(name) < 3 || name[:3] != "GPS" {
+				t.Errorf("Unexpected tag %s kept", name)
+			}
+		}
+	}
+	for _, kept := range []string{"Orientation", "DateTimeOriginal", "GPSLatitude"} {
+		if !containsTag(names, kept) {
+			t.Errorf("Expected %s to be kept, got tags: %v", kept, names)
+		}
+	}
+}
+
+// TestRebuildEXIF_StripSerialsOwnerThumbnail tests the groups that the
+// sample file lacks, on EXIF data built for the test
+func TestRebuildEXIF_StripSerialsOwnerThumbnail(t *testing.T) {
+	t.Parallel()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		t.Fatalf("NewIfdMappingWithStandard failed: %v", err)
+	}
+	ti := exifv3.NewTagIndex()
+
+	rootIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, binary.BigEndian)
+	for name, value := range map[string]string{"Make": "Apple", "Artist": "Jane Doe"} {
+		if err := rootIb.AddStandardWithName(name, value); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+	exifIb := exifv3.NewIfdBuilder(im, ti, exifcommon.IfdExifStandardIfdIdentity, binary.BigEndian)
+	for name, value := range map[string]string{"BodySerialNumber": "C39XK", "CameraOwnerName": "Jane Doe"} {
+		if err := exifIb.AddStandardWithName(name, value); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+	if err := rootIb.AddChildIb(exifIb); err != nil {
+		t.Fatalf("AddChildIb failed: %v", err)
+	}
+	ifd1Ib := exifv3.NewIfdBuilder(im, ti, exifcommon.Ifd1StandardIfdIdentity, binary.BigEndian)
+	if err := ifd1Ib.SetThumbnail([]byte{0xFF, 0xD8, 0xFF, 0xD9}); err != nil {
+		t.Fatalf("SetThumbnail failed: %v", err)
+	}
+	if err := rootIb.SetNextIb(ifd1Ib); err != nil {
+		t.Fatalf("SetNextIb failed: %v", err)
+	}
+	exifData, err := exifv3.NewIfdByteEncoder().EncodeToExif(rootIb)
+	if err != nil {
+		t.Fatalf("EncodeToExif failed: %v", err)
+	}
+
+	if !hasThumbnail(t, exifData) {
+		t.Fatal("Test data should have a thumbnail")
+	}
+
+	filter, err := NewTagFilter([]string{"serials", "owner", "thumbnail"}, nil)
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+	rebuilt, err := RebuildEXIF(exifData, RebuildOptions{Filter: filter})
+	if err != nil {
+		t.Fatalf("RebuildEXIF failed: %v", err)
+	}
+
+	entries, _, err := exifv3.GetFlatExifData(rebuilt[6:], nil)
+	if err != nil {
+		t.Fatalf("Rebuilt payload is not parseable: %v", err)
+	}
+	if len(entries) != 1 || entries[0].TagName != "Make" {
+		t.Errorf("Expected only Make to be kept (and the emptied Exif IFD removed), got %v", entries)
+	}
+	if hasThumbnail(t, rebuilt[6:]) {
+		t.Error("Expected the thumbnail to be removed")
+	}
+
+	// Keeping nothing at all leaves no EXIF data.
+	filter, err = NewTagFilter(nil, []string{"GPSLatitude"})
+	if err != nil {
+		t.Fatalf("NewTagFilter failed: %v", err)
+	}
+	if rebuilt, err := RebuildEXIF(exifData, RebuildOptions{Filter: filter}); err != nil || rebuilt != nil {
+		t.Errorf("RebuildEXIF = %d bytes (err: %v), want nil", len(rebuilt), err)
+	}
+}
+
+// hasThumbnail reports whether the raw EXIF data has a thumbnail image.
+func hasThumbnail(t *testing.T, rawExif []byte) bool {
+	t.Helper()
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		t.Fatalf("NewIfdMappingWithStandard failed: %v", err)
+	}
+	_, index, err := exifv3.Collect(im, exifv3.NewTagIndex(), rawExif)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	for cur := index.RootIfd; cur != nil; cur = cur.NextIfd() {
+		if _, err := cur.Thumbnail(); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TestNewTagFilter tests parsing tag groups and tag names
+func TestNewTagFilter(t *testing.T) {
+	if filter, err := NewTagFilter(nil, nil); err != nil || filter != nil {
+		t.Errorf("NewTagFilter(nil, nil) = %v, %v; want nil, nil", filter, err)
+	}
+	if _, err := NewTagFilter([]string{"GPS", " Serials ", "LensModel"}, []string{"makernote"}); err != nil {
+		t.Errorf("Expected groups and tag names to be accepted, got: %v", err)
+	}
+	if _, err := NewTagFilter([]string{"location"}, nil); err == nil {
+		t.Error("Expected error for unknown group")
+	}
+	if _, err := NewTagFilter(nil, []string{"lensmodel"}); err == nil {
+		t.Error("Expected error for tag name with the wrong case")
+	}
+}
+
+// TestRebuildEXIF_TagByID tests selecting tags by ID, as "Tag_0xXXXX" (the
+// name ReadTags lists for tags go-exif does not know) or "0xXXXX"
+func TestRebuildEXIF_TagByID(t *testing.T) {
+	t.Parallel()
+	stripped := rebuiltTagNames(t, mustTagFilter(t, []string{"Tag_0x010f"}, nil))
+	if containsTag(stripped, "Make") || !containsTag(stripped, "Model") {
+		t.Errorf("Expected only Make (0x010f) to be removed, got %v", stripped)
+	}
+
+	kept := rebuiltTagNames(t, mustTagFilter(t, nil, []string{"0x010F", "tag_0x0110"}))
+	if !slices.Equal(kept, []string{"Make", "Model"}) {
+		t.Errorf("Expected only Make and Model to be kept, got %v", kept)
+	}
+
+	if _, err := NewTagFilter([]string{"Tag_0x0001"}, nil); err != nil {
+		t.Errorf("Expected a tag ID to be accepted, got: %v", err)
+	}
+	for _, entry := range []string{"Tag_0xzzzz", "Tag_0x12345", "0x"} {
+		if _, err := NewTagFilter([]string{entry}, nil); err == nil {
+			t.Errorf("Expected error for %q", entry)
+		}
+	}
+}
+
+// mustTagFilter returns NewTagFilter(strip, keep), failing the test on
+// error.
+func mustTagFilter(t *testing.T, strip, keep []string) *TagFilter {
+	t.Helper()
+	filter, err := NewTagFilter(strip, keep)
+	if err != nil {
+		t.Fatalf("NewTagFilter(%v, %v) failed: %v", strip, keep, err)
+	}
+	return filter
+}
+
+// TestTagFilter_KeepsXMP tests selecting the XMP packet as a whole
+func TestTagFilter_KeepsXMP(t *testing.T) {
+	tests := []struct {
+		strip, keep []string
+		want        bool
+	}{
+		{nil, nil, true},
+		{[]string{"gps"}, nil, true},
+		{[]string{"XMP"}, nil, false},
+		{nil, []string{"Orientation"}, false},
+		{nil, []string{"Orientation", "xmp"}, true},
+	}
+	for _, tt := range tests {
+		filter, err := NewTagFilter(tt.strip, tt.keep)
+		if err != nil {
+			t.Fatalf("NewTagFilter(%v, %v) failed: %v", tt.strip, tt.keep, err)
+		}
+		if got := filter.KeepsXMP(); got != tt.want {
+			t.Errorf("NewTagFilter(%v, %v).KeepsXMP() = %v, want %v", tt.strip, tt.keep, got, tt.want)
+		}
+	}
+}
+
+// TestTagFilter_KeepsXMPLocation tests that an XMP packet with a location
+// goes with the GPS coordinates
+func TestTagFilter_KeepsXMPLocation(t *testing.T) {
+	tests := []struct {
+		strip, keep []string
+		want        bool
+	}{
+		{nil, nil, true},
+		{[]string{"gps"}, nil, false},
+		{[]string{"GPSLongitude"}, nil, false},
+		{[]string{"GPSAltitude"}, nil, true},
+		{[]string{"serials"}, nil, true},
+		{[]string{"xmp"}, nil, false},
+		{nil, []string{"xmp"}, false},
+		{nil, []string{"xmp", "gps"}, true},
+	}
+	for _, tt := range tests {
+		filter, err := NewTagFilter(tt.strip, tt.keep)
+		if err != nil {
+			t.Fatalf("NewTagFilter(%v, %v) failed: %v", tt.strip, tt.keep, err)
+		}
+		if got := filter.KeepsXMPLocation(); got != tt.want {
+			t.Errorf("NewTagFilter(%v, %v).KeepsXMPLocation() = %v, want %v", tt.strip, tt.keep, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package exif
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPrivacyProfiles tests that every profile names valid tags and groups
+func TestPrivacyProfiles(t *testing.T) {
+	for _, p := range PrivacyProfiles() {
+		filter, err := p.TagFilter()
+		if err != nil {
+			t.Errorf("Profile %s has an invalid tag list: %v", p.Name, err)
+		}
+		if (filter == nil) != (p.Name == "forensic") {
+			t.Errorf("Profile %s: filter = %v, want nil only for forensic", p.Name, filter)
+		}
+	}
+
+	if p, err := LookupPrivacyProfile("Share"); err != nil || p.Name != "share" {
+		t.Errorf("LookupPrivacyProfile(Share) = %v, %v", p.Name, err)
+	}
+	if _, err := LookupPrivacyProfile("secret"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
+
+// TestFilterEXIFInJPEG tests applying privacy profiles to an existing JPEG
+func TestFilterEXIFInJPEG(t *testing.T) {
+	t.Parallel()
+
+	filterFor := func(name string) *TagFilter {
+		p, err := LookupPrivacyProfile(name)
+		if err != nil {
+			t.Fatalf("LookupPrivacyProfile failed: %v", err)
+		}
+		filter, err := p.TagFilter()
+		if err != nil {
+			t.Fatalf("TagFilter failed: %v", err)
+		}
+		return filter
+	}
+
+	t.Run("share", func(t *testing.T) {
+		t.Parallel()
+		jpegFile, cleanup := setupTestJPEGFile(t)
+		defer cleanup()
+
+		removed, err := FilterEXIFInJPEG(jpegFile, filterFor("share"))
+		if err != nil {
+			t.Fatalf("FilterEXIFInJPEG failed: %v", err)
+		}
+		removedNames := make([]string, 0, len(removed))
+		for _, tag := range removed {
+			removedNames = append(removedNames, tag.Name)
+		}
+		for _, name := range []string{"GPSLatitude", "MakerNote"} {
+			if !containsTag(removedNames, name) {
+				t.Errorf("Expected %s to be reported as removed, got %v", name, removedNames)
+			}
+		}
+
+		_, tagNames, err := CheckEXIFInJPEG(jpegFile)
+		if err != nil {
+			t.Fatalf("CheckEXIFInJPEG failed: %v", err)
+		}
+		if containsTag(tagNames, "GPSLatitude") || containsTag(tagNames, "MakerNote") {
+			t.Errorf("Expected GPS and maker note to be removed, got %v", tagNames)
+		}
+		if !containsTag(tagNames, "DateTimeOriginal") || !containsTag(tagNames, "ExposureTime") {
+			t.Errorf("Expected camera settings to be kept, got %v", tagNames)
+		}
+
+		// Applying the profile again changes nothing.
+		if removed, err := FilterEXIFInJPEG(jpegFile, filterFor("share")); err != nil || len(removed) != 0 {
+			t.Errorf("Second pass removed %d tags (err: %v), want none", len(removed), err)
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		t.Parallel()
+		jpegFile, cleanup := setupTestJPEGFile(t)
+		defer cleanup()
+
+		if _, err := FilterEXIFInJPEG(jpegFile, filterFor("publish")); err != nil {
+			t.Fatalf("FilterEXIFInJPEG failed: %v", err)
+		}
+		_, tagNames, err := CheckEXIFInJPEG(jpegFile)
+		if err != nil {
+			t.Fatalf("CheckEXIFInJPEG failed: %v", err)
+		}
+		for _, name := range tagNames {
+			switch name {
+			case "Orientation", "ColorSpace", "PixelXDimension", "PixelYDimension", "ExifTag":
+			default:
+				t.Errorf("Unexpected tag %s kept by the publish profile", name)
+			}
+		}
+	})
+
+	t.Run("share removes XMP", func(t *testing.T) {
+		t.Parallel()
+		jpegFile := filepath.Join(t.TempDir(), "xmp.jpg")
+		writeTestJPEG(t, jpegFile)
+		insertSegments(t, jpegFile, appSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>")))
+
+		// The forensic profile keeps it.
+		if removed, err := FilterEXIFInJPEG(jpegFile, filterFor("forensic")); err != nil || len(removed) != 0 {
+			t.Errorf("forensic removed %d tags (err: %v), want none", len(removed), err)
+		}
+
+		removed, err := FilterEXIFInJPEG(jpegFile, filterFor("share"))
+		if err != nil {
+			t.Fatalf("FilterEXIFInJPEG failed: %v", err)
+		}
+		if len(removed) != 1 || removed[0].Name != "XMP" {
+			t.Errorf("Expected the XMP packet to be reported as removed, got %v", removed)
+		}
+		audit, err := AuditJPEG(jpegFile)
+		if err != nil {
+			t.Fatalf("AuditJPEG failed: %v", err)
+		}
+		if len(audit.Findings) != 0 {
+			t.Errorf("Expected no metadata to be left, got %+v", audit.Findings)
+		}
+	})
+
+	t.Run("gps removes XMP with a location", func(t *testing.T) {
+		t.Parallel()
+		noGPS, err := NewTagFilter([]string{"gps"}, nil)
+		if err != nil {
+			t.Fatalf("NewTagFilter failed: %v", err)
+		}
+		for _, tt := range []struct {
+			name    string
+			xmp     string
+			removed bool
+		}{
+			{"attribute", `<rdf:Description exif:GPSLatitude="35,40.5N" exif:GPSLongitude="139,45.3E"/>`, true},
+			{"element", `<rdf:Description><exif:GPSLongitude>139,45.3E</exif:GPSLongitude></rdf:Description>`, true},
+			{"no location", `<rdf:Description xmp:Rating="5"/>`, false},
+		} {
+			jpegFile := filepath.Join(t.TempDir(), "xmp.jpg")
+			writeTestJPEG(t, jpegFile)
+			insertSegments(t, jpegFile, appSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">"+tt.xmp+"</x:xmpmeta>")))
+
+			removed, err := FilterEXIFInJPEG(jpegFile, noGPS)
+			if err != nil {
+				t.Fatalf("%s: FilterEXIFInJPEG failed: %v", tt.name, err)
+			}
+			gotRemoved := len(removed) == 1 && removed[0].Name == "XMP"
+			if gotRemoved != tt.removed || len(removed) > 1 {
+				t.Errorf("%s: removed %v, want XMP removed = %v", tt.name, removed, tt.removed)
+			}
+		}
+	})
+
+	t.Run("forensic", func(t *testing.T) {
+		t.Parallel()
+		jpegFile, cleanup := setupTestJPEGFile(t)
+		defer cleanup()
+
+		removed, err := FilterEXIFInJPEG(jpegFile, filterFor("forensic"))
+		if err != nil || len(removed) != 0 {
+			t.Errorf("FilterEXIFInJPEG removed %d tags (err: %v), want none", len(removed), err)
+		}
+	})
+}
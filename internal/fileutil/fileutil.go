@@ -0,0 +1,148 @@
+// Package fileutil provides file system helpers shared by the converter and
+// exif packages.
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultPerm is the permission given to newly created files.
+const defaultPerm fs.FileMode = 0644
+
+// link is os.Link, replaced in tests to simulate file systems without hard
+// links.
+var link = os.Link
+
+// WriteAtomic writes a file at path with the data write produces, such that
+// path only ever holds either its previous contents or the complete new
+// file. The data is written to a temporary file in the same directory,
+// synced to disk, and renamed over path only if write succeeds; on any
+// failure the temporary file is removed and path is left untouched. Files
+// modified in place, such as JPEGs whose metadata is rewritten, are written
+// this way so that a failure never corrupts the existing, valid file.
+//
+// An existing file at path keeps its permissions; a new file gets 0644.
+func WriteAtomic(path string, write func(w io.Writer) error) error {
+	perm := defaultPerm
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(statErr, fs.ErrNotExist) {
+		return statErr
+	}
+
+	tmpPath, err := writeTemp(path, perm, write)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("一時ファイルの置き換えに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// WriteNew writes a file with the data write produces at the first of
+// name(0), name(1), ... that does not exist yet, and returns that path. name
+// reports false when there are no more paths to try. Like WriteAtomic, the
+// data is written to a temporary file first; the finished file is then
+// hard-linked to each path in turn, which fails rather than replacing an
+// existing file. No path is claimed before the data is complete, so an
+// interrupted write never leaves an empty or partial file behind.
+//
+// File systems without hard links, such as FAT and exFAT memory cards and
+// many SMB shares, fall back to renameExclusive.
+func WriteNew(name func(n int) (string, bool), write func(w io.Writer) error) (string, error) {
+	first, ok := name(0)
+	if !ok {
+		return "", errors.New("出力ファイル名が指定されていません")
+	}
+
+	tmpPath, err := writeTemp(first, defaultPerm, write)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	hardLinks := true
+	for n := 0; ; {
+		path, ok := name(n)
+		if !ok {
+			break
+		}
+		var err error
+		if hardLinks {
+			err = link(tmpPath, path)
+		} else {
+			err = renameExclusive(tmpPath, path)
+		}
+		switch {
+		case err == nil:
+			return path, nil
+		case errors.Is(err, fs.ErrExist):
+			n++
+		case hardLinks:
+			// Try the same path again without hard links.
+			hardLinks = false
+		default:
+			return "", fmt.Errorf("出力ファイルを作成できませんでした: %w", err)
+		}
+	}
+	return "", fmt.Errorf("空いている出力ファイル名が見つかりませんでした: %s", first)
+}
+
+// renameExclusive claims path by creating it exclusively, failing if it
+// exists, and then renames tmpPath over it. Unlike a hard link, this leaves
+// path briefly empty, but the data is already complete by then.
+func renameExclusive(tmpPath, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, defaultPerm)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// writeTemp writes the data write produces to a new temporary file with
+// permissions perm in the directory of path, synced to disk, and returns
+// its path. The temporary file is removed on failure.
+func writeTemp(path string, perm fs.FileMode, write func(w io.Writer) error) (_ string, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("一時ファイルを作成できませんでした: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return "", err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return "", fmt.Errorf("一時ファイルの権限を設定できませんでした: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return "", fmt.Errorf("一時ファイルの同期に失敗しました: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", fmt.Errorf("一時ファイルを閉じられませんでした: %w", err)
+	}
+	return tmpPath, nil
+}
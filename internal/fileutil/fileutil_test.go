@@ -0,0 +1,215 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestWriteAtomic_NewFile tests writing a file that does not exist yet
+func TestWriteAtomic_NewFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "out.jpg")
+
+	err := WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WriteAtomic failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("Unexpected contents %q (err: %v)", data, err)
+	}
+	assertNoTempFiles(t, filepath.Dir(path))
+}
+
+// TestWriteAtomic_ReplaceKeepsMode tests that replacing a file keeps its
+// permissions
+func TestWriteAtomic_ReplaceKeepsMode(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions are not supported on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "out.jpg")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	err := WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WriteAtomic failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+// TestWriteAtomic_FailureKeepsOriginal tests that a failed write leaves the
+// existing file untouched and removes the temporary file
+func TestWriteAtomic_FailureKeepsOriginal(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "out.jpg")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	writeErr := errors.New("write failed")
+	err := WriteAtomic(path, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("Expected write error, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "original" {
+		t.Errorf("Original file was modified: %q (err: %v)", data, err)
+	}
+	assertNoTempFiles(t, filepath.Dir(path))
+}
+
+// TestWriteAtomic_MissingDirectory tests that a missing directory is an error
+func TestWriteAtomic_MissingDirectory(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "missing", "out.jpg")
+
+	err := WriteAtomic(path, func(w io.Writer) error { return nil })
+	if err == nil {
+		t.Error("Expected error for missing directory")
+	}
+}
+
+// TestWriteNew tests that WriteNew takes the first free name and never
+// replaces an existing file
+func TestWriteNew(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	names := []string{"a.jpg", "a_1.jpg", "a_2.jpg"}
+	name := func(n int) (string, bool) {
+		if n >= len(names) {
+			return "", false
+		}
+		return filepath.Join(dir, names[n]), true
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, expected := range []string{"a_1.jpg", "a_2.jpg"} {
+		path, err := WriteNew(name, func(w io.Writer) error {
+			_, err := w.Write([]byte(expected))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WriteNew failed: %v", err)
+		}
+		if filepath.Base(path) != expected {
+			t.Errorf("WriteNew() = %q, want %q", path, expected)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != expected {
+			t.Errorf("Unexpected contents %q (err: %v)", data, err)
+		}
+	}
+
+	if _, err := WriteNew(name, func(w io.Writer) error { return nil }); err == nil {
+		t.Error("Expected an error once every name is taken")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.jpg")); err != nil || string(data) != "existing" {
+		t.Errorf("Existing file was modified: %q (err: %v)", data, err)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// TestWriteNew_Interrupted tests that no name is claimed until the data is
+// complete, so a failed or interrupted write leaves nothing behind
+func TestWriteNew_Interrupted(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "out.jpg")
+	name := func(n int) (string, bool) { return path, n == 0 }
+
+	writeErr := errors.New("interrupted")
+	_, err := WriteNew(name, func(w io.Writer) error {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Output path exists while writing (err: %v)", err)
+		}
+		_, _ = w.Write([]byte("partial"))
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("Expected write error, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no output file, got err %v", err)
+	}
+	assertNoTempFiles(t, filepath.Dir(path))
+}
+
+// TestWriteNew_NoHardLinks tests the fallback for file systems without hard
+// links: names are still taken in order and existing files are kept. It
+// replaces link, so it must not run in parallel.
+func TestWriteNew_NoHardLinks(t *testing.T) {
+	defer func(orig func(string, string) error) { link = orig }(link)
+	link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+
+	dir := t.TempDir()
+	name := func(n int) (string, bool) {
+		if n > 1 {
+			return "", false
+		}
+		return filepath.Join(dir, []string{"a.jpg", "a_1.jpg"}[n]), true
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	path, err := WriteNew(name, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WriteNew failed: %v", err)
+	}
+	if filepath.Base(path) != "a_1.jpg" {
+		t.Errorf("WriteNew() = %q, want a_1.jpg", path)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "new" {
+		t.Errorf("Unexpected contents %q (err: %v)", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.jpg")); err != nil || string(data) != "existing" {
+		t.Errorf("Existing file was modified: %q (err: %v)", data, err)
+	}
+
+	if _, err := WriteNew(name, func(w io.Writer) error { return nil }); err == nil {
+		t.Error("Expected an error once every name is taken")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// assertNoTempFiles fails if dir contains any leftover temporary files
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Leftover temporary files: %v", matches)
+	}
+}
@@ -0,0 +1,306 @@
+// Package livephoto detects the companion videos of Live Photos and copies
+// them next to converted images.
+package livephoto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sugiyan97/heic-image-converter-cli/internal/exif"
+	"github.com/sugiyan97/heic-image-converter-cli/internal/fileutil"
+)
+
+// Mode selects what is done with the companion video of a Live Photo.
+type Mode string
+
+const (
+	// ModeIgnore converts Live Photos like any other photo and leaves their
+	// videos alone. It is the default.
+	ModeIgnore Mode = "ignore"
+	// ModeCopy copies the companion video next to the converted image.
+	ModeCopy Mode = "copy"
+	// ModeSkip does not convert photos that have a companion video.
+	ModeSkip Mode = "skip"
+)
+
+// contentIdentifierKey is the QuickTime metadata key under which Live Photo
+// videos store the content identifier shared with their photo.
+const contentIdentifierKey = "com.apple.quicktime.content.identifier"
+
+// ParseMode parses a --live-photo value.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(s)); m {
+	case "":
+		return ModeIgnore, nil
+	case ModeIgnore, ModeCopy, ModeSkip:
+		return m, nil
+	default:
+		return "", fmt.Errorf("不明なLive Photoの処理方法です: %s（指定可能: copy, skip, ignore）", s)
+	}
+}
+
+// CompanionIndex finds the Live Photo videos of HEIC files. Each directory
+// is read once, on its first lookup, so that pairing the photos of a large
+// export folder does not reread the folder for every photo. It is not safe
+// for concurrent use.
+type CompanionIndex struct {
+	// dirs maps each directory read so far to its .mov files, keyed by
+	// their lowercased names without extension.
+	dirs map[string]map[string]string
+}
+
+// NewCompanionIndex returns an empty CompanionIndex.
+func NewCompanionIndex() *CompanionIndex {
+	return &CompanionIndex{dirs: make(map[string]map[string]string)}
+}
+
+// movFiles returns the .mov files of dir keyed by their lowercased names
+// without extension, reading dir on the first call.
+func (idx *CompanionIndex) movFiles(dir string) (map[string]string, error) {
+	if movs, ok := idx.dirs[dir]; ok {
+		return movs, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ディレクトリを読み込めませんでした: %w", err)
+	}
+	movs := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || !strings.EqualFold(ext, ".mov") {
+			continue
+		}
+		// Keep the first of names differing only in case, as ReadDir
+		// sorts them.
+		stem := strings.ToLower(strings.TrimSuffix(name, ext))
+		if _, ok := movs[stem]; !ok {
+			movs[stem] = filepath.Join(dir, name)
+		}
+	}
+	idx.dirs[dir] = movs
+	return movs, nil
+}
+
+// FindCompanion returns the path of the Live Photo video paired with the
+// HEIC file at heicPath, or "" if there is none. The video must be a .mov
+// file with the same name (ignoring case) in the same directory. If both the
+// photo's Apple maker note and the video's metadata carry a content
+// identifier, they must also match; otherwise the name alone decides.
+func (idx *CompanionIndex) FindCompanion(heicPath string) (string, error) {
+	movs, err := idx.movFiles(filepath.Dir(heicPath))
+	if err != nil {
+		return "", err
+	}
+	stem := strings.TrimSuffix(filepath.Base(heicPath), filepath.Ext(heicPath))
+	movPath := movs[strings.ToLower(stem)]
+	if movPath == "" {
+		return "", nil
+	}
+
+	photoID, err := photoContentIdentifier(heicPath)
+	if err != nil {
+		return "", err
+	}
+	if photoID == "" {
+		return movPath, nil
+	}
+	videoID, err := ReadVideoContentIdentifier(movPath)
+	if err != nil {
+		return "", err
+	}
+	if videoID != "" && videoID != photoID {
+		return "", nil
+	}
+	return movPath, nil
+}
+
+// photoContentIdentifier returns the content identifier of the HEIC file at
+// heicPath, or "" if it has none.
+func photoContentIdentifier(heicPath string) (string, error) {
+	exifData, err := exif.ExtractEXIFFromHEIC(heicPath)
+	if err != nil {
+		if errors.Is(err, exif.ErrNoEXIF) {
+			return "", nil
+		}
+		return "", err
+	}
+	return exif.ReadContentIdentifier(exifData)
+}
+
+// ReadVideoContentIdentifier returns the content identifier stored in the
+// moov/meta metadata of the QuickTime file at movPath, or "" if it has
+// none.
+func ReadVideoContentIdentifier(movPath string) (string, error) {
+	file, err := os.Open(movPath)
+	if err != nil {
+		return "", fmt.Errorf("動画ファイルを開けませんでした: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("動画ファイルを開けませんでした: %w", err)
+	}
+	moov, err := findAtom(io.NewSectionReader(file, 0, info.Size()), "moov")
+	if err != nil || moov == nil {
+		return "", err
+	}
+	data := make([]byte, moov.Size())
+	if _, err := io.ReadFull(moov, data); err != nil {
+		return "", fmt.Errorf("動画ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	meta := childAtom(data, "meta")
+	if meta == nil {
+		return "", nil
+	}
+	// QuickTime meta atoms start directly with their children, while ISO
+	// meta boxes have a version and flags first.
+	if len(meta) >= 8 && string(meta[4:8]) != "hdlr" {
+		meta = meta[4:]
+	}
+	return metadataValue(meta, contentIdentifierKey), nil
+}
+
+// findAtom returns the body of the first top-level atom of atomType in r,
+// or nil if there is none. Atoms are skipped without being read, so large
+// media data does not have to be loaded.
+func findAtom(r *io.SectionReader, atomType string) (*io.SectionReader, error) {
+	var header [16]byte
+	for offset := int64(0); offset+8 <= r.Size(); {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("動画ファイルの読み込みに失敗しました: %w", err)
+		}
+		size, headerSize := int64(binary.BigEndian.Uint32(header[0:4])), int64(8)
+		switch size {
+		case 0:
+			size = r.Size() - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("動画ファイルの読み込みに失敗しました: %w", err)
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if size < headerSize || size > r.Size()-offset {
+			return nil, fmt.Errorf("動画ファイルの形式が正しくありません")
+		}
+		if string(header[4:8]) == atomType {
+			return io.NewSectionReader(r, offset+headerSize, size-headerSize), nil
+		}
+		offset += size
+	}
+	return nil, nil
+}
+
+// childAtom returns the body of the first atom of atomType among the atoms
+// in data, or nil if there is none.
+func childAtom(data []byte, atomType string) []byte {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		if size < 8 || size > len(data) {
+			return nil
+		}
+		if string(data[4:8]) == atomType {
+			return data[8:size]
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// metadataValue returns the value stored under key in the keys and ilst
+// atoms of a QuickTime meta atom, or "" if there is none.
+func metadataValue(meta []byte, key string) string {
+	keys := childAtom(meta, "keys")
+	if len(keys) < 8 {
+		return ""
+	}
+	// keys: version and flags, entry count, then (size, namespace, name)
+	// entries numbered from 1.
+	index := uint32(0)
+	entries := keys[8:]
+	for i := uint32(1); len(entries) >= 8; i++ {
+		size := int(binary.BigEndian.Uint32(entries[0:4]))
+		if size < 8 || size > len(entries) {
+			return ""
+		}
+		if string(entries[8:size]) == key {
+			index = i
+			break
+		}
+		entries = entries[size:]
+	}
+	if index == 0 {
+		return ""
+	}
+
+	// ilst items are atoms typed by their key index, each holding a data
+	// atom: type indicator, locale, then the value.
+	var indexType [4]byte
+	binary.BigEndian.PutUint32(indexType[:], index)
+	item := childAtom(childAtom(meta, "ilst"), string(indexType[:]))
+	value := childAtom(item, "data")
+	if len(value) < 8 {
+		return ""
+	}
+	return string(bytes.TrimRight(value[8:], "\x00"))
+}
+
+// CompanionOutputPath returns where the companion video movPath is copied
+// for the converted image outputPath: the output's name with the video's
+// extension, so that the pair stays matched by name.
+func CompanionOutputPath(movPath, outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + filepath.Ext(movPath)
+}
+
+// CopyCompanion copies the companion video movPath next to the converted
+// image outputPath (see CompanionOutputPath) and returns the path written.
+// Nothing is copied if the video is already there.
+func CopyCompanion(movPath, outputPath string) (string, error) {
+	dst := CompanionOutputPath(movPath, outputPath)
+	if same, err := sameFile(movPath, dst); err != nil || same {
+		return dst, err
+	}
+
+	src, err := os.Open(movPath)
+	if err != nil {
+		return "", fmt.Errorf("動画ファイルを開けませんでした: %w", err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	err = fileutil.WriteAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("動画ファイルのコピーに失敗しました: %w", err)
+	}
+	return dst, nil
+}
+
+// sameFile reports whether a and b are the same existing file.
+func sameFile(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("動画ファイルを開けませんでした: %w", err)
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return os.SameFile(aInfo, bInfo), nil
+}
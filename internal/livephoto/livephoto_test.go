@@ -0,0 +1,228 @@
+package livephoto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testContentID = "2F9D8A24-5C71-4E0B-9D3A-7B1E0C6F4A52"
+
+// atom builds a QuickTime atom from its type and body parts
+func atom(atomType string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(out, atomType...), data...)
+}
+
+// movWithContentID builds a minimal QuickTime file whose moov/meta holds
+// the content identifier id. isoMeta adds the version and flags that ISO
+// meta boxes carry.
+func movWithContentID(id string, isoMeta bool) []byte {
+	keys := atom("keys",
+		[]byte{0, 0, 0, 0, 0, 0, 0, 2},
+		atom("mdta", []byte("com.apple.quicktime.make")),
+		atom("mdta", []byte(contentIdentifierKey)),
+	)
+	ilst := atom("ilst",
+		atom("\x00\x00\x00\x01", atom("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Apple"))),
+		atom("\x00\x00\x00\x02", atom("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(id))),
+	)
+	var meta []byte
+	if isoMeta {
+		meta = atom("meta", []byte{0, 0, 0, 0}, atom("hdlr", make([]byte, 24)), keys, ilst)
+	} else {
+		meta = atom("meta", atom("hdlr", make([]byte, 24)), keys, ilst)
+	}
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")),
+		atom("wide"),
+		atom("mdat", make([]byte, 1024)),
+		atom("moov", atom("mvhd", make([]byte, 100)), meta),
+	}, nil)
+}
+
+// setupLivePhoto creates a HEIC file and, if movName is set, a video next to
+// it, returning the HEIC path
+func setupLivePhoto(t *testing.T, movName string, mov []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("..", "..", "test_images", "test.HEIC"))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	heicPath := filepath.Join(dir, "IMG_0001.HEIC")
+	if err := os.WriteFile(heicPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if movName != "" {
+		if err := os.WriteFile(filepath.Join(dir, movName), mov, 0644); err != nil {
+			t.Fatalf("Failed to write video file: %v", err)
+		}
+	}
+	return heicPath
+}
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		want    Mode
+		wantErr bool
+	}{
+		{"", ModeIgnore, false},
+		{"copy", ModeCopy, false},
+		{"SKIP", ModeSkip, false},
+		{"ignore", ModeIgnore, false},
+		{"move", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadVideoContentIdentifier(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	// A 64-bit atom size must be handled when skipping media data.
+	largeMdat := binary.BigEndian.AppendUint32(nil, 1)
+	largeMdat = append(largeMdat, "mdat"...)
+	largeMdat = binary.BigEndian.AppendUint64(largeMdat, 16+64)
+	largeMdat = append(largeMdat, make([]byte, 64)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"QuickTime meta", movWithContentID(testContentID, false), testContentID},
+		{"ISO meta", movWithContentID(testContentID, true), testContentID},
+		{"64-bit atom", append(largeMdat, atom("moov", atom("meta", atom("hdlr", make([]byte, 24)),
+			atom("keys", []byte{0, 0, 0, 0, 0, 0, 0, 1}, atom("mdta", []byte(contentIdentifierKey))),
+			atom("ilst", atom("\x00\x00\x00\x01", atom("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(testContentID))))))...), testContentID},
+		{"no metadata", atom("moov", atom("mvhd", make([]byte, 100))), ""},
+		{"no moov", atom("ftyp", []byte("qt  ")), ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".MOV")
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatalf("Failed to write video file: %v", err)
+		}
+		got, err := ReadVideoContentIdentifier(path)
+		if err != nil {
+			t.Errorf("%s: ReadVideoContentIdentifier failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: ReadVideoContentIdentifier() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	broken := filepath.Join(dir, "broken.MOV")
+	if err := os.WriteFile(broken, []byte("\x00\x00\xff\xffmoov"), 0644); err != nil {
+		t.Fatalf("Failed to write video file: %v", err)
+	}
+	if _, err := ReadVideoContentIdentifier(broken); err == nil {
+		t.Error("Expected an error for a truncated atom")
+	}
+}
+
+func TestFindCompanion(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		movName string
+		found   bool
+	}{
+		{"same name", "IMG_0001.MOV", true},
+		{"lowercase extension", "IMG_0001.mov", true},
+		{"different name", "IMG_0002.MOV", false},
+		{"no video", "", false},
+	}
+	for _, tt := range tests {
+		heicPath := setupLivePhoto(t, tt.movName, movWithContentID(testContentID, false))
+		got, err := NewCompanionIndex().FindCompanion(heicPath)
+		if err != nil {
+			t.Errorf("%s: FindCompanion failed: %v", tt.name, err)
+			continue
+		}
+		want := ""
+		if tt.found {
+			want = filepath.Join(filepath.Dir(heicPath), tt.movName)
+		}
+		if got != want {
+			t.Errorf("%s: FindCompanion() = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+// TestCompanionIndex_SharedDirectory tests pairing several photos of one
+// directory, which is read only once
+func TestCompanionIndex_SharedDirectory(t *testing.T) {
+	t.Parallel()
+	mov := movWithContentID(testContentID, false)
+	first := setupLivePhoto(t, "IMG_0001.MOV", mov)
+	dir := filepath.Dir(first)
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	second := filepath.Join(dir, "img_0002.heic")
+	if err := os.WriteFile(second, data, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "IMG_0002.mov"), mov, 0644); err != nil {
+		t.Fatalf("Failed to write video file: %v", err)
+	}
+	third := filepath.Join(dir, "IMG_0003.HEIC")
+
+	idx := NewCompanionIndex()
+	for heicPath, want := range map[string]string{
+		first:  filepath.Join(dir, "IMG_0001.MOV"),
+		second: filepath.Join(dir, "IMG_0002.mov"),
+		third:  "",
+	} {
+		got, err := idx.FindCompanion(heicPath)
+		if err != nil {
+			t.Errorf("FindCompanion(%s) failed: %v", heicPath, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("FindCompanion(%s) = %q, want %q", heicPath, got, want)
+		}
+	}
+	if len(idx.dirs) != 1 {
+		t.Errorf("Expected the directory to be read once, got %d entries", len(idx.dirs))
+	}
+}
+
+func TestCopyCompanion(t *testing.T) {
+	t.Parallel()
+	mov := movWithContentID(testContentID, false)
+	heicPath := setupLivePhoto(t, "IMG_0001.MOV", mov)
+	movPath := filepath.Join(filepath.Dir(heicPath), "IMG_0001.MOV")
+
+	outputPath := filepath.Join(t.TempDir(), "2024-05-03_IMG_0001.jpg")
+	dst, err := CopyCompanion(movPath, outputPath)
+	if err != nil {
+		t.Fatalf("CopyCompanion failed: %v", err)
+	}
+	if want := CompanionOutputPath(movPath, outputPath); dst != want {
+		t.Errorf("CopyCompanion() = %q, want %q", dst, want)
+	}
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, mov) {
+		t.Errorf("Copied video differs from the source: %v", err)
+	}
+
+	// Converting next to the input leaves the video where it is.
+	dst, err = CopyCompanion(movPath, filepath.Join(filepath.Dir(heicPath), "IMG_0001.jpg"))
+	if err != nil || dst != movPath {
+		t.Errorf("CopyCompanion() = %q, %v; want %q", dst, err, movPath)
+	}
+}